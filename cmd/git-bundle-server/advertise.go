@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	"github.com/git-ecosystem/git-bundle-server/internal/bundles"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+type advertiseCmd struct {
+	logger    log.TraceLogger
+	container *utils.DependencyContainer
+}
+
+func NewAdvertiseCommand(logger log.TraceLogger, container *utils.DependencyContainer) argparse.Subcommand {
+	return &advertiseCmd{
+		logger:    logger,
+		container: container,
+	}
+}
+
+func (advertiseCmd) Name() string {
+	return "advertise"
+}
+
+func (advertiseCmd) Description() string {
+	return `
+Print the Git config with which a Git server can advertise the bundle list of
+'<route>' to clients via the protocol v2 'bundle-uri' command.`
+}
+
+func (a *advertiseCmd) Run(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(a.logger, "git-bundle-server advertise --base-url <url> <route>")
+	baseUrl := parser.String("base-url", "", "the public URL of the bundle web server")
+	route := parser.PositionalString("route", "the route to advertise", true)
+	parser.Parse(ctx, args)
+
+	if *baseUrl == "" {
+		parser.Usage(ctx, "Please specify a base URL with '--base-url'.")
+	}
+	err := bundles.ValidateServerUrl(*baseUrl)
+	if err != nil {
+		parser.Usage(ctx, "%s", err)
+	}
+
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, a.container)
+	bundleProvider := utils.GetDependency[bundles.BundleProvider](ctx, a.container)
+
+	repos, err := repoProvider.GetRepositories(ctx)
+	if err != nil {
+		return a.logger.Error(ctx, err)
+	}
+
+	repo, contains := repos[*route]
+	if !contains {
+		return a.logger.Errorf(ctx, "route '%s' is not registered", *route)
+	}
+
+	list, err := bundleProvider.GetBundleList(ctx, &repo)
+	if err != nil {
+		return a.logger.Errorf(ctx, "failed to load bundle list: %w", err)
+	}
+
+	err = bundles.WriteBundleUriConfig(os.Stdout, list, *baseUrl)
+	if err != nil {
+		return a.logger.Errorf(ctx, "failed to write bundle list config: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	"github.com/git-ecosystem/git-bundle-server/internal/common"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+type configCmd struct {
+	logger    log.TraceLogger
+	container *utils.DependencyContainer
+}
+
+func NewConfigCommand(logger log.TraceLogger, container *utils.DependencyContainer) argparse.Subcommand {
+	return &configCmd{
+		logger:    logger,
+		container: container,
+	}
+}
+
+func (configCmd) Name() string {
+	return "config"
+}
+
+func (configCmd) Description() string {
+	return `
+Get and set the server config, which provides the defaults for the data
+locations, bundle generation, update schedule, and web server options.`
+}
+
+func (c *configCmd) lookupSetting(ctx context.Context, parser interface {
+	Usage(context.Context, string, ...any)
+}, key string) *utils.ConfigSetting {
+	setting, ok := utils.LookupConfigSetting(key)
+	if !ok {
+		parser.Usage(ctx, "Unknown setting '%s' (see 'git-bundle-server config list --all').", key)
+	}
+	return setting
+}
+
+func (c *configCmd) getSetting(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(c.logger, "git-bundle-server config get <key>")
+	key := parser.PositionalString("key", "the name of the setting", true)
+	parser.Parse(ctx, args)
+
+	c.lookupSetting(ctx, parser, *key)
+
+	config := utils.GetDependency[core.ServerConfig](ctx, c.container)
+	value, ok := config[*key]
+	if !ok {
+		return c.logger.Errorf(ctx, "'%s' is not set", *key)
+	}
+
+	fmt.Println(value)
+	return nil
+}
+
+func (c *configCmd) writeSetting(ctx context.Context, key string, value string) error {
+	user, err := utils.GetDependency[common.UserProvider](ctx, c.container).CurrentUser()
+	if err != nil {
+		return c.logger.Errorf(ctx, "could not get current user: %w", err)
+	}
+
+	config := utils.GetDependency[core.ServerConfig](ctx, c.container)
+	if value == "" {
+		delete(config, key)
+	} else {
+		config[key] = value
+	}
+
+	fileSystem := utils.GetDependency[common.FileSystem](ctx, c.container)
+	err = core.WriteServerConfig(fileSystem, user, config)
+	if err != nil {
+		return c.logger.Error(ctx, err)
+	}
+
+	if key == "schedule" {
+		// Reschedule the updates, unless they were never scheduled (e.g.
+		// because the scheduler daemon runs them)
+		cron := utils.GetDependency[utils.CronHelper](ctx, c.container)
+		_, exists, err := cron.GetCronSchedule(ctx)
+		if err != nil {
+			return c.logger.Error(ctx, err)
+		} else if exists {
+			schedule, err := utils.ConfiguredSchedule(config)
+			if err != nil {
+				return c.logger.Error(ctx, err)
+			}
+			err = cron.ChangeCronSchedule(ctx, schedule)
+			if err != nil {
+				return c.logger.Error(ctx, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *configCmd) setSetting(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(c.logger, "git-bundle-server config set <key> <value>")
+	key := parser.PositionalString("key", "the name of the setting", true)
+	value := parser.PositionalString("value", "the new value of the setting", true)
+	parser.Parse(ctx, args)
+
+	setting := c.lookupSetting(ctx, parser, *key)
+	normalized, err := setting.Normalize(*value)
+	if err != nil {
+		parser.Usage(ctx, "%s", err)
+	}
+
+	return c.writeSetting(ctx, *key, normalized)
+}
+
+func (c *configCmd) unsetSetting(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(c.logger, "git-bundle-server config unset <key>")
+	key := parser.PositionalString("key", "the name of the setting", true)
+	parser.Parse(ctx, args)
+
+	c.lookupSetting(ctx, parser, *key)
+
+	return c.writeSetting(ctx, *key, "")
+}
+
+func (c *configCmd) listSettings(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(c.logger, "git-bundle-server config list [--all]")
+	all := parser.Bool("all", false, "list every available setting with its description, including unset ones")
+	parser.Parse(ctx, args)
+
+	config := utils.GetDependency[core.ServerConfig](ctx, c.container)
+
+	if *all {
+		for _, setting := range utils.ConfigSettings() {
+			fmt.Printf("%s=%s\n    %s\n", setting.Name, config[setting.Name], setting.Description)
+		}
+		return nil
+	}
+
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		fmt.Printf("%s=%s\n", key, config[key])
+	}
+
+	return nil
+}
+
+func (c *configCmd) Run(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(c.logger, "git-bundle-server config (get|set|unset|list) <options>")
+	parser.Subcommand(argparse.NewSubcommand("get", "Print the value of a setting", c.getSetting))
+	parser.Subcommand(argparse.NewSubcommand("set", "Set the value of a setting", c.setSetting))
+	parser.Subcommand(argparse.NewSubcommand("unset", "Remove a setting, restoring its default", c.unsetSetting))
+	parser.Subcommand(argparse.NewSubcommand("list", "List the configured settings", c.listSettings))
+	parser.Parse(ctx, args)
+
+	return parser.InvokeSubcommand(ctx)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+type cronCmd struct {
+	logger    log.TraceLogger
+	container *utils.DependencyContainer
+}
+
+func NewCronCommand(logger log.TraceLogger, container *utils.DependencyContainer) argparse.Subcommand {
+	return &cronCmd{
+		logger:    logger,
+		container: container,
+	}
+}
+
+func (cronCmd) Name() string {
+	return "cron"
+}
+
+func (cronCmd) Description() string {
+	return `
+Manage the cron job (or, where supported, the systemd or launchd timer) that
+periodically runs 'git-bundle-server update-all'.`
+}
+
+func (c *cronCmd) showSchedule(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(c.logger, "git-bundle-server cron show")
+	parser.Parse(ctx, args)
+
+	cron := utils.GetDependency[utils.CronHelper](ctx, c.container)
+
+	schedule, exists, err := cron.GetCronSchedule(ctx)
+	if err != nil {
+		return c.logger.Error(ctx, err)
+	}
+
+	if exists {
+		fmt.Println(schedule)
+	} else {
+		fmt.Println("No update schedule is configured")
+	}
+
+	return nil
+}
+
+func (c *cronCmd) setSchedule(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(c.logger, "git-bundle-server cron set <cron-expression>")
+	expr := parser.PositionalString("cron-expression", "the schedule on which to run updates (e.g. '*/15 * * * *')", true)
+	parser.Parse(ctx, args)
+
+	_, err := core.ParseCronSchedule(*expr)
+	if err != nil {
+		parser.Usage(ctx, "%s", err)
+	}
+
+	cron := utils.GetDependency[utils.CronHelper](ctx, c.container)
+	return cron.ChangeCronSchedule(ctx, *expr)
+}
+
+func (c *cronCmd) removeSchedule(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(c.logger, "git-bundle-server cron remove")
+	parser.Parse(ctx, args)
+
+	cron := utils.GetDependency[utils.CronHelper](ctx, c.container)
+	return cron.RemoveCronSchedule(ctx)
+}
+
+func (c *cronCmd) Run(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(c.logger, "git-bundle-server cron (show|set|remove) <options>")
+	parser.Subcommand(argparse.NewSubcommand("show", "Show the update schedule", c.showSchedule))
+	parser.Subcommand(argparse.NewSubcommand("set", "Set the update schedule", c.setSchedule))
+	parser.Subcommand(argparse.NewSubcommand("remove", "Remove the scheduled update job", c.removeSchedule))
+	parser.Parse(ctx, args)
+
+	return parser.InvokeSubcommand(ctx)
+}
@@ -59,5 +59,6 @@ func (d *deleteCmd) Run(ctx context.Context, args []string) error {
 		return d.logger.Error(ctx, err)
 	}
 
-	return nil
+	// Stop the global schedule if there are no routes left to update
+	return removeScheduleIfUnused(ctx, d.logger, d.container)
 }
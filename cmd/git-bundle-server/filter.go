@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	"github.com/git-ecosystem/git-bundle-server/internal/bundles"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/git"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+type filterCmd struct {
+	logger    log.TraceLogger
+	container *utils.DependencyContainer
+}
+
+func NewFilterCommand(logger log.TraceLogger, container *utils.DependencyContainer) argparse.Subcommand {
+	return &filterCmd{
+		logger:    logger,
+		container: container,
+	}
+}
+
+func (filterCmd) Name() string {
+	return "filter"
+}
+
+func (filterCmd) Description() string {
+	return `
+Manage the object filters with which sets of filtered bundles are generated for
+a route, for use by partial clones.`
+}
+
+func (f *filterCmd) loadConfig(ctx context.Context, route string) (*core.Repository, *core.RouteConfig, error) {
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, f.container)
+
+	repos, err := repoProvider.GetRepositories(ctx)
+	if err != nil {
+		return nil, nil, f.logger.Error(ctx, err)
+	}
+
+	repo, contains := repos[route]
+	if !contains {
+		return nil, nil, f.logger.Errorf(ctx, "route '%s' is not registered", route)
+	}
+
+	config, err := repoProvider.ReadRouteConfig(ctx, &repo)
+	if err != nil {
+		return nil, nil, f.logger.Errorf(ctx, "failed to load route config: %w", err)
+	}
+
+	return &repo, config, nil
+}
+
+func (f *filterCmd) addFilter(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(f.logger, "git-bundle-server filter add <route> <filter-spec>")
+	route := parser.PositionalString("route", "the route to generate filtered bundles for", true)
+	filter := parser.PositionalString("filter-spec", "the object filter (e.g. 'blob:none')", true)
+	parser.Parse(ctx, args)
+
+	err := bundles.ValidateFilter(*filter)
+	if err != nil {
+		parser.Usage(ctx, "%s", err)
+	}
+
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, f.container)
+	bundleProvider := utils.GetDependency[bundles.BundleProvider](ctx, f.container)
+
+	repo, config, err := f.loadConfig(ctx, *route)
+	if err != nil {
+		return err
+	}
+
+	if !config.AddFilter(*filter) {
+		fmt.Printf("Filter '%s' is already configured for %s\n", *filter, repo.Route)
+		return nil
+	}
+
+	// Create the initial filtered bundle before saving the config so that an
+	// unsupported filter is not retried on every update.
+	fmt.Printf("Constructing '%s' filtered bundle\n", *filter)
+	err = bundleProvider.UpdateFilteredList(ctx, repo, *filter)
+	if errors.Is(err, git.ErrBundleFilterUnsupported) {
+		return f.logger.Errorf(ctx, "cannot add filter '%s': %w", *filter, err)
+	} else if err != nil {
+		return f.logger.Error(ctx, err)
+	}
+
+	err = repoProvider.WriteRouteConfig(ctx, repo, config)
+	if err != nil {
+		return f.logger.Errorf(ctx, "failed to write route config: %w", err)
+	}
+
+	return nil
+}
+
+func (f *filterCmd) removeFilter(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(f.logger, "git-bundle-server filter remove <route> <filter-spec>")
+	route := parser.PositionalString("route", "the route to stop generating filtered bundles for", true)
+	filter := parser.PositionalString("filter-spec", "the object filter (e.g. 'blob:none')", true)
+	parser.Parse(ctx, args)
+
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, f.container)
+	bundleProvider := utils.GetDependency[bundles.BundleProvider](ctx, f.container)
+
+	repo, config, err := f.loadConfig(ctx, *route)
+	if err != nil {
+		return err
+	}
+
+	if !config.RemoveFilter(*filter) {
+		return f.logger.Errorf(ctx, "filter '%s' is not configured for %s", *filter, repo.Route)
+	}
+
+	err = repoProvider.WriteRouteConfig(ctx, repo, config)
+	if err != nil {
+		return f.logger.Errorf(ctx, "failed to write route config: %w", err)
+	}
+
+	err = bundleProvider.RemoveFilteredList(ctx, repo, *filter)
+	if err != nil {
+		return f.logger.Error(ctx, err)
+	}
+
+	return nil
+}
+
+func (f *filterCmd) listFilters(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(f.logger, "git-bundle-server filter list <route>")
+	route := parser.PositionalString("route", "the route whose filters should be listed", true)
+	parser.Parse(ctx, args)
+
+	_, config, err := f.loadConfig(ctx, *route)
+	if err != nil {
+		return err
+	}
+
+	for _, filter := range config.Filters {
+		fmt.Printf("%s\t%s\n", filter, bundles.FilteredBundleListFilename(filter))
+	}
+
+	return nil
+}
+
+func (f *filterCmd) Run(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(f.logger, "git-bundle-server filter (add|remove|list) <options>")
+	parser.Subcommand(argparse.NewSubcommand("add", "Generate filtered bundles for a route", f.addFilter))
+	parser.Subcommand(argparse.NewSubcommand("remove", "Stop generating filtered bundles for a route", f.removeFilter))
+	parser.Subcommand(argparse.NewSubcommand("list", "List the object filters configured for a route", f.listFilters))
+	parser.Parse(ctx, args)
+
+	return parser.InvokeSubcommand(ctx)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 
 	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
@@ -35,10 +36,40 @@ should be hosted at '<route>'.`
 }
 
 func (i *initCmd) Run(ctx context.Context, args []string) error {
-	parser := argparse.NewArgParser(i.logger, "git-bundle-server init <url> [<route>]")
+	parser := argparse.NewArgParser(i.logger, "git-bundle-server init [--mirror <url>]... [--filter <filter-spec>]... [--no-fetch] [<schedule-options>] [<credential-options>] <url> [<route>]")
+	mirrors := parser.StringList("mirror", "the base URL of a web server replicating this route's bundles (may be repeated)")
+	filters := parser.StringList("filter", "an object filter with which to also create a set of filtered bundles (may be repeated)")
+	noFetch := parser.Bool("no-fetch", false, "never fetch from '<url>' after the initial clone; bundle only content pushed into the repository")
 	url := parser.PositionalString("url", "the URL of a repository to clone", true)
 	route := parser.PositionalString("route", "the route to host the specified repo", false)
+	scheduleFlags, validateSchedule, applySchedule := utils.RouteScheduleFlags(parser)
+	scheduleFlags.VisitAll(func(f *flag.Flag) {
+		parser.Var(f.Value, f.Name, f.Usage)
+	})
+	credentialFlags, validateCredentials, applyCredentials := utils.RouteCredentialFlags(parser)
+	credentialFlags.VisitAll(func(f *flag.Flag) {
+		parser.Var(f.Value, f.Name, f.Usage)
+	})
 	parser.Parse(ctx, args)
+	validateSchedule(ctx)
+	validateCredentials(ctx)
+
+	config := &core.RouteConfig{NoFetch: *noFetch}
+	writeConfig := applySchedule(config) || *noFetch || len(*filters) > 0
+	writeConfig = applyCredentials(config) || writeConfig
+
+	for _, mirror := range *mirrors {
+		err := bundles.ValidateServerUrl(mirror)
+		if err != nil {
+			parser.Usage(ctx, "%s", err)
+		}
+	}
+	for _, filter := range *filters {
+		err := bundles.ValidateFilter(filter)
+		if err != nil {
+			parser.Usage(ctx, "%s", err)
+		}
+	}
 
 	// Set route value, if needed
 	if *route == "" {
@@ -71,7 +102,7 @@ func (i *initCmd) Run(ctx context.Context, args []string) error {
 	}
 
 	fmt.Printf("Cloning repository from %s\n", *url)
-	err = gitHelper.CloneBareRepo(ctx, *url, repo.RepoDir)
+	err = gitHelper.CloneBareRepo(ctx, *url, repo.RepoDir, config.Credentials)
 	if err != nil {
 		return i.logger.Errorf(ctx, "failed to clone repository: %w", err)
 	}
@@ -79,7 +110,7 @@ func (i *initCmd) Run(ctx context.Context, args []string) error {
 	bundle := bundleProvider.CreateInitialBundle(ctx, repo)
 	fmt.Printf("Constructing base bundle file at %s\n", bundle.Filename)
 
-	written, gitErr := gitHelper.CreateBundle(ctx, repo.RepoDir, bundle.Filename)
+	written, gitErr := gitHelper.CreateBundle(ctx, repo.RepoDir, bundle.Filename, "")
 	if gitErr != nil {
 		return i.logger.Errorf(ctx, "failed to create bundle: %w", gitErr)
 	}
@@ -88,11 +119,33 @@ func (i *initCmd) Run(ctx context.Context, args []string) error {
 	}
 
 	list := bundleProvider.CreateSingletonList(ctx, bundle)
+	for _, mirror := range *mirrors {
+		list.AddMirror(mirror)
+	}
 	listErr := bundleProvider.WriteBundleList(ctx, list, repo)
 	if listErr != nil {
 		return i.logger.Errorf(ctx, "failed to write bundle list: %w", listErr)
 	}
 
+	if writeConfig {
+		for _, filter := range *filters {
+			if !config.AddFilter(filter) {
+				continue
+			}
+
+			fmt.Printf("Constructing '%s' filtered bundle\n", filter)
+			err = bundleProvider.UpdateFilteredList(ctx, repo, filter)
+			if err != nil {
+				return i.logger.Error(ctx, err)
+			}
+		}
+
+		err = repoProvider.WriteRouteConfig(ctx, repo, config)
+		if err != nil {
+			return i.logger.Errorf(ctx, "failed to write route config: %w", err)
+		}
+	}
+
 	cron := utils.GetDependency[utils.CronHelper](ctx, i.container)
 	cron.SetCronSchedule(ctx)
 
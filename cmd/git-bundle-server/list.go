@@ -4,12 +4,14 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
 	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
 	"github.com/git-ecosystem/git-bundle-server/internal/core"
 	"github.com/git-ecosystem/git-bundle-server/internal/git"
 	"github.com/git-ecosystem/git-bundle-server/internal/log"
+	"github.com/git-ecosystem/git-bundle-server/internal/scheduler"
 )
 
 type listCmd struct {
@@ -40,12 +42,22 @@ func (l *listCmd) Run(ctx context.Context, args []string) error {
 
 	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, l.container)
 	gitHelper := utils.GetDependency[git.GitHelper](ctx, l.container)
+	history := utils.GetDependency[scheduler.RunHistory](ctx, l.container)
 
 	repos, err := repoProvider.GetRepositories(ctx)
 	if err != nil {
 		return l.logger.Error(ctx, err)
 	}
 
+	lastRuns := map[string]scheduler.RunRecord{}
+	if !*nameOnly {
+		records, err := history.Read(ctx)
+		if err != nil {
+			return l.logger.Error(ctx, err)
+		}
+		lastRuns = scheduler.LastRuns(records)
+	}
+
 	for _, repo := range repos {
 		info := []string{repo.Route}
 		if !*nameOnly {
@@ -54,6 +66,29 @@ func (l *listCmd) Run(ctx context.Context, args []string) error {
 				return l.logger.Error(ctx, err)
 			}
 			info = append(info, remote)
+
+			config, err := repoProvider.ReadRouteConfig(ctx, &repo)
+			if err != nil {
+				return l.logger.Error(ctx, err)
+			}
+			schedule, err := config.GetUpdateSchedule()
+			if err != nil {
+				return l.logger.Error(ctx, err)
+			}
+			info = append(info, schedule.String())
+
+			next := "next update: due"
+			if lastRun, ok := lastRuns[repo.Route]; ok {
+				nextRun := scheduler.NextRun(repo.Route, schedule, &lastRun)
+				if nextRun.After(time.Now()) {
+					next = "next update: " + nextRun.Local().Format(time.RFC3339)
+				}
+			}
+			info = append(info, next)
+
+			if !config.Credentials.IsEmpty() {
+				info = append(info, "credentials: "+config.Credentials.String())
+			}
 		}
 
 		// Join with space & tab to ensure each element of the info array is
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"os"
 
 	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
@@ -13,14 +14,20 @@ func all(logger log.TraceLogger) []argparse.Subcommand {
 	container := utils.BuildGitBundleServerContainer(logger)
 
 	return []argparse.Subcommand{
+		NewAdvertiseCommand(logger, container),
+		NewConfigCommand(logger, container),
+		NewCronCommand(logger, container),
 		NewDeleteCommand(logger, container),
 		NewInitCommand(logger, container),
 		NewRepairCommand(logger, container),
+		NewSchedulerCommand(logger, container),
 		NewStartCommand(logger, container),
 		NewStopCommand(logger, container),
 		NewUpdateCommand(logger, container),
 		NewUpdateAllCommand(logger, container),
 		NewListCommand(logger, container),
+		NewMirrorCommand(logger, container),
+		NewFilterCommand(logger, container),
 		NewVersionCommand(logger, container),
 		NewWebServerCommand(logger, container),
 	}
@@ -30,12 +37,21 @@ func main() {
 	log.WithTraceLogger(context.Background(), func(ctx context.Context, logger log.TraceLogger) {
 		cmds := all(logger)
 
-		parser := argparse.NewArgParser(logger, "git-bundle-server <command> [<options>]")
+		parser := argparse.NewArgParser(logger, "git-bundle-server [--root <dir>] "+
+			"[--repo-root <dir>] [--web-root <dir>] <command> [<options>]")
 		parser.SetIsTopLevel(true)
 		for _, cmd := range cmds {
 			parser.Subcommand(cmd)
 		}
+
+		// Options setting the data locations used by all commands
+		dataRootFlags, applyDataRoots := utils.DataRootFlags(parser)
+		dataRootFlags.VisitAll(func(f *flag.Flag) {
+			parser.Var(f.Value, f.Name, f.Usage)
+		})
+
 		parser.Parse(ctx, os.Args[1:])
+		applyDataRoots(ctx)
 
 		err := parser.InvokeSubcommand(ctx)
 		if err != nil {
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	"github.com/git-ecosystem/git-bundle-server/internal/bundles"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+type mirrorCmd struct {
+	logger    log.TraceLogger
+	container *utils.DependencyContainer
+}
+
+func NewMirrorCommand(logger log.TraceLogger, container *utils.DependencyContainer) argparse.Subcommand {
+	return &mirrorCmd{
+		logger:    logger,
+		container: container,
+	}
+}
+
+func (mirrorCmd) Name() string {
+	return "mirror"
+}
+
+func (mirrorCmd) Description() string {
+	return `
+Manage the web servers replicating the bundles of a route.`
+}
+
+func (m *mirrorCmd) loadList(ctx context.Context, route string) (*core.Repository, *bundles.BundleList, error) {
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, m.container)
+	bundleProvider := utils.GetDependency[bundles.BundleProvider](ctx, m.container)
+
+	repos, err := repoProvider.GetRepositories(ctx)
+	if err != nil {
+		return nil, nil, m.logger.Error(ctx, err)
+	}
+
+	repo, contains := repos[route]
+	if !contains {
+		return nil, nil, m.logger.Errorf(ctx, "route '%s' is not registered", route)
+	}
+
+	list, err := bundleProvider.GetBundleList(ctx, &repo)
+	if err != nil {
+		return nil, nil, m.logger.Errorf(ctx, "failed to load bundle list: %w", err)
+	}
+
+	return &repo, list, nil
+}
+
+func (m *mirrorCmd) writeList(ctx context.Context, repo *core.Repository, list *bundles.BundleList) error {
+	bundleProvider := utils.GetDependency[bundles.BundleProvider](ctx, m.container)
+
+	err := bundleProvider.WriteBundleList(ctx, list, repo)
+	if err != nil {
+		return m.logger.Errorf(ctx, "failed to write bundle list: %w", err)
+	}
+
+	return nil
+}
+
+func (m *mirrorCmd) addMirror(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(m.logger, "git-bundle-server mirror add <route> <url>")
+	route := parser.PositionalString("route", "the route served by the mirror", true)
+	url := parser.PositionalString("url", "the base URL of the mirror web server", true)
+	parser.Parse(ctx, args)
+
+	err := bundles.ValidateServerUrl(*url)
+	if err != nil {
+		parser.Usage(ctx, "%s", err)
+	}
+
+	repo, list, err := m.loadList(ctx, *route)
+	if err != nil {
+		return err
+	}
+
+	if !list.AddMirror(*url) {
+		fmt.Printf("Mirror '%s' is already configured for %s\n", *url, repo.Route)
+		return nil
+	}
+
+	return m.writeList(ctx, repo, list)
+}
+
+func (m *mirrorCmd) removeMirror(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(m.logger, "git-bundle-server mirror remove <route> <url>")
+	route := parser.PositionalString("route", "the route served by the mirror", true)
+	url := parser.PositionalString("url", "the base URL of the mirror web server", true)
+	parser.Parse(ctx, args)
+
+	repo, list, err := m.loadList(ctx, *route)
+	if err != nil {
+		return err
+	}
+
+	if !list.RemoveMirror(*url) {
+		return m.logger.Errorf(ctx, "mirror '%s' is not configured for %s", *url, repo.Route)
+	}
+
+	return m.writeList(ctx, repo, list)
+}
+
+func (m *mirrorCmd) listMirrors(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(m.logger, "git-bundle-server mirror list <route>")
+	route := parser.PositionalString("route", "the route whose mirrors should be listed", true)
+	parser.Parse(ctx, args)
+
+	_, list, err := m.loadList(ctx, *route)
+	if err != nil {
+		return err
+	}
+
+	for _, mirror := range list.Mirrors {
+		fmt.Println(mirror)
+	}
+
+	return nil
+}
+
+func (m *mirrorCmd) Run(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(m.logger, "git-bundle-server mirror (add|remove|list) <options>")
+	parser.Subcommand(argparse.NewSubcommand("add", "Add a mirror to a route's mirror list", m.addMirror))
+	parser.Subcommand(argparse.NewSubcommand("remove", "Remove a mirror from a route's mirror list", m.removeMirror))
+	parser.Subcommand(argparse.NewSubcommand("list", "List the mirrors configured for a route", m.listMirrors))
+	parser.Parse(ctx, args)
+
+	return parser.InvokeSubcommand(ctx)
+}
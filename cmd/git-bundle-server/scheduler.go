@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	"github.com/git-ecosystem/git-bundle-server/internal/common"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/daemon"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+	"github.com/git-ecosystem/git-bundle-server/internal/scheduler"
+)
+
+type schedulerCmd struct {
+	logger    log.TraceLogger
+	container *utils.DependencyContainer
+}
+
+func NewSchedulerCommand(logger log.TraceLogger, container *utils.DependencyContainer) argparse.Subcommand {
+	return &schedulerCmd{
+		logger:    logger,
+		container: container,
+	}
+}
+
+func (schedulerCmd) Name() string {
+	return "scheduler"
+}
+
+func (schedulerCmd) Description() string {
+	return `
+Manage the daemon that periodically updates each route according to its update
+interval.`
+}
+
+func (s *schedulerCmd) getDaemonConfig(ctx context.Context) (*daemon.DaemonConfig, error) {
+	fileSystem := utils.GetDependency[common.FileSystem](ctx, s.container)
+	programPath, err := fileSystem.GetLocalExecutable("git-bundle-server")
+	if err != nil {
+		return nil, s.logger.Error(ctx, err)
+	}
+
+	return &daemon.DaemonConfig{
+		Label:       scheduler.DaemonLabel,
+		Description: "Git Bundle Server update scheduler",
+		Program:     programPath,
+		Arguments:   []string{"scheduler", "run"},
+	}, nil
+}
+
+func (s *schedulerCmd) enabledFile(ctx context.Context) (string, error) {
+	userProvider := utils.GetDependency[common.UserProvider](ctx, s.container)
+	user, err := userProvider.CurrentUser()
+	if err != nil {
+		return "", s.logger.Errorf(ctx, "failed to get current user: %w", err)
+	}
+
+	return filepath.Join(core.SchedulerDir(user), scheduler.EnabledFilename), nil
+}
+
+func (s *schedulerCmd) startScheduler(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(s.logger, "git-bundle-server scheduler start [-f|--force] [<daemon-options>]")
+	force := parser.Bool("force", false, "Force reconfiguration of the scheduler daemon")
+	parser.BoolVar(force, "f", false, "Alias of --force")
+	daemonFlags, validateDaemon, applyDaemon := utils.DaemonFlags(parser)
+	daemonFlags.VisitAll(func(f *flag.Flag) {
+		parser.Var(f.Value, f.Name, fmt.Sprintf("[Daemon] %s", f.Usage))
+	})
+	parser.Parse(ctx, args)
+	validateDaemon(ctx)
+
+	d := utils.GetDependency[daemon.DaemonProvider](ctx, s.container)
+	fileSystem := utils.GetDependency[common.FileSystem](ctx, s.container)
+
+	config, err := s.getDaemonConfig(ctx)
+	if err != nil {
+		return err
+	}
+	err = applyDaemon(config)
+	if err != nil {
+		return s.logger.Error(ctx, err)
+	}
+
+	// Mark the scheduler as enabled so that 'init' and 'start' no longer add a
+	// cron job
+	enabledFile, err := s.enabledFile(ctx)
+	if err != nil {
+		return err
+	}
+	err = fileSystem.WriteFile(enabledFile, []byte{})
+	if err != nil {
+		return s.logger.Errorf(ctx, "failed to enable scheduler: %w", err)
+	}
+
+	err = d.Create(ctx, config, *force)
+	if err != nil {
+		return s.logger.Error(ctx, err)
+	}
+
+	err = d.Start(ctx, config.Label)
+	if err != nil {
+		return s.logger.Error(ctx, err)
+	}
+
+	// The scheduler replaces the cron job
+	cron := utils.GetDependency[utils.CronHelper](ctx, s.container)
+	return cron.RemoveCronSchedule(ctx)
+}
+
+func (s *schedulerCmd) stopScheduler(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(s.logger, "git-bundle-server scheduler stop [--remove]")
+	remove := parser.Bool("remove", false, "Remove the scheduler daemon configuration from the system after stopping")
+	parser.Parse(ctx, args)
+
+	d := utils.GetDependency[daemon.DaemonProvider](ctx, s.container)
+	fileSystem := utils.GetDependency[common.FileSystem](ctx, s.container)
+
+	err := d.Stop(ctx, scheduler.DaemonLabel)
+	if err != nil {
+		return s.logger.Error(ctx, err)
+	}
+
+	if *remove {
+		err = d.Remove(ctx, scheduler.DaemonLabel)
+		if err != nil {
+			return s.logger.Error(ctx, err)
+		}
+
+		enabledFile, err := s.enabledFile(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = fileSystem.DeleteFile(enabledFile)
+		if err != nil {
+			return s.logger.Errorf(ctx, "failed to disable scheduler: %w", err)
+		}
+
+		// Hand updates back to cron, if there's anything to update
+		repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, s.container)
+		repos, err := repoProvider.GetRepositories(ctx)
+		if err != nil {
+			return s.logger.Error(ctx, err)
+		}
+		if len(repos) > 0 {
+			cron := utils.GetDependency[utils.CronHelper](ctx, s.container)
+			return cron.SetCronSchedule(ctx)
+		}
+	}
+
+	return nil
+}
+
+func (s *schedulerCmd) runScheduler(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(s.logger, "git-bundle-server scheduler run [--tick <duration>]")
+	tick := parser.Duration("tick", time.Minute, "How often to check for routes that are due for an update")
+	parser.Parse(ctx, args)
+
+	if *tick <= 0 {
+		parser.Usage(ctx, "Invalid tick '%s'.", *tick)
+	}
+
+	sched := utils.GetDependency[scheduler.Scheduler](ctx, s.container)
+
+	// Finish the current update (if any) and exit when interrupted
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Printf("Scheduler is running, checking for due updates every %s\n", *tick)
+	err := sched.Run(ctx, *tick)
+	if err != nil {
+		return s.logger.Error(ctx, err)
+	}
+
+	fmt.Println("Scheduler stopped")
+	return nil
+}
+
+func (s *schedulerCmd) showHistory(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(s.logger, "git-bundle-server scheduler history [--limit <n>] [<route>]")
+	limit := parser.Int("limit", 20, "The maximum number of runs to show")
+	route := parser.PositionalString("route", "show only the runs of this route", false)
+	parser.Parse(ctx, args)
+
+	history := utils.GetDependency[scheduler.RunHistory](ctx, s.container)
+
+	records, err := history.Read(ctx)
+	if err != nil {
+		return s.logger.Error(ctx, err)
+	}
+
+	// Show the most recent runs first
+	shown := 0
+	for i := len(records) - 1; i >= 0 && shown < *limit; i-- {
+		record := records[i]
+		if *route != "" && record.Route != *route {
+			continue
+		}
+
+		status := "ok"
+		if !record.Succeeded() {
+			status = "FAILED: " + record.Error
+		}
+		fmt.Printf("%s %s (%s) %s\n",
+			record.Start.Local().Format(time.RFC3339),
+			record.Route,
+			record.Duration.Round(time.Second),
+			status)
+		shown++
+	}
+
+	return nil
+}
+
+func (s *schedulerCmd) Run(ctx context.Context, args []string) error {
+	parser := argparse.NewArgParser(s.logger, "git-bundle-server scheduler (start|stop|run|history) <options>")
+	parser.Subcommand(argparse.NewSubcommand("start", "Install and start the scheduler daemon", s.startScheduler))
+	parser.Subcommand(argparse.NewSubcommand("stop", "Stop the scheduler daemon", s.stopScheduler))
+	parser.Subcommand(argparse.NewSubcommand("run", "Run the scheduler in the foreground", s.runScheduler))
+	parser.Subcommand(argparse.NewSubcommand("history", "Show the most recent scheduled updates", s.showHistory))
+	parser.Parse(ctx, args)
+
+	return parser.InvokeSubcommand(ctx)
+}
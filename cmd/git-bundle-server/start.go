@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"os"
 
 	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
@@ -33,9 +34,25 @@ specified '<route>'.`
 }
 
 func (s *startCmd) Run(ctx context.Context, args []string) error {
-	parser := argparse.NewArgParser(s.logger, "git-bundle-server start <route>")
+	parser := argparse.NewArgParser(s.logger, "git-bundle-server start [--fetch|--no-fetch] [<schedule-options>] [<credential-options>] <route>")
+	fetch := parser.Bool("fetch", false, "fetch from the route's remote before each update")
+	noFetch := parser.Bool("no-fetch", false, "never fetch from the route's remote; bundle only content pushed into the repository")
 	route := parser.PositionalString("route", "the route for which bundles should be generated", true)
+	scheduleFlags, validateSchedule, applySchedule := utils.RouteScheduleFlags(parser)
+	scheduleFlags.VisitAll(func(f *flag.Flag) {
+		parser.Var(f.Value, f.Name, f.Usage)
+	})
+	credentialFlags, validateCredentials, applyCredentials := utils.RouteCredentialFlags(parser)
+	credentialFlags.VisitAll(func(f *flag.Flag) {
+		parser.Var(f.Value, f.Name, f.Usage)
+	})
 	parser.Parse(ctx, args)
+	validateSchedule(ctx)
+	validateCredentials(ctx)
+
+	if *fetch && *noFetch {
+		parser.Usage(ctx, "'--fetch' and '--no-fetch' cannot be used together")
+	}
 
 	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, s.container)
 
@@ -50,6 +67,25 @@ func (s *startCmd) Run(ctx context.Context, args []string) error {
 		return s.logger.Errorf(ctx, "route '%s' appears to have been deleted; use 'init' instead", *route)
 	}
 
+	config, err := repoProvider.ReadRouteConfig(ctx, repo)
+	if err != nil {
+		return s.logger.Errorf(ctx, "failed to load route config: %w", err)
+	}
+
+	changed := applySchedule(config)
+	changed = applyCredentials(config) || changed
+	if *fetch || *noFetch {
+		config.NoFetch = *noFetch
+		changed = true
+	}
+
+	if changed {
+		err = repoProvider.WriteRouteConfig(ctx, repo, config)
+		if err != nil {
+			return s.logger.Errorf(ctx, "failed to write route config: %w", err)
+		}
+	}
+
 	// Make sure we have the global schedule running.
 	cron := utils.GetDependency[utils.CronHelper](ctx, s.container)
 	cron.SetCronSchedule(ctx)
@@ -43,5 +43,24 @@ func (s *stopCmd) Run(ctx context.Context, args []string) error {
 		s.logger.Error(ctx, err)
 	}
 
+	// Stop the global schedule if there are no routes left to update
+	return removeScheduleIfUnused(ctx, s.logger, s.container)
+}
+
+// removeScheduleIfUnused removes the cron job running 'update-all' if no routes
+// are active.
+func removeScheduleIfUnused(ctx context.Context, logger log.TraceLogger, container *utils.DependencyContainer) error {
+	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, container)
+	cron := utils.GetDependency[utils.CronHelper](ctx, container)
+
+	repos, err := repoProvider.GetRepositories(ctx)
+	if err != nil {
+		return logger.Error(ctx, err)
+	}
+
+	if len(repos) == 0 {
+		return cron.RemoveCronSchedule(ctx)
+	}
+
 	return nil
 }
@@ -2,14 +2,14 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
 	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
-	"github.com/git-ecosystem/git-bundle-server/internal/cmd"
-	"github.com/git-ecosystem/git-bundle-server/internal/common"
-	"github.com/git-ecosystem/git-bundle-server/internal/core"
 	"github.com/git-ecosystem/git-bundle-server/internal/log"
+	"github.com/git-ecosystem/git-bundle-server/internal/scheduler"
 )
 
 type updateAllCmd struct {
@@ -30,41 +30,48 @@ func (updateAllCmd) Name() string {
 
 func (updateAllCmd) Description() string {
 	return `
-For every configured route, run 'git-bundle-server update <options> <route>'.`
+For every configured route that is due for an update according to its update
+schedule, run 'git-bundle-server update <options> <route>'. A route that fails
+to update doesn't prevent updating the others; the command fails once all
+routes have been attempted.`
 }
 
 func (u *updateAllCmd) Run(ctx context.Context, args []string) error {
-	parser := argparse.NewArgParser(u.logger, "git-bundle-server update-all")
+	parser := argparse.NewArgParser(u.logger, "git-bundle-server update-all [--all] [--no-fetch]")
+	all := parser.Bool("all", false, "update every route, regardless of whether it is due")
+	noFetch := parser.Bool("no-fetch", false, "create bundles from the current content of each repository without fetching")
 	parser.Parse(ctx, args)
 
-	repoProvider := utils.GetDependency[core.RepositoryProvider](ctx, u.container)
-	fileSystem := utils.GetDependency[common.FileSystem](ctx, u.container)
-	commandExecutor := utils.GetDependency[cmd.CommandExecutor](ctx, u.container)
+	sched := utils.GetDependency[scheduler.Scheduler](ctx, u.container)
 
-	repos, err := repoProvider.GetRepositories(ctx)
-	if err != nil {
-		return u.logger.Error(ctx, err)
+	// Options passed through to 'git-bundle-server update'
+	subargs := []string{}
+	if *noFetch {
+		subargs = append(subargs, "--no-fetch")
 	}
 
-	exe, err := fileSystem.GetLocalExecutable("git-bundle-server")
+	now := time.Now()
+	routes, err := sched.SelectRoutes(ctx, now, !*all)
 	if err != nil {
-		return u.logger.Errorf(ctx, "failed to get path to execuable: %w", err)
+		return u.logger.Error(ctx, err)
 	}
 
-	subargs := []string{"update", ""}
-	subargs = append(subargs, args...)
-
-	for route := range repos {
-		subargs[1] = route
-		fmt.Printf("*** Updating %s ***\n", route)
-		exitCode, err := commandExecutor.RunStdout(ctx, exe, subargs...)
+	// Don't let one broken route prevent updating the others
+	failures := []error{}
+	for _, route := range routes {
+		record, err := sched.UpdateRoute(ctx, route, now, subargs)
 		if err != nil {
-			return u.logger.Error(ctx, err)
-		} else if exitCode != 0 {
-			return u.logger.Errorf(ctx, "git-bundle-server update exited with status %d", exitCode)
+			failures = append(failures, err)
+		} else if !record.Succeeded() {
+			failures = append(failures, fmt.Errorf("%s: %s", route, record.Error))
 		}
 		fmt.Print("\n")
 	}
 
+	if len(failures) > 0 {
+		return u.logger.Errorf(ctx, "failed to update %d of %d routes:\n%w",
+			len(failures), len(routes), errors.Join(failures...))
+	}
+
 	return nil
 }
@@ -31,11 +31,13 @@ func (updateCmd) Description() string {
 	return `
 For the repository in the current directory (or the one specified by
 '<route>'), fetch the latest content from the remote, create a new set of
-bundles, and update the bundle list.`
+bundles, and update the bundle list. With '--no-fetch' (or if the route was
+configured with '--no-fetch'), the remote is not contacted.`
 }
 
 func (u *updateCmd) Run(ctx context.Context, args []string) error {
-	parser := argparse.NewArgParser(u.logger, "git-bundle-server update <route>")
+	parser := argparse.NewArgParser(u.logger, "git-bundle-server update [--no-fetch] <route>")
+	noFetch := parser.Bool("no-fetch", false, "create bundles from the current content of the repository without fetching")
 	route := parser.PositionalString("route", "the route to update", true)
 	parser.Parse(ctx, args)
 
@@ -52,8 +54,12 @@ func (u *updateCmd) Run(ctx context.Context, args []string) error {
 		return u.logger.Errorf(ctx, "failed to load bundle list: %w", err)
 	}
 
-	fmt.Printf("Checking for updates to %s\n", repo.Route)
-	bundle, err := bundleProvider.CreateIncrementalBundle(ctx, repo, list)
+	config, err := repoProvider.ReadRouteConfig(ctx, repo)
+	if err != nil {
+		return u.logger.Errorf(ctx, "failed to load route config: %w", err)
+	}
+
+	bundle, err := createIncrementalBundle(ctx, bundleProvider, repo, list, config, *noFetch)
 	if err != nil {
 		return u.logger.Error(ctx, err)
 	}
@@ -61,23 +67,53 @@ func (u *updateCmd) Run(ctx context.Context, args []string) error {
 	// Nothing new!
 	if bundle == nil {
 		fmt.Printf("%s is up-to-date, no new bundles generated\n", repo.Route)
-		return nil
-	}
-
-	list.Bundles[bundle.CreationToken] = *bundle
-
-	fmt.Println("Updating bundle list")
-	err = bundleProvider.CollapseList(ctx, repo, list)
-	if err != nil {
-		return u.logger.Error(ctx, err)
+	} else {
+		list.Bundles[bundle.CreationToken] = *bundle
+
+		fmt.Println("Updating bundle list")
+		err = bundleProvider.CollapseList(ctx, repo, list)
+		if err != nil {
+			return u.logger.Error(ctx, err)
+		}
+
+		fmt.Println("Writing updated bundle list")
+		listErr := bundleProvider.WriteBundleList(ctx, list, repo)
+		if listErr != nil {
+			return u.logger.Errorf(ctx, "failed to write bundle list: %w", listErr)
+		}
 	}
 
-	fmt.Println("Writing updated bundle list")
-	listErr := bundleProvider.WriteBundleList(ctx, list, repo)
-	if listErr != nil {
-		return u.logger.Errorf(ctx, "failed to write bundle list: %w", listErr)
+	// Update the filtered bundle sets, if any. These are created even if the
+	// full bundle list is up-to-date, so that a filter added since the last
+	// update gets its initial bundle.
+	for _, filter := range config.Filters {
+		fmt.Printf("Updating '%s' filtered bundle list\n", filter)
+		err = bundleProvider.UpdateFilteredList(ctx, repo, filter)
+		if err != nil {
+			return u.logger.Error(ctx, err)
+		}
 	}
 
 	fmt.Println("Update complete")
 	return nil
 }
+
+// createIncrementalBundle bundles the new content of the repository, fetching
+// it from the remote first unless 'noFetch' is set or the route is configured
+// to never fetch.
+func createIncrementalBundle(
+	ctx context.Context,
+	bundleProvider bundles.BundleProvider,
+	repo *core.Repository,
+	list *bundles.BundleList,
+	config *core.RouteConfig,
+	noFetch bool,
+) (*bundles.Bundle, error) {
+	if noFetch || config.NoFetch {
+		fmt.Printf("Checking for new content in %s\n", repo.Route)
+		return bundleProvider.CreateLocalIncrementalBundle(ctx, repo, list)
+	}
+
+	fmt.Printf("Checking for updates to %s\n", repo.Route)
+	return bundleProvider.CreateIncrementalBundle(ctx, repo, list, config.Credentials)
+}
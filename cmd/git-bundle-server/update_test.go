@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/bundles"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/git"
+	. "github.com/git-ecosystem/git-bundle-server/internal/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var createIncrementalBundleTests = []struct {
+	title string
+
+	noFetch bool
+	config  *core.RouteConfig
+
+	// Expected values
+	expectFetch bool
+}{
+	{
+		"Default route fetches",
+		false,
+		&core.RouteConfig{},
+		true,
+	},
+	{
+		"Credentials are used to fetch",
+		false,
+		&core.RouteConfig{Credentials: &git.RemoteCredentials{CredentialHelper: "store"}},
+		true,
+	},
+	{
+		"--no-fetch doesn't fetch",
+		true,
+		&core.RouteConfig{},
+		false,
+	},
+	{
+		"No-fetch route doesn't fetch",
+		false,
+		&core.RouteConfig{NoFetch: true},
+		false,
+	},
+}
+
+func Test_CreateIncrementalBundle(t *testing.T) {
+	testLogger := &MockTraceLogger{}
+
+	for _, tt := range createIncrementalBundleTests {
+		t.Run(tt.title, func(t *testing.T) {
+			testGitHelper := &MockGitHelper{}
+			bundleProvider := bundles.NewBundleProvider(testLogger, nil, testGitHelper, bundles.DefaultMaxBundles)
+
+			repo := &core.Repository{
+				Route:   "test/repo",
+				RepoDir: t.TempDir(),
+				WebDir:  t.TempDir(),
+			}
+
+			list := bundles.NewBundleList()
+			base := bundles.NewBundle(repo, 1)
+			err := os.WriteFile(base.Filename, []byte(
+				"# v2 git bundle\n"+
+					"1111111111111111111111111111111111111111 refs/heads/main\n"+
+					"\n"), 0o600)
+			assert.Nil(t, err)
+			list.Bundles[base.CreationToken] = base
+
+			if tt.expectFetch {
+				testGitHelper.On("UpdateBareRepo", mock.Anything, repo.RepoDir, tt.config.Credentials).Return(nil).Once()
+			}
+			testGitHelper.On("CreateIncrementalBundle",
+				mock.Anything,
+				repo.RepoDir,
+				mock.AnythingOfType("string"),
+				[]string{"^1111111111111111111111111111111111111111"},
+				"",
+			).Return(true, nil).Once()
+
+			bundle, err := createIncrementalBundle(context.Background(), bundleProvider, repo, list, tt.config, tt.noFetch)
+
+			assert.Nil(t, err)
+			assert.NotNil(t, bundle)
+			testGitHelper.AssertExpectations(t)
+			if !tt.expectFetch {
+				testGitHelper.AssertNotCalled(t, "UpdateBareRepo", mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
@@ -5,9 +5,11 @@ import (
 	"flag"
 	"fmt"
 	"path/filepath"
+	"strings"
 
 	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
 	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
+	"github.com/git-ecosystem/git-bundle-server/internal/cmd"
 	"github.com/git-ecosystem/git-bundle-server/internal/common"
 	"github.com/git-ecosystem/git-bundle-server/internal/daemon"
 	"github.com/git-ecosystem/git-bundle-server/internal/log"
@@ -33,7 +35,11 @@ func (webServerCmd) Description() string {
 	return `Manage the web server hosting bundle content`
 }
 
-func (w *webServerCmd) getDaemonConfig(ctx context.Context) (*daemon.DaemonConfig, error) {
+// The label of the default web server daemon; named instances append their
+// name to it.
+const webServerLabel string = "com.git-ecosystem.gitbundleserver"
+
+func (w *webServerCmd) getDaemonConfig(ctx context.Context, instance string) (*daemon.DaemonConfig, error) {
 	// Find git-bundle-web-server
 	fileSystem := utils.GetDependency[common.FileSystem](ctx, w.container)
 	programPath, err := fileSystem.GetLocalExecutable("git-bundle-web-server")
@@ -41,20 +47,61 @@ func (w *webServerCmd) getDaemonConfig(ctx context.Context) (*daemon.DaemonConfi
 		return nil, w.logger.Error(ctx, err)
 	}
 
-	return &daemon.DaemonConfig{
-		Label:       "com.git-ecosystem.gitbundleserver",
+	config := &daemon.DaemonConfig{
+		Label:       webServerLabel,
 		Description: "Web server hosting Git Bundle Server content",
 		Program:     programPath,
-	}, nil
+	}
+	if instance != "" {
+		// Each instance is a separate daemon, with its own options
+		config.Label = fmt.Sprintf("%s.%s", webServerLabel, instance)
+		config.Description = fmt.Sprintf("%s (instance '%s')", config.Description, instance)
+	}
+
+	return config, nil
+}
+
+// The user as which a system-wide web server runs by default.
+const defaultSystemUser string = "git-bundle"
+
+// daemonProvider returns the provider managing the web server daemon: the
+// system's daemon manager if 'system' is true, the current user's otherwise.
+func (w *webServerCmd) daemonProvider(ctx context.Context, system bool) daemon.DaemonProvider {
+	if !system {
+		return utils.GetDependency[daemon.DaemonProvider](ctx, w.container)
+	}
+
+	d, err := daemon.NewSystemDaemonProvider(
+		w.logger,
+		utils.GetDependency[common.UserProvider](ctx, w.container),
+		utils.GetDependency[cmd.CommandExecutor](ctx, w.container),
+		utils.GetDependency[common.FileSystem](ctx, w.container),
+	)
+	if err != nil {
+		w.logger.Fatal(ctx, err)
+	}
+	return d
 }
 
 func (w *webServerCmd) startServer(ctx context.Context, args []string) error {
 	// Parse subcommand arguments
-	parser := argparse.NewArgParser(w.logger, "git-bundle-server web-server start [-f|--force]")
+	parser := argparse.NewArgParser(w.logger, "git-bundle-server web-server start [-f|--force] "+
+		"[--instance <name>] [--system [--daemon-user <user>] [--daemon-group <group>]]")
 
 	// Args for 'git-bundle-server web-server start'
 	force := parser.Bool("force", false, "Force reconfiguration of the web server daemon")
 	parser.BoolVar(force, "f", false, "Alias of --force")
+	instanceFlags, getInstance := utils.InstanceFlag(parser)
+	instanceFlags.VisitAll(func(f *flag.Flag) { parser.Var(f.Value, f.Name, f.Usage) })
+	system := parser.Bool("system", false, "Run the web server as a system daemon, started at boot (requires root)")
+	daemonUser := parser.String("daemon-user", defaultSystemUser, "The user as which the system daemon runs")
+	daemonGroup := parser.String("daemon-group", "", "The group as which the system daemon runs (default: the user's primary group)")
+
+	// Args configuring the daemon process
+	daemonFlags, validateDaemon, applyDaemon := utils.DaemonFlags(parser)
+	daemonFlags.VisitAll(func(f *flag.Flag) {
+		parser.Var(f.Value, f.Name, fmt.Sprintf("[Daemon] %s", f.Usage))
+	})
 
 	// Arguments passed through to 'git-bundle-web-server'
 	webServerFlags, validate := utils.WebServerFlags(parser)
@@ -64,24 +111,50 @@ func (w *webServerCmd) startServer(ctx context.Context, args []string) error {
 
 	parser.Parse(ctx, args)
 	validate(ctx)
+	validateDaemon(ctx)
+	instance := getInstance(ctx)
 
-	d := utils.GetDependency[daemon.DaemonProvider](ctx, w.container)
+	isSet := map[string]bool{}
+	parser.Visit(func(f *flag.Flag) { isSet[f.Name] = true })
+	if !*system && (isSet["daemon-user"] || isSet["daemon-group"]) {
+		parser.Usage(ctx, "--daemon-user and --daemon-group require --system")
+	}
 
-	config, err := w.getDaemonConfig(ctx)
+	d := w.daemonProvider(ctx, *system)
+
+	config, err := w.getDaemonConfig(ctx, instance)
 	if err != nil {
 		return w.logger.Error(ctx, err)
 	}
 
+	err = applyDaemon(config)
+	if err != nil {
+		return w.logger.Error(ctx, err)
+	}
+
+	if *system {
+		// The web server serves the bundles of the daemon user, so that user
+		// must exist (and own the routes)
+		userProvider := utils.GetDependency[common.UserProvider](ctx, w.container)
+		_, err = userProvider.LookupUser(*daemonUser)
+		if err != nil {
+			return w.logger.Errorf(ctx, "invalid daemon user '%s' (create it, or choose "+
+				"another with '--daemon-user'): %w", *daemonUser, err)
+		}
+		config.User = *daemonUser
+		config.Group = *daemonGroup
+	}
+
 	// Configure flags
+	if instance != "" {
+		// The instance reads its own settings from the server config
+		config.Arguments = append(config.Arguments, "--instance", instance)
+	}
 	loopErr := error(nil)
 	parser.Visit(func(f *flag.Flag) {
 		if webServerFlags.Lookup(f.Name) != nil {
 			value := f.Value.String()
-			if f.Name == "cert" ||
-				f.Name == "key" ||
-				f.Name == "client-ca" ||
-				f.Name == "auth-config" {
-
+			if utils.WebServerPathFlags[f.Name] {
 				// Need the absolute value of the path
 				value, err = filepath.Abs(value)
 				if err != nil {
@@ -95,7 +168,12 @@ func (w *webServerCmd) startServer(ctx context.Context, args []string) error {
 					return
 				}
 			}
-			config.Arguments = append(config.Arguments, fmt.Sprintf("--%s", f.Name), value)
+			if boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && boolFlag.IsBoolFlag() {
+				// Boolean flags don't take a separate value
+				config.Arguments = append(config.Arguments, fmt.Sprintf("--%s=%s", f.Name, value))
+			} else {
+				config.Arguments = append(config.Arguments, fmt.Sprintf("--%s", f.Name), value)
+			}
 		}
 	})
 	if loopErr != nil {
@@ -118,13 +196,16 @@ func (w *webServerCmd) startServer(ctx context.Context, args []string) error {
 
 func (w *webServerCmd) stopServer(ctx context.Context, args []string) error {
 	// Parse subcommand arguments
-	parser := argparse.NewArgParser(w.logger, "git-bundle-server web-server stop [--remove]")
+	parser := argparse.NewArgParser(w.logger, "git-bundle-server web-server stop [--instance <name>] [--system] [--remove]")
+	instanceFlags, getInstance := utils.InstanceFlag(parser)
+	instanceFlags.VisitAll(func(f *flag.Flag) { parser.Var(f.Value, f.Name, f.Usage) })
+	system := parser.Bool("system", false, "Stop the system web server daemon (requires root)")
 	remove := parser.Bool("remove", false, "Remove the web server daemon configuration from the system after stopping")
 	parser.Parse(ctx, args)
 
-	d := utils.GetDependency[daemon.DaemonProvider](ctx, w.container)
+	d := w.daemonProvider(ctx, *system)
 
-	config, err := w.getDaemonConfig(ctx)
+	config, err := w.getDaemonConfig(ctx, getInstance(ctx))
 	if err != nil {
 		return w.logger.Error(ctx, err)
 	}
@@ -144,11 +225,110 @@ func (w *webServerCmd) stopServer(ctx context.Context, args []string) error {
 	return nil
 }
 
+func yesNo(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
+
+func (w *webServerCmd) serverStatus(ctx context.Context, args []string) error {
+	// Parse subcommand arguments
+	parser := argparse.NewArgParser(w.logger, "git-bundle-server web-server status [--instance <name>] [--system]")
+	instanceFlags, getInstance := utils.InstanceFlag(parser)
+	instanceFlags.VisitAll(func(f *flag.Flag) { parser.Var(f.Value, f.Name, f.Usage) })
+	system := parser.Bool("system", false, "Show the status of the system web server daemon")
+	parser.Parse(ctx, args)
+
+	d := w.daemonProvider(ctx, *system)
+
+	config, err := w.getDaemonConfig(ctx, getInstance(ctx))
+	if err != nil {
+		return w.logger.Error(ctx, err)
+	}
+
+	status, err := d.Status(ctx, config.Label)
+	if err != nil {
+		return w.logger.Error(ctx, err)
+	}
+
+	if status.ConfigFile == "" {
+		fmt.Println("Configured: no (run 'git-bundle-server web-server start')")
+	} else {
+		fmt.Printf("Configured: yes (%s)\n", status.ConfigFile)
+	}
+	fmt.Printf("Loaded: %s\n", yesNo(status.Loaded))
+	if status.Running {
+		fmt.Printf("Running: yes (PID %d)\n", status.PID)
+	} else {
+		fmt.Println("Running: no")
+	}
+	if status.LastExitCode != nil {
+		fmt.Printf("Last exit code: %d\n", *status.LastExitCode)
+	}
+
+	if status.Config != nil {
+		fmt.Printf("Program: %s\n", status.Config.Program)
+		fmt.Printf("Options: %s\n", strings.Join(status.Config.Arguments, " "))
+
+		for _, output := range []struct {
+			name string
+			path string
+		}{
+			{"Output", status.Config.StdOutPath},
+			{"Errors", status.Config.StdErrPath},
+		} {
+			if output.path == "" {
+				// Only systemd units have no output file, in which case the
+				// output goes to the journal
+				output.path = "(journal)"
+			}
+			fmt.Printf("%s: %s\n", output.name, output.path)
+		}
+	}
+
+	return nil
+}
+
+func (w *webServerCmd) serverLogs(ctx context.Context, args []string) error {
+	// Parse subcommand arguments
+	parser := argparse.NewArgParser(w.logger, "git-bundle-server web-server logs [--instance <name>] [--system] "+
+		"[-n|--lines <n>] [-f|--follow]")
+	instanceFlags, getInstance := utils.InstanceFlag(parser)
+	instanceFlags.VisitAll(func(f *flag.Flag) { parser.Var(f.Value, f.Name, f.Usage) })
+	system := parser.Bool("system", false, "Show the output of the system web server daemon")
+	lines := parser.Int("lines", 50, "The number of lines of output to show")
+	parser.IntVar(lines, "n", 50, "Alias of --lines")
+	follow := parser.Bool("follow", false, "Keep printing new output until interrupted")
+	parser.BoolVar(follow, "f", false, "Alias of --follow")
+	parser.Parse(ctx, args)
+
+	if *lines < 0 {
+		parser.Usage(ctx, "Invalid number of lines '%d'.", *lines)
+	}
+
+	d := w.daemonProvider(ctx, *system)
+
+	config, err := w.getDaemonConfig(ctx, getInstance(ctx))
+	if err != nil {
+		return w.logger.Error(ctx, err)
+	}
+
+	err = d.Logs(ctx, config.Label, *lines, *follow)
+	if err != nil {
+		return w.logger.Error(ctx, err)
+	}
+
+	return nil
+}
+
 func (w *webServerCmd) Run(ctx context.Context, args []string) error {
 	// Parse command arguments
-	parser := argparse.NewArgParser(w.logger, "git-bundle-server web-server (start|stop) <options>")
+	parser := argparse.NewArgParser(w.logger, "git-bundle-server web-server (start|stop|status|logs) <options>")
 	parser.Subcommand(argparse.NewSubcommand("start", "Start the web server", w.startServer))
 	parser.Subcommand(argparse.NewSubcommand("stop", "Stop the web server", w.stopServer))
+	parser.Subcommand(argparse.NewSubcommand("status", "Show the state and configuration of the web server", w.serverStatus))
+	parser.Subcommand(argparse.NewSubcommand("logs", "Show the output of the web server", w.serverLogs))
 	parser.Parse(ctx, args)
 
 	return parser.InvokeSubcommand(ctx)
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	auth_internal "github.com/git-ecosystem/git-bundle-server/internal/auth"
+	"github.com/git-ecosystem/git-bundle-server/pkg/auth"
+)
+
+// The maximum number of auth decisions cached by the web server.
+const maxCachedAuthDecisions = 10000
+
+// The request properties an auth decision is cached for: the route and the
+// credentials of the client. The auth middleware must not decide on anything
+// else (e.g. the path or the query of the request), so that the requests of a
+// fetch (the bundle list, then the bundles) share a decision.
+type authCacheKey struct {
+	Owner         string            `json:"owner"`
+	Repo          string            `json:"repo"`
+	Authorization []string          `json:"authorization"`
+	ClientCert    []byte            `json:"clientCert"`
+	RemoteHost    string            `json:"remoteHost"`
+	Headers       map[string]string `json:"headers"`
+}
+
+// authCache caches the decisions of an auth middleware, so that the requests a
+// client makes for a route in quick succession (e.g. for the bundle list and
+// each of the bundles of a fetch) are authorized once.
+type authCache struct {
+	authorize authFunc
+	decisions *auth_internal.DecisionCache
+
+	// Headers other than 'Authorization' the middleware decides on
+	headers []string
+}
+
+func newAuthCache(authorize authFunc, ttl time.Duration, headers []string) *authCache {
+	return &authCache{
+		authorize: authorize,
+		decisions: auth_internal.NewDecisionCache(ttl, maxCachedAuthDecisions),
+		headers:   headers,
+	}
+}
+
+func (c *authCache) cacheKey(r *http.Request, owner string, repo string) [sha256.Size]byte {
+	key := authCacheKey{
+		Owner:         owner,
+		Repo:          repo,
+		Authorization: r.Header.Values("Authorization"),
+		RemoteHost:    r.RemoteAddr,
+		Headers:       map[string]string{},
+	}
+	if cert := auth.VerifiedClientCertificate(r); cert != nil {
+		key.ClientCert = cert.Raw
+	}
+	// Drop the port, which changes with each connection
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		key.RemoteHost = host
+	}
+	for _, header := range c.headers {
+		key.Headers[header] = strings.Join(r.Header.Values(header), ",")
+	}
+
+	// Maps are encoded with sorted keys, so equal properties have equal
+	// encodings
+	keyBytes, _ := json.Marshal(key)
+	return sha256.Sum256(keyBytes)
+}
+
+// Authorize returns the cached decision for the request, calling the auth
+// middleware if there is none or it expired.
+func (c *authCache) Authorize(r *http.Request, owner string, repo string) auth.AuthResult {
+	key := c.cacheKey(r, owner, repo)
+	if result, found := c.decisions.Get(key); found {
+		return result
+	}
+
+	result := c.authorize(r, owner, repo)
+	c.decisions.Add(key, result)
+	return result
+}
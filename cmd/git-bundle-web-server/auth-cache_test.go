@@ -0,0 +1,196 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/pkg/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingAuthorizer allows requests with the 'Authorization' header
+// 'Bearer good', counting its calls.
+type countingAuthorizer struct {
+	calls int
+}
+
+func (a *countingAuthorizer) authorize(r *http.Request, owner string, repo string) auth.AuthResult {
+	a.calls++
+	if r.Header.Get("Authorization") == "Bearer good" {
+		return auth.Allow()
+	}
+	return auth.Deny(404)
+}
+
+func newCacheTestRequest(target string, headers map[string]string) *http.Request {
+	r := httptest.NewRequest("GET", target, nil)
+	r.RemoteAddr = "192.0.2.1:50000"
+	for key, value := range headers {
+		r.Header.Set(key, value)
+	}
+	return r
+}
+
+// withClientCert sets the verified client certificate of a request.
+func withClientCert(r *http.Request, raw string) *http.Request {
+	cert := &x509.Certificate{Raw: []byte(raw)}
+	r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	return r
+}
+
+var goodCredentials = map[string]string{"Authorization": "Bearer good"}
+
+var authCacheTests = []struct {
+	title string
+
+	headers []string
+	first   *http.Request
+	second  *http.Request
+
+	expectedSecondStatus int
+	expectedCalls        int
+}{
+	{
+		"Identical requests share a decision",
+		nil,
+		newCacheTestRequest("/org/repo", goodCredentials),
+		newCacheTestRequest("/org/repo", goodCredentials),
+		200,
+		1,
+	},
+	{
+		"Requests for the bundle list and a bundle share a decision",
+		nil,
+		newCacheTestRequest("/org/repo", goodCredentials),
+		newCacheTestRequest("/org/repo/bundle-1700000000.bundle", goodCredentials),
+		200,
+		1,
+	},
+	{
+		"Requests with other headers and queries share a decision",
+		nil,
+		newCacheTestRequest("/org/repo", goodCredentials),
+		newCacheTestRequest("/org/repo?x=y", map[string]string{
+			"Authorization": "Bearer good",
+			"User-Agent":    "git/2.41.0",
+		}),
+		200,
+		1,
+	},
+	{
+		"Connections from another port share a decision",
+		nil,
+		newCacheTestRequest("/org/repo", goodCredentials),
+		func() *http.Request {
+			r := newCacheTestRequest("/org/repo", goodCredentials)
+			r.RemoteAddr = "192.0.2.1:50001"
+			return r
+		}(),
+		200,
+		1,
+	},
+	{
+		"Clients with other credentials don't share a decision",
+		nil,
+		newCacheTestRequest("/org/repo", goodCredentials),
+		newCacheTestRequest("/org/repo", map[string]string{"Authorization": "Bearer bad"}),
+		404,
+		2,
+	},
+	{
+		"Clients without credentials don't share a decision",
+		nil,
+		newCacheTestRequest("/org/repo", goodCredentials),
+		newCacheTestRequest("/org/repo", nil),
+		404,
+		2,
+	},
+	{
+		"Clients with another certificate don't share a decision",
+		nil,
+		withClientCert(newCacheTestRequest("/org/repo", goodCredentials), "cert-1"),
+		withClientCert(newCacheTestRequest("/org/repo", goodCredentials), "cert-2"),
+		200,
+		2,
+	},
+	{
+		"Clients from another host don't share a decision",
+		nil,
+		newCacheTestRequest("/org/repo", goodCredentials),
+		func() *http.Request {
+			r := newCacheTestRequest("/org/repo", goodCredentials)
+			r.RemoteAddr = "192.0.2.2:50000"
+			return r
+		}(),
+		200,
+		2,
+	},
+	{
+		"Clients differing in a header the middleware decides on don't share a decision",
+		[]string{"X-Forwarded-For"},
+		newCacheTestRequest("/org/repo", map[string]string{
+			"Authorization":   "Bearer good",
+			"X-Forwarded-For": "198.51.100.1",
+		}),
+		newCacheTestRequest("/org/repo", map[string]string{
+			"Authorization":   "Bearer good",
+			"X-Forwarded-For": "198.51.100.2",
+		}),
+		200,
+		2,
+	},
+}
+
+func Test_AuthCache(t *testing.T) {
+	for _, tt := range authCacheTests {
+		t.Run(tt.title, func(t *testing.T) {
+			authorizer := &countingAuthorizer{}
+			cache := newAuthCache(authorizer.authorize, time.Minute, tt.headers)
+
+			cache.Authorize(tt.first, "org", "repo")
+			result := cache.Authorize(tt.second, "org", "repo")
+
+			assert.Equal(t, tt.expectedSecondStatus, result.Status())
+			assert.Equal(t, tt.expectedCalls, authorizer.calls)
+		})
+	}
+}
+
+func Test_AuthCache_Routes(t *testing.T) {
+	authorizer := &countingAuthorizer{}
+	cache := newAuthCache(authorizer.authorize, time.Minute, nil)
+
+	cache.Authorize(newCacheTestRequest("/org/repo", goodCredentials), "org", "repo")
+	cache.Authorize(newCacheTestRequest("/org/other", goodCredentials), "org", "other")
+
+	assert.Equal(t, 2, authorizer.calls)
+}
+
+func Test_AuthCache_Failures(t *testing.T) {
+	calls := 0
+	cache := newAuthCache(func(r *http.Request, owner string, repo string) auth.AuthResult {
+		calls++
+		return auth.AuthResult{}
+	}, time.Minute, nil)
+
+	for i := 0; i < 2; i++ {
+		result := cache.Authorize(newCacheTestRequest("/org/repo", nil), "org", "repo")
+		assert.Equal(t, 500, result.Status())
+	}
+	assert.Equal(t, 2, calls)
+}
+
+func Test_AuthCache_Expiry(t *testing.T) {
+	authorizer := &countingAuthorizer{}
+	cache := newAuthCache(authorizer.authorize, 10*time.Millisecond, nil)
+
+	cache.Authorize(newCacheTestRequest("/org/repo", nil), "org", "repo")
+	time.Sleep(20 * time.Millisecond)
+	cache.Authorize(newCacheTestRequest("/org/repo", nil), "org", "repo")
+
+	assert.Equal(t, 2, authorizer.calls)
+}
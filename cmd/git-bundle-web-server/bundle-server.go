@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"crypto/x509"
@@ -30,24 +31,37 @@ type bundleWebServer struct {
 	serverWaitGroup    *sync.WaitGroup
 	listenAndServeFunc func() error
 	authorize          authFunc
+	baseUrl            string
+	webhook            *webhookReceiver
 }
 
 func NewBundleWebServer(logger log.TraceLogger,
 	port string,
 	certFile string, keyFile string,
 	tlsMinVersion uint16,
-	clientCAFile string,
+	clientCAFile string, clientCertOptional bool, clientCRLFile string,
+	baseUrl string,
+	webhookSecretFile string, webhookDebounce time.Duration,
 	middlewareAuthorize authFunc,
 ) (*bundleWebServer, error) {
 	bundleServer := &bundleWebServer{
 		logger:          logger,
 		serverWaitGroup: &sync.WaitGroup{},
 		authorize:       middlewareAuthorize,
+		baseUrl:         baseUrl,
 	}
 
 	// Configure the http.Server
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", bundleServer.serve)
+	if webhookSecretFile != "" {
+		webhook, err := NewWebhookReceiver(logger, webhookSecretFile, webhookDebounce)
+		if err != nil {
+			return nil, err
+		}
+		bundleServer.webhook = webhook
+		mux.HandleFunc(webhookPath, webhook.serve)
+	}
 	bundleServer.server = &http.Server{
 		Handler: mux,
 		Addr:    ":" + port,
@@ -74,12 +88,37 @@ func NewBundleWebServer(logger log.TraceLogger,
 		certPool := x509.NewCertPool()
 		certPool.AppendCertsFromPEM(caBytes)
 		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		if clientCertOptional {
+			// Clients without a certificate are left to the auth middleware
+			tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		}
 		tlsConfig.ClientCAs = certPool
+
+		if clientCRLFile != "" {
+			crl, err := NewRevocationList(clientCRLFile, clientCAFile)
+			if err != nil {
+				return nil, err
+			}
+			tlsConfig.VerifyConnection = crl.VerifyConnection
+		}
 	}
 
 	return bundleServer, nil
 }
 
+// describeCaller returns a description of the caller of a request for the
+// access logs, if the auth middleware identified it.
+func describeCaller(ctx context.Context) string {
+	identity := auth.IdentityFromContext(ctx)
+	if identity == nil {
+		return ""
+	} else if identity.Method != "" {
+		return fmt.Sprintf(" to '%s' (%s)", identity.Name, identity.Method)
+	} else {
+		return fmt.Sprintf(" to '%s'", identity.Name)
+	}
+}
+
 func (b *bundleWebServer) serve(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
@@ -101,12 +140,17 @@ func (b *bundleWebServer) serve(w http.ResponseWriter, r *http.Request) {
 		if authResult.ApplyResult(w) {
 			return
 		}
+		if identity := authResult.Identity(); identity != nil {
+			// Make the caller available to the rest of the request handling
+			ctx = auth.ContextWithIdentity(ctx, identity)
+			r = r.WithContext(ctx)
+		}
 	}
 
 	userProvider := common.NewUserProvider()
 	fileSystem := common.NewFileSystem()
 	commandExecutor := cmd.NewCommandExecutor(b.logger)
-	gitHelper := git.NewGitHelper(b.logger, commandExecutor)
+	gitHelper := git.NewGitHelper(b.logger, commandExecutor, git.DefaultRefSelection)
 	repoProvider := core.NewRepositoryProvider(b.logger, userProvider, fileSystem, gitHelper)
 
 	repos, err := repoProvider.GetRepositories(ctx)
@@ -123,6 +167,11 @@ func (b *bundleWebServer) serve(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if filename == bundles.BundleUriFilename {
+		b.serveBundleUri(w, r, gitHelper, fileSystem, &repository)
+		return
+	}
+
 	var fileToServe string
 	if filename == "" {
 		if path[len(path)-1] == '/' {
@@ -150,10 +199,52 @@ func (b *bundleWebServer) serve(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	fmt.Printf("Successfully serving content for %s/%s\n", route, filename)
+	fmt.Printf("Successfully serving content for %s/%s%s\n", route, filename, describeCaller(ctx))
 	http.ServeContent(w, r, filename, time.UnixMicro(0), file)
 }
 
+// serveBundleUri responds with the route's bundle list, formatted as the
+// response to a Git protocol v2 'bundle-uri' command. This allows a Git hosting
+// server to advertise the bundle list on behalf of the route.
+func (b *bundleWebServer) serveBundleUri(w http.ResponseWriter,
+	r *http.Request,
+	gitHelper git.GitHelper,
+	fileSystem common.FileSystem,
+	repository *core.Repository,
+) {
+	ctx := r.Context()
+
+	bundleProvider := bundles.NewBundleProvider(b.logger, fileSystem, gitHelper, bundles.DefaultMaxBundles)
+	list, err := bundleProvider.GetBundleList(ctx, repository)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Printf("Failed to load bundle list: %s\n", err)
+		return
+	}
+
+	baseUrl := b.baseUrl
+	if baseUrl == "" {
+		// No configured public URL, so assume the server is accessed directly
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		baseUrl = scheme + "://" + r.Host
+	}
+
+	var response bytes.Buffer
+	err = bundles.WriteBundleUriPktLines(&response, list, baseUrl)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Printf("Failed to write bundle-uri response: %s\n", err)
+		return
+	}
+
+	fmt.Printf("Successfully serving bundle-uri response for %s%s\n", repository.Route, describeCaller(ctx))
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(response.Bytes())
+}
+
 func (b *bundleWebServer) StartServerAsync(ctx context.Context) {
 	// Add to wait group
 	b.serverWaitGroup.Add(1)
@@ -194,4 +285,9 @@ func (b *bundleWebServer) HandleSignalsAsync(ctx context.Context) {
 
 func (b *bundleWebServer) Wait() {
 	b.serverWaitGroup.Wait()
+
+	if b.webhook != nil {
+		// Let in-progress updates finish, but drop those not yet started
+		b.webhook.queue.Close()
+	}
 }
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// revocationList rejects client certificates revoked by a certificate
+// revocation list (CRL) file, which is reloaded whenever it changes. Once the
+// CRL expires (at its 'NextUpdate' time), all client certificates are rejected
+// until it is replaced, since certificates may have been revoked since.
+type revocationList struct {
+	path       string
+	issuers    []*x509.Certificate
+	crlLock    sync.Mutex
+	modTime    time.Time
+	rawIssuer  []byte
+	revoked    map[string]bool
+	nextUpdate time.Time
+
+	now func() time.Time
+}
+
+func NewRevocationList(crlFile string, clientCAFile string) (*revocationList, error) {
+	caBytes, err := os.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	issuers := []*x509.Certificate{}
+	for block, rest := pem.Decode(caBytes); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse client CA certificate: %w", err)
+		}
+		issuers = append(issuers, cert)
+	}
+
+	crl := &revocationList{
+		path:    crlFile,
+		issuers: issuers,
+		now:     time.Now,
+	}
+	err = crl.load()
+	if err != nil {
+		return nil, fmt.Errorf("could not load CRL: %w", err)
+	}
+
+	return crl, nil
+}
+
+// load reads the CRL file, checking that it is signed by one of the client
+// certificate authorities and has not expired.
+func (c *revocationList) load() error {
+	fileInfo, err := os.Stat(c.path)
+	if err != nil {
+		return err
+	}
+	crlBytes, err := os.ReadFile(c.path)
+	if err != nil {
+		return err
+	}
+
+	// The CRL may be PEM- or DER-encoded
+	if block, _ := pem.Decode(crlBytes); block != nil {
+		if block.Type != "X509 CRL" {
+			return fmt.Errorf("unexpected PEM block type '%s'", block.Type)
+		}
+		crlBytes = block.Bytes
+	}
+
+	list, err := x509.ParseRevocationList(crlBytes)
+	if err != nil {
+		return err
+	}
+
+	signed := false
+	for _, issuer := range c.issuers {
+		if bytes.Equal(issuer.RawSubject, list.RawIssuer) && list.CheckSignatureFrom(issuer) == nil {
+			signed = true
+			break
+		}
+	}
+	if !signed {
+		return fmt.Errorf("CRL is not signed by a client certificate authority")
+	}
+	if !list.NextUpdate.IsZero() && !c.now().Before(list.NextUpdate) {
+		return fmt.Errorf("CRL expired at %s", list.NextUpdate.Format(time.RFC3339))
+	}
+
+	revoked := map[string]bool{}
+	for _, entry := range list.RevokedCertificateEntries {
+		revoked[entry.SerialNumber.String()] = true
+	}
+
+	c.modTime = fileInfo.ModTime()
+	c.rawIssuer = list.RawIssuer
+	c.revoked = revoked
+	c.nextUpdate = list.NextUpdate
+	return nil
+}
+
+// VerifyConnection implements 'tls.Config.VerifyConnection', failing the
+// handshake if a client certificate is revoked or the CRL expired. Unlike
+// 'VerifyPeerCertificate', it is also called when a client resumes a session,
+// so that a certificate revoked since the session was established is rejected.
+// Clients without a certificate (with '--client-cert-optional') are left to the
+// auth middleware. If the CRL file changed but can no longer be loaded, the
+// last valid CRL is kept.
+func (c *revocationList) VerifyConnection(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return nil
+	}
+
+	c.crlLock.Lock()
+	defer c.crlLock.Unlock()
+
+	fileInfo, err := os.Stat(c.path)
+	if err == nil && !fileInfo.ModTime().Equal(c.modTime) {
+		err = c.load()
+		if err != nil {
+			// Don't retry until the file changes again
+			c.modTime = fileInfo.ModTime()
+			fmt.Printf("Failed to reload CRL '%s': %s\n", c.path, err)
+		}
+	}
+
+	if !c.nextUpdate.IsZero() && !c.now().Before(c.nextUpdate) {
+		fmt.Printf("Rejecting client certificate: CRL '%s' expired at %s\n",
+			c.path, c.nextUpdate.Format(time.RFC3339))
+		return fmt.Errorf("certificate revocation list expired")
+	}
+
+	for _, chain := range cs.VerifiedChains {
+		for _, cert := range chain {
+			if bytes.Equal(cert.RawIssuer, c.rawIssuer) && c.revoked[cert.SerialNumber.String()] {
+				return fmt.Errorf("client certificate with serial number %s is revoked", cert.SerialNumber)
+			}
+		}
+	}
+
+	return nil
+}
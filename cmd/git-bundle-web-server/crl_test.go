@@ -0,0 +1,283 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/git-ecosystem/git-bundle-server/internal/testhelpers"
+	"github.com/stretchr/testify/assert"
+)
+
+var testCRLNow = time.Now()
+
+// mustSucceed panics if the setup of a test fails.
+func mustSucceed(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
+
+type testCA struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+func newTestCA(name string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	mustSucceed(err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             testCRLNow.Add(-time.Hour),
+		NotAfter:              testCRLNow.Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	mustSucceed(err)
+	cert, err := x509.ParseCertificate(der)
+	mustSucceed(err)
+
+	return &testCA{cert: cert, key: key}
+}
+
+// writeCert writes the PEM-encoded CA certificate to a file in 'dir'.
+func (ca *testCA) writeCert(dir string) string {
+	path := filepath.Join(dir, "ca.pem")
+	err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}), 0o600)
+	mustSucceed(err)
+	return path
+}
+
+// issueKeyPair returns a certificate for 'localhost' with the given serial
+// number and usage, with its key.
+func (ca *testCA) issueKeyPair(serial int64, usage x509.ExtKeyUsage) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	mustSucceed(err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    testCRLNow.Add(-time.Hour),
+		NotAfter:     testCRLNow.Add(24 * time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, key.Public(), ca.key)
+	mustSucceed(err)
+	cert, err := x509.ParseCertificate(der)
+	mustSucceed(err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}
+}
+
+// issue returns a client certificate with the given serial number.
+func (ca *testCA) issue(serial int64) *x509.Certificate {
+	return ca.issueKeyPair(serial, x509.ExtKeyUsageClientAuth).Leaf
+}
+
+// writeCRL writes a PEM-encoded CRL revoking the given serial numbers, valid
+// until 'nextUpdate', and sets its modification time to 'modTime'.
+func (ca *testCA) writeCRL(path string, number int64, nextUpdate time.Time, modTime time.Time, revoked ...int64) {
+	entries := []x509.RevocationListEntry{}
+	for _, serial := range revoked {
+		entries = append(entries, x509.RevocationListEntry{
+			SerialNumber:   big.NewInt(serial),
+			RevocationTime: testCRLNow.Add(-time.Minute),
+		})
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:                    big.NewInt(number),
+		ThisUpdate:                testCRLNow.Add(-2 * time.Hour),
+		NextUpdate:                nextUpdate,
+		RevokedCertificateEntries: entries,
+	}, ca.cert, ca.key)
+	mustSucceed(err)
+
+	err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), 0o600)
+	mustSucceed(err)
+	err = os.Chtimes(path, modTime, modTime)
+	mustSucceed(err)
+}
+
+func verifyClient(crl *revocationList, ca *testCA, cert *x509.Certificate) error {
+	return crl.VerifyConnection(tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{cert},
+		VerifiedChains:   [][]*x509.Certificate{{cert, ca.cert}},
+	})
+}
+
+func Test_RevocationList_Revoked(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA("Test CA")
+	crlPath := filepath.Join(dir, "crl.pem")
+	ca.writeCRL(crlPath, 1, testCRLNow.Add(time.Hour), testCRLNow, 2)
+
+	crl, err := NewRevocationList(crlPath, ca.writeCert(dir))
+	mustSucceed(err)
+
+	assert.Nil(t, verifyClient(crl, ca, ca.issue(3)))
+	assert.NotNil(t, verifyClient(crl, ca, ca.issue(2)))
+
+	// The same serial number from another CA isn't revoked
+	otherCA := newTestCA("Other CA")
+	assert.Nil(t, verifyClient(crl, otherCA, otherCA.issue(2)))
+}
+
+func Test_RevocationList_InvalidCRL(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA("Test CA")
+	caPath := ca.writeCert(dir)
+	crlPath := filepath.Join(dir, "crl.pem")
+
+	t.Run("Expired CRL is rejected", func(t *testing.T) {
+		ca.writeCRL(crlPath, 1, testCRLNow.Add(-time.Minute), testCRLNow)
+		_, err := NewRevocationList(crlPath, caPath)
+		assert.ErrorContains(t, err, "expired")
+	})
+
+	t.Run("CRL of another CA is rejected", func(t *testing.T) {
+		otherCA := newTestCA("Other CA")
+		otherCA.writeCRL(crlPath, 1, testCRLNow.Add(time.Hour), testCRLNow)
+		_, err := NewRevocationList(crlPath, caPath)
+		assert.ErrorContains(t, err, "not signed")
+	})
+}
+
+func Test_RevocationList_Expiry(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA("Test CA")
+	crlPath := filepath.Join(dir, "crl.pem")
+	ca.writeCRL(crlPath, 1, testCRLNow.Add(time.Hour), testCRLNow)
+
+	crl, err := NewRevocationList(crlPath, ca.writeCert(dir))
+	mustSucceed(err)
+	cert := ca.issue(3)
+	assert.Nil(t, verifyClient(crl, ca, cert))
+
+	// Once the CRL expires, all certificates are rejected...
+	crl.now = func() time.Time { return testCRLNow.Add(2 * time.Hour) }
+	assert.NotNil(t, verifyClient(crl, ca, cert))
+
+	// ...except for clients without a certificate...
+	assert.Nil(t, crl.VerifyConnection(tls.ConnectionState{}))
+
+	// ...until it is replaced
+	ca.writeCRL(crlPath, 2, testCRLNow.Add(3*time.Hour), testCRLNow.Add(time.Second))
+	assert.Nil(t, verifyClient(crl, ca, cert))
+}
+
+func Test_RevocationList_Reload(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA("Test CA")
+	crlPath := filepath.Join(dir, "crl.pem")
+	ca.writeCRL(crlPath, 1, testCRLNow.Add(time.Hour), testCRLNow)
+
+	crl, err := NewRevocationList(crlPath, ca.writeCert(dir))
+	mustSucceed(err)
+	cert := ca.issue(3)
+	assert.Nil(t, verifyClient(crl, ca, cert))
+
+	// A new CRL revoking the certificate is picked up
+	ca.writeCRL(crlPath, 2, testCRLNow.Add(time.Hour), testCRLNow.Add(time.Second), 3)
+	assert.NotNil(t, verifyClient(crl, ca, cert))
+
+	// An invalid CRL is ignored, keeping the previous one
+	err = os.WriteFile(crlPath, []byte("not a CRL"), 0o600)
+	mustSucceed(err)
+	err = os.Chtimes(crlPath, testCRLNow.Add(2*time.Second), testCRLNow.Add(2*time.Second))
+	mustSucceed(err)
+	assert.NotNil(t, verifyClient(crl, ca, cert))
+
+	// A valid CRL unrevoking the certificate is picked up
+	ca.writeCRL(crlPath, 3, testCRLNow.Add(time.Hour), testCRLNow.Add(3*time.Second))
+	assert.Nil(t, verifyClient(crl, ca, cert))
+}
+
+// connect makes a TLS connection to a server with the given config, returning
+// whether the client resumed an earlier session and the server's handshake
+// error, if any.
+func connect(serverConfig *tls.Config, clientConfig *tls.Config) (bool, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	mustSucceed(err)
+	defer listener.Close()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		server := tls.Server(conn, serverConfig)
+		defer server.Close()
+		err = server.Handshake()
+		if err == nil {
+			// Lets the client read the session ticket sent after the
+			// handshake
+			_, err = server.Write([]byte("x"))
+		}
+		serverErr <- err
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	mustSucceed(err)
+	client := tls.Client(conn, clientConfig)
+	defer client.Close()
+	resumed := false
+	if client.Handshake() == nil {
+		resumed = client.ConnectionState().DidResume
+		client.Read(make([]byte, 1))
+	}
+
+	return resumed, <-serverErr
+}
+
+func Test_RevocationList_ResumedSession(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA("Test CA")
+	caPath := ca.writeCert(dir)
+	crlPath := filepath.Join(dir, "crl.pem")
+	ca.writeCRL(crlPath, 1, testCRLNow.Add(time.Hour), testCRLNow)
+
+	server, err := NewBundleWebServer(&MockTraceLogger{}, "0", "server.crt", "server.key",
+		tls.VersionTLS12, caPath, false, crlPath, "", "", 0, nil)
+	mustSucceed(err)
+	serverConfig := server.server.TLSConfig
+	serverConfig.Certificates = []tls.Certificate{ca.issueKeyPair(100, x509.ExtKeyUsageServerAuth)}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	clientConfig := &tls.Config{
+		ServerName:         "localhost",
+		RootCAs:            roots,
+		Certificates:       []tls.Certificate{ca.issueKeyPair(3, x509.ExtKeyUsageClientAuth)},
+		ClientSessionCache: tls.NewLRUClientSessionCache(1),
+	}
+
+	resumed, err := connect(serverConfig, clientConfig)
+	assert.Nil(t, err)
+	assert.False(t, resumed)
+
+	resumed, err = connect(serverConfig, clientConfig)
+	assert.Nil(t, err)
+	assert.True(t, resumed, "session should be resumed")
+
+	// Once the certificate is revoked, resuming the session fails
+	ca.writeCRL(crlPath, 2, testCRLNow.Add(time.Hour), testCRLNow.Add(time.Second), 3)
+	_, err = connect(serverConfig, clientConfig)
+	assert.ErrorContains(t, err, "revoked")
+}
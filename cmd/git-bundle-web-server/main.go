@@ -13,6 +13,7 @@ import (
 	"os"
 	"plugin"
 	"strings"
+	"time"
 
 	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
 	"github.com/git-ecosystem/git-bundle-server/internal/argparse"
@@ -48,9 +49,55 @@ func parseAuthConfig(configPath string) (auth.AuthMiddleware, error) {
 		return nil, err
 	}
 
+	return newAuthMiddleware(config)
+}
+
+func newAuthMiddleware(config authConfig) (auth.AuthMiddleware, error) {
 	switch strings.ToLower(config.AuthMode) {
+	case "chain":
+		if len(config.Chain) == 0 {
+			return nil, fmt.Errorf("chain is empty")
+		}
+
+		var requireAll bool
+		switch strings.ToLower(config.Require) {
+		case "", "any":
+			requireAll = false
+		case "all":
+			requireAll = true
+		default:
+			return nil, fmt.Errorf("unrecognized chain requirement '%s' (expected 'any' or 'all')", config.Require)
+		}
+
+		links := []auth.AuthMiddleware{}
+		for i, linkConfig := range config.Chain {
+			link, err := newAuthMiddleware(linkConfig)
+			if err != nil {
+				return nil, fmt.Errorf("chain link %d (%s): %w", i, linkConfig.AuthMode, err)
+			}
+			if link == nil {
+				return nil, fmt.Errorf("chain link %d (%s): middleware is nil", i, linkConfig.AuthMode)
+			}
+			links = append(links, link)
+		}
+
+		return auth_internal.NewAuthChain(links, requireAll), nil
 	case "fixed":
 		return auth_internal.NewFixedCredentialAuth(config.Parameters)
+	case "htpasswd":
+		return auth_internal.NewHtpasswdAuth(config.Parameters)
+	case "acl":
+		return auth_internal.NewACLAuth(config.Parameters)
+	case "jwt":
+		return auth_internal.NewJWTAuth(config.Parameters)
+	case "mtls":
+		return auth_internal.NewMTLSAuth(config.Parameters)
+	case "network":
+		return auth_internal.NewNetworkAuth(config.Parameters)
+	case "exec":
+		return auth_internal.NewExecAuth(config.Parameters)
+	case "http":
+		return auth_internal.NewHTTPAuth(config.Parameters)
 	case "plugin":
 		if len(config.Path) == 0 {
 			return nil, fmt.Errorf("plugin .so is empty")
@@ -113,19 +160,41 @@ type authConfig struct {
 	Initializer string `json:"initializer,omitempty"`
 	Checksum    string `json:"sha256,omitempty"`
 
+	// Chain-specific settings
+	Require string       `json:"require,omitempty"`
+	Chain   []authConfig `json:"chain,omitempty"`
+
 	// Per-middleware custom config
 	Parameters json.RawMessage `json:"parameters,omitempty"`
 }
 
 func main() {
 	log.WithTraceLogger(context.Background(), func(ctx context.Context, logger log.TraceLogger) {
-		parser := argparse.NewArgParser(logger, "git-bundle-web-server [--port <port>] [--cert <filename> --key <filename>]")
+		parser := argparse.NewArgParser(logger, "git-bundle-web-server [--instance <name>] [--port <port>] [--cert <filename> --key <filename>] [--root <dir>] [--check-auth-config [<request>...]]")
+		instanceFlags, getInstance := utils.InstanceFlag(parser)
+		instanceFlags.VisitAll(func(f *flag.Flag) {
+			parser.Var(f.Value, f.Name, f.Usage)
+		})
 		flags, validate := utils.WebServerFlags(parser)
 		flags.VisitAll(func(f *flag.Flag) {
 			parser.Var(f.Value, f.Name, f.Usage)
 		})
+		dataRootFlags, applyDataRoots := utils.DataRootFlags(parser)
+		dataRootFlags.VisitAll(func(f *flag.Flag) {
+			parser.Var(f.Value, f.Name, f.Usage)
+		})
+
+		checkAuth := parser.Bool("check-auth-config", false, "Load the auth config and authorize the sample requests, without starting the server")
+		checkHeaders := parser.StringList("check-header", "A header (e.g. 'Authorization: Bearer <token>') sent with the sample requests of '--check-auth-config'")
+		sampleRequests := parser.PositionalList("request", "with '--check-auth-config', the URL or route of a sample request to authorize", false)
 
 		parser.Parse(ctx, os.Args[1:])
+		applyDataRoots(ctx)
+
+		// Options not given on the command line are read from the instance's
+		// settings in the server config, so that it is applied whenever the
+		// daemon (re)starts
+		utils.ApplyWebServerConfig(ctx, parser, getInstance(ctx))
 		validate(ctx)
 
 		// Get the flag values
@@ -134,7 +203,26 @@ func main() {
 		key := utils.GetFlagValue[string](parser, "key")
 		tlsMinVersion := utils.GetFlagValue[uint16](parser, "tls-version")
 		clientCA := utils.GetFlagValue[string](parser, "client-ca")
+		clientCertOptional := utils.GetFlagValue[bool](parser, "client-cert-optional")
+		clientCRL := utils.GetFlagValue[string](parser, "client-crl")
 		authConfig := utils.GetFlagValue[string](parser, "auth-config")
+		baseUrl := utils.GetFlagValue[string](parser, "base-url")
+		webhookSecretFile := utils.GetFlagValue[string](parser, "webhook-secret-file")
+		webhookDebounce := utils.GetFlagValue[time.Duration](parser, "webhook-debounce")
+		authCacheTTL := utils.GetFlagValue[time.Duration](parser, "auth-cache-ttl")
+
+		if *checkAuth {
+			if authConfig == "" {
+				parser.Usage(ctx, "'--check-auth-config' requires '--auth-config'.")
+			}
+			err := checkAuthConfig(os.Stdout, authConfig, *checkHeaders, *sampleRequests)
+			if err != nil {
+				logger.Fatal(ctx, err)
+			}
+			return
+		} else if len(*sampleRequests) > 0 || len(*checkHeaders) > 0 {
+			parser.Usage(ctx, "Sample requests and '--check-header' require '--check-auth-config'.")
+		}
 
 		// Configure auth
 		var err error
@@ -154,6 +242,10 @@ func main() {
 					"If no middleware is desired, remove the --auth-config option.")
 			}
 			middlewareAuthorize = middleware.Authorize
+			if authCacheTTL > 0 {
+				middlewareAuthorize = newAuthCache(middleware.Authorize, authCacheTTL,
+					auth_internal.DecisionHeaders(middleware)).Authorize
+			}
 		}
 
 		// Configure the server
@@ -161,7 +253,9 @@ func main() {
 			port,
 			cert, key,
 			tlsMinVersion,
-			clientCA,
+			clientCA, clientCertOptional, clientCRL,
+			baseUrl,
+			webhookSecretFile, webhookDebounce,
 			middlewareAuthorize,
 		)
 		if err != nil {
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/cmd"
+	"github.com/git-ecosystem/git-bundle-server/internal/common"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/git"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+// The path at which push notifications are received. Because it has only one
+// element, it cannot conflict with a route ('<owner>/<repo>').
+const webhookPath string = "/webhook"
+
+// The maximum size of a webhook request body. Push payloads are usually a few
+// kilobytes, but can grow with the number of commits pushed.
+const maxWebhookPayload int64 = 25 * 1024 * 1024
+
+// pushPayload contains the fields of a push notification that identify the
+// pushed repository. The 'repository' fields are sent by GitHub and Gitea, the
+// 'project' fields by GitLab.
+type pushPayload struct {
+	Repository struct {
+		CloneUrl string `json:"clone_url"`
+		SshUrl   string `json:"ssh_url"`
+		GitUrl   string `json:"git_url"`
+		HtmlUrl  string `json:"html_url"`
+	} `json:"repository"`
+	Project struct {
+		GitHttpUrl string `json:"git_http_url"`
+		GitSshUrl  string `json:"git_ssh_url"`
+		WebUrl     string `json:"web_url"`
+	} `json:"project"`
+}
+
+func (p *pushPayload) urls() []string {
+	urls := []string{}
+	for _, url := range []string{
+		p.Repository.CloneUrl,
+		p.Repository.SshUrl,
+		p.Repository.GitUrl,
+		p.Repository.HtmlUrl,
+		p.Project.GitHttpUrl,
+		p.Project.GitSshUrl,
+		p.Project.WebUrl,
+	} {
+		if url != "" {
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
+
+type webhookReceiver struct {
+	logger log.TraceLogger
+	secret []byte
+	queue  *updateQueue
+}
+
+func NewWebhookReceiver(logger log.TraceLogger, secretFile string, debounce time.Duration) (*webhookReceiver, error) {
+	secret, err := os.ReadFile(secretFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read webhook secret: %w", err)
+	}
+	secret = []byte(strings.TrimSpace(string(secret)))
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("webhook secret file '%s' is empty", secretFile)
+	}
+
+	return &webhookReceiver{
+		logger: logger,
+		secret: secret,
+		queue:  newUpdateQueue(logger, debounce),
+	}, nil
+}
+
+// verifySignature authenticates a request with the shared secret. GitHub and
+// Gitea send the 'X-Hub-Signature-256' header, which contains the hex-encoded
+// HMAC-SHA256 of the request body keyed with the secret and prefixed with
+// 'sha256='. GitLab sends the secret itself in the 'X-Gitlab-Token' header.
+func (h *webhookReceiver) verifySignature(r *http.Request, body []byte) bool {
+	if r.Header.Get("X-Hub-Signature-256") == "" {
+		token := r.Header.Get("X-Gitlab-Token")
+		return token != "" && subtle.ConstantTimeCompare([]byte(token), h.secret) == 1
+	}
+
+	signature, found := strings.CutPrefix(r.Header.Get("X-Hub-Signature-256"), "sha256=")
+	if !found {
+		return false
+	}
+
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, h.secret)
+	mac.Write(body)
+	return hmac.Equal(expected, mac.Sum(nil))
+}
+
+// matchRoutes returns the routes whose remote URL refers to one of the given
+// repository URLs.
+func (h *webhookReceiver) matchRoutes(ctx context.Context, urls []string) ([]string, error) {
+	userProvider := common.NewUserProvider()
+	fileSystem := common.NewFileSystem()
+	commandExecutor := cmd.NewCommandExecutor(h.logger)
+	gitHelper := git.NewGitHelper(h.logger, commandExecutor, git.DefaultRefSelection)
+	repoProvider := core.NewRepositoryProvider(h.logger, userProvider, fileSystem, gitHelper)
+
+	repos, err := repoProvider.GetRepositories(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	remoteUrls := map[string]string{}
+	for route, repo := range repos {
+		remoteUrl, err := gitHelper.GetRemoteUrl(ctx, repo.RepoDir)
+		if err != nil {
+			// Don't let one broken repository prevent updating the others
+			fmt.Printf("Failed to get remote URL of %s: %s\n", route, err)
+			continue
+		}
+		remoteUrls[route] = remoteUrl
+	}
+
+	return routesMatchingUrls(remoteUrls, urls), nil
+}
+
+// routesMatchingUrls returns the routes (sorted by name) whose remote URL in
+// 'remoteUrls' refers to the same repository as one of 'urls'.
+func routesMatchingUrls(remoteUrls map[string]string, urls []string) []string {
+	pushed := map[string]bool{}
+	for _, url := range urls {
+		pushed[core.NormalizeRemoteUrl(url)] = true
+	}
+
+	routes := []string{}
+	for route, remoteUrl := range remoteUrls {
+		if pushed[core.NormalizeRemoteUrl(remoteUrl)] {
+			routes = append(routes, route)
+		}
+	}
+	sort.Strings(routes)
+	return routes
+}
+
+func (h *webhookReceiver) serve(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	ctx, exitRegion := h.logger.Region(ctx, "http", "serve_webhook")
+	defer exitRegion()
+
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookPayload))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Printf("Failed to read webhook payload: %s\n", err)
+		return
+	}
+
+	if !h.verifySignature(r, body) {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Printf("Rejected webhook with invalid signature\n")
+		return
+	}
+
+	// Acknowledge (but ignore) notifications other than pushes, e.g. the
+	// 'ping' sent by GitHub when a webhook is created.
+	if !isPushEvent(r) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var payload pushPayload
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Printf("Failed to parse webhook payload: %s\n", err)
+		return
+	}
+
+	routes, err := h.matchRoutes(ctx, payload.urls())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Printf("Failed to load routes\n")
+		return
+	}
+	if len(routes) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Printf("No route matches webhook repository\n")
+		return
+	}
+
+	for _, route := range routes {
+		fmt.Printf("Queueing update of %s\n", route)
+		h.queue.Enqueue(route)
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// isPushEvent returns whether a notification is about pushed commits or tags,
+// according to its event header (if any). Gitea sends the same header as
+// GitHub.
+func isPushEvent(r *http.Request) bool {
+	if event := r.Header.Get("X-GitHub-Event"); event != "" {
+		return event == "push"
+	}
+	if event := r.Header.Get("X-Gitlab-Event"); event != "" {
+		return event == "Push Hook" || event == "Tag Push Hook"
+	}
+	return true
+}
+
+// updateQueue runs 'git-bundle-server update' for routes after a delay. If a
+// route is queued again before its update starts, the delay is restarted so
+// that a burst of notifications results in a single update. A route queued
+// while its update is running is updated again once it finishes.
+type updateQueue struct {
+	logger   log.TraceLogger
+	debounce time.Duration
+
+	// update updates a route; 'runUpdate' unless replaced by tests.
+	update func(ctx context.Context, route string) error
+
+	lock    sync.Mutex
+	closed  bool
+	timers  map[string]*time.Timer
+	running map[string]bool
+	pending map[string]bool
+	wg      sync.WaitGroup
+}
+
+func newUpdateQueue(logger log.TraceLogger, debounce time.Duration) *updateQueue {
+	q := &updateQueue{
+		logger:   logger,
+		debounce: debounce,
+		timers:   make(map[string]*time.Timer),
+		running:  make(map[string]bool),
+		pending:  make(map[string]bool),
+	}
+	q.update = q.runUpdate
+	return q
+}
+
+func (q *updateQueue) Enqueue(route string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.closed {
+		return
+	}
+
+	if q.running[route] {
+		q.pending[route] = true
+		return
+	}
+
+	if timer, exists := q.timers[route]; exists && timer.Stop() {
+		timer.Reset(q.debounce)
+		return
+	}
+
+	q.wg.Add(1)
+	// The timer is only read by 'run()' while holding the lock, so it is
+	// guaranteed to be assigned by then
+	var timer *time.Timer
+	timer = time.AfterFunc(q.debounce, func() { q.run(route, &timer) })
+	q.timers[route] = timer
+}
+
+func (q *updateQueue) run(route string, timer **time.Timer) {
+	defer q.wg.Done()
+
+	q.lock.Lock()
+	if q.timers[route] == *timer {
+		delete(q.timers, route)
+	}
+	if q.closed {
+		q.lock.Unlock()
+		return
+	}
+	if q.running[route] {
+		// Another timer fired while the route was updating
+		q.pending[route] = true
+		q.lock.Unlock()
+		return
+	}
+	q.running[route] = true
+	q.lock.Unlock()
+
+	ctx, exitRegion := q.logger.Region(context.Background(), "webhook", "update")
+	fmt.Printf("Updating %s\n", route)
+	err := q.update(ctx, route)
+	if err != nil {
+		fmt.Printf("Failed to update %s: %s\n", route, err)
+	}
+	exitRegion()
+
+	q.lock.Lock()
+	delete(q.running, route)
+	requeue := q.pending[route]
+	delete(q.pending, route)
+	q.lock.Unlock()
+
+	if requeue {
+		q.Enqueue(route)
+	}
+}
+
+func (q *updateQueue) runUpdate(ctx context.Context, route string) error {
+	fileSystem := common.NewFileSystem()
+	commandExecutor := cmd.NewCommandExecutor(q.logger)
+
+	exe, err := fileSystem.GetLocalExecutable("git-bundle-server")
+	if err != nil {
+		return fmt.Errorf("failed to get path to executable: %w", err)
+	}
+
+	exitCode, err := commandExecutor.RunQuiet(ctx, exe, "update", route)
+	if err != nil {
+		return err
+	} else if exitCode != 0 {
+		return fmt.Errorf("'git-bundle-server update' exited with status %d", exitCode)
+	}
+
+	return nil
+}
+
+// Close cancels all updates that have not started yet and waits for the
+// running ones to finish.
+func (q *updateQueue) Close() {
+	q.lock.Lock()
+	q.closed = true
+	for route, timer := range q.timers {
+		if timer.Stop() {
+			delete(q.timers, route)
+			q.wg.Done()
+		}
+	}
+	q.lock.Unlock()
+
+	q.wg.Wait()
+}
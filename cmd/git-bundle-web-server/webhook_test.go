@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/git-ecosystem/git-bundle-server/internal/testhelpers"
+	"github.com/stretchr/testify/assert"
+)
+
+const testWebhookSecret = "webhook-secret"
+
+func githubSignature(secret string, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+var verifySignatureTests = []struct {
+	title string
+
+	headers map[string]string
+	body    string
+
+	expectedValid bool
+}{
+	{
+		"Valid GitHub signature",
+		map[string]string{"X-Hub-Signature-256": githubSignature(testWebhookSecret, `{"a":1}`)},
+		`{"a":1}`,
+		true,
+	},
+	{
+		"GitHub signature of another body",
+		map[string]string{"X-Hub-Signature-256": githubSignature(testWebhookSecret, `{"a":1}`)},
+		`{"a":2}`,
+		false,
+	},
+	{
+		"GitHub signature with another secret",
+		map[string]string{"X-Hub-Signature-256": githubSignature("other-secret", `{"a":1}`)},
+		`{"a":1}`,
+		false,
+	},
+	{
+		"GitHub signature without prefix",
+		map[string]string{"X-Hub-Signature-256": strings.TrimPrefix(githubSignature(testWebhookSecret, `{"a":1}`), "sha256=")},
+		`{"a":1}`,
+		false,
+	},
+	{
+		"GitHub signature is not hex",
+		map[string]string{"X-Hub-Signature-256": "sha256=not-hex"},
+		`{"a":1}`,
+		false,
+	},
+	{
+		"Valid GitLab token",
+		map[string]string{"X-Gitlab-Token": testWebhookSecret},
+		`{"a":1}`,
+		true,
+	},
+	{
+		"Invalid GitLab token",
+		map[string]string{"X-Gitlab-Token": "other-secret"},
+		`{"a":1}`,
+		false,
+	},
+	{
+		"GitLab token is a prefix of the secret",
+		map[string]string{"X-Gitlab-Token": "webhook"},
+		`{"a":1}`,
+		false,
+	},
+	{
+		"Invalid GitHub signature with valid GitLab token",
+		map[string]string{
+			"X-Hub-Signature-256": "sha256=00",
+			"X-Gitlab-Token":      testWebhookSecret,
+		},
+		`{"a":1}`,
+		false,
+	},
+	{
+		"No signature",
+		map[string]string{},
+		`{"a":1}`,
+		false,
+	},
+}
+
+func Test_Webhook_VerifySignature(t *testing.T) {
+	receiver := &webhookReceiver{secret: []byte(testWebhookSecret)}
+
+	for _, tt := range verifySignatureTests {
+		t.Run(tt.title, func(t *testing.T) {
+			r := httptest.NewRequest("POST", webhookPath, strings.NewReader(tt.body))
+			for key, value := range tt.headers {
+				r.Header.Set(key, value)
+			}
+
+			assert.Equal(t, tt.expectedValid, receiver.verifySignature(r, []byte(tt.body)))
+		})
+	}
+}
+
+var webhookEventTests = []struct {
+	title string
+
+	headers map[string]string
+
+	expectedStatus int
+}{
+	{
+		"GitHub ping is acknowledged",
+		map[string]string{
+			"X-GitHub-Event":      "ping",
+			"X-Hub-Signature-256": githubSignature(testWebhookSecret, `{}`),
+		},
+		http.StatusNoContent,
+	},
+	{
+		"GitLab merge request is acknowledged",
+		map[string]string{
+			"X-Gitlab-Event": "Merge Request Hook",
+			"X-Gitlab-Token": testWebhookSecret,
+		},
+		http.StatusNoContent,
+	},
+	{
+		"GitLab push with invalid token is rejected",
+		map[string]string{
+			"X-Gitlab-Event": "Push Hook",
+			"X-Gitlab-Token": "other-secret",
+		},
+		http.StatusUnauthorized,
+	},
+}
+
+func Test_Webhook_Events(t *testing.T) {
+	receiver := &webhookReceiver{
+		logger: &MockTraceLogger{},
+		secret: []byte(testWebhookSecret),
+	}
+
+	for _, tt := range webhookEventTests {
+		t.Run(tt.title, func(t *testing.T) {
+			r := httptest.NewRequest("POST", webhookPath, strings.NewReader(`{}`))
+			for key, value := range tt.headers {
+				r.Header.Set(key, value)
+			}
+			w := httptest.NewRecorder()
+
+			receiver.serve(w, r)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
+
+var routesMatchingUrlsTests = []struct {
+	title string
+
+	remoteUrls map[string]string
+	urls       []string
+
+	expectedRoutes []string
+}{
+	{
+		"HTTPS URL matches SSH remote",
+		map[string]string{
+			"org/repo":  "git@github.com:org/repo.git",
+			"org/other": "git@github.com:org/other.git",
+		},
+		[]string{"https://github.com/org/repo.git"},
+		[]string{"org/repo"},
+	},
+	{
+		"GitLab project URL matches HTTPS remote",
+		map[string]string{"group/project": "https://gitlab.com/group/project"},
+		[]string{"https://gitlab.com/group/project.git", "git@gitlab.com:group/project.git"},
+		[]string{"group/project"},
+	},
+	{
+		"All routes mirroring the repository match",
+		map[string]string{
+			"org/repo":       "https://github.com/org/repo",
+			"mirror/repo":    "ssh://git@github.com/org/repo.git",
+			"unrelated/repo": "https://github.com/unrelated/repo",
+		},
+		[]string{"https://github.com/org/repo"},
+		[]string{"mirror/repo", "org/repo"},
+	},
+	{
+		"Same repository name on another host doesn't match",
+		map[string]string{"org/repo": "https://github.com/org/repo"},
+		[]string{"https://gitlab.com/org/repo"},
+		[]string{},
+	},
+	{
+		"No URLs",
+		map[string]string{"org/repo": "https://github.com/org/repo"},
+		[]string{},
+		[]string{},
+	},
+}
+
+func Test_Webhook_RoutesMatchingUrls(t *testing.T) {
+	for _, tt := range routesMatchingUrlsTests {
+		t.Run(tt.title, func(t *testing.T) {
+			assert.Equal(t, tt.expectedRoutes, routesMatchingUrls(tt.remoteUrls, tt.urls))
+		})
+	}
+}
+
+// fakeUpdates records the updates run by an updateQueue. Each update blocks
+// until released, if 'block' is set.
+type fakeUpdates struct {
+	lock    sync.Mutex
+	routes  []string
+	started chan string
+	block   chan struct{}
+}
+
+func newFakeUpdates(q *updateQueue, block bool) *fakeUpdates {
+	f := &fakeUpdates{started: make(chan string, 10)}
+	if block {
+		f.block = make(chan struct{})
+	}
+	q.update = func(ctx context.Context, route string) error {
+		f.lock.Lock()
+		f.routes = append(f.routes, route)
+		f.lock.Unlock()
+		f.started <- route
+		if f.block != nil {
+			<-f.block
+		}
+		return nil
+	}
+	return f
+}
+
+func (f *fakeUpdates) updated() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return append([]string{}, f.routes...)
+}
+
+func (f *fakeUpdates) waitForStart(t *testing.T) string {
+	select {
+	case route := <-f.started:
+		return route
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an update")
+		return ""
+	}
+}
+
+const testDebounce = 50 * time.Millisecond
+
+func Test_UpdateQueue_Debounce(t *testing.T) {
+	q := newUpdateQueue(&MockTraceLogger{}, testDebounce)
+	updates := newFakeUpdates(q, false)
+
+	// A burst of notifications results in one update per route
+	for i := 0; i < 5; i++ {
+		q.Enqueue("org/repo")
+		q.Enqueue("org/other")
+		time.Sleep(testDebounce / 5)
+	}
+	assert.Empty(t, updates.updated(), "updates ran before the notifications stopped")
+
+	updates.waitForStart(t)
+	updates.waitForStart(t)
+	q.Close()
+
+	assert.ElementsMatch(t, []string{"org/repo", "org/other"}, updates.updated())
+}
+
+func Test_UpdateQueue_EnqueueWhileRunning(t *testing.T) {
+	q := newUpdateQueue(&MockTraceLogger{}, testDebounce)
+	updates := newFakeUpdates(q, true)
+
+	q.Enqueue("org/repo")
+	updates.waitForStart(t)
+
+	// Notifications during the update result in a single follow-up update
+	q.Enqueue("org/repo")
+	q.Enqueue("org/repo")
+	updates.block <- struct{}{}
+
+	updates.waitForStart(t)
+	updates.block <- struct{}{}
+	q.Close()
+
+	assert.Equal(t, []string{"org/repo", "org/repo"}, updates.updated())
+}
+
+func Test_UpdateQueue_CloseCancelsPending(t *testing.T) {
+	q := newUpdateQueue(&MockTraceLogger{}, time.Hour)
+	updates := newFakeUpdates(q, false)
+
+	q.Enqueue("org/repo")
+	q.Close()
+
+	// Notifications after closing are ignored
+	q.Enqueue("org/repo")
+
+	assert.Empty(t, updates.updated())
+}
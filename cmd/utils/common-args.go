@@ -5,8 +5,17 @@ import (
 	"crypto/tls"
 	"flag"
 	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/bundles"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/daemon"
+	"github.com/git-ecosystem/git-bundle-server/internal/git"
 )
 
 // Helpers
@@ -17,6 +26,8 @@ import (
 // functions we want to call from the parser.
 type argParser interface {
 	Lookup(name string) *flag.Flag
+	Set(name string, value string) error
+	Visit(fn func(*flag.Flag))
 	Usage(ctx context.Context, errFmt string, args ...any)
 }
 
@@ -78,6 +89,28 @@ func (v *tlsVersionValue) Get() any {
 	return uint16(*v)
 }
 
+var instanceNameRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// InstanceFlag returns the flag selecting a named web server instance, and a
+// function returning the (validated) name of the selected instance, which is
+// empty for the default instance.
+func InstanceFlag(parser argParser) (*flag.FlagSet, func(context.Context) string) {
+	f := flag.NewFlagSet("", flag.ContinueOnError)
+	instance := f.String("instance", "", "The name of the web server instance (default: the unnamed instance)")
+
+	// Function to call to validate and get the instance name (may exit with
+	// 'Usage()')
+	instanceFunc := func(ctx context.Context) string {
+		if *instance != "" && !instanceNameRegex.MatchString(*instance) {
+			parser.Usage(ctx, "Invalid instance name '%s': names may only contain "+
+				"letters, digits, '-', and '_'.", *instance)
+		}
+		return *instance
+	}
+
+	return f, instanceFunc
+}
+
 func WebServerFlags(parser argParser) (*flag.FlagSet, func(context.Context)) {
 	f := flag.NewFlagSet("", flag.ContinueOnError)
 	port := f.String("port", "8080", "The port on which the server should be hosted")
@@ -85,8 +118,14 @@ func WebServerFlags(parser argParser) (*flag.FlagSet, func(context.Context)) {
 	key := f.String("key", "", "The path to the certificate's private key")
 	tlsVersion := tlsVersionValue(tls.VersionTLS12)
 	f.Var(&tlsVersion, "tls-version", "The minimum TLS version the server will accept")
-	f.String("client-ca", "", "The path to the client authentication certificate authority PEM")
+	clientCA := f.String("client-ca", "", "The path to the client authentication certificate authority PEM")
+	clientCertOptional := f.Bool("client-cert-optional", false, "Request client certificates without requiring them, so clients may authenticate with '--auth-config' instead")
+	clientCRL := f.String("client-crl", "", "The path to a certificate revocation list (PEM or DER) of the client certificate authority")
 	f.String("auth-config", "", "File containing the configuration for server auth middleware")
+	authCacheTTL := f.Duration("auth-cache-ttl", 0, "How long to cache the auth decision for a route and client credentials (default: no caching)")
+	f.String("webhook-secret-file", "", "File containing the shared secret of push webhooks; enables the '/webhook' endpoint")
+	webhookDebounce := f.Duration("webhook-debounce", 30*time.Second, "How long to wait for further pushes to a route before updating it")
+	baseUrl := f.String("base-url", "", "The public URL of the server, used to generate absolute bundle URIs for the 'bundle-uri' endpoint")
 
 	// Function to call for additional arg validation (may exit with 'Usage()')
 	validationFunc := func(ctx context.Context) {
@@ -97,7 +136,352 @@ func WebServerFlags(parser argParser) (*flag.FlagSet, func(context.Context)) {
 		if (*cert == "") != (*key == "") {
 			parser.Usage(ctx, "Both '--cert' and '--key' are needed to specify SSL configuration.")
 		}
+		if *clientCA == "" && (*clientCertOptional || *clientCRL != "") {
+			parser.Usage(ctx, "'--client-cert-optional' and '--client-crl' require '--client-ca'.")
+		}
+		if *authCacheTTL < 0 {
+			parser.Usage(ctx, "Invalid auth cache TTL '%s'.", *authCacheTTL)
+		}
+		if *webhookDebounce < 0 {
+			parser.Usage(ctx, "Invalid webhook debounce '%s'.", *webhookDebounce)
+		}
+		if *baseUrl != "" {
+			if err := bundles.ValidateServerUrl(*baseUrl); err != nil {
+				parser.Usage(ctx, "%s", err)
+			}
+		}
 	}
 
 	return f, validationFunc
 }
+
+// RouteScheduleFlags returns the flags configuring the update schedule of a
+// route, a function to validate them (may exit with 'Usage()'), and a function
+// applying the specified flags to a route config. The latter returns whether
+// any of the flags were specified.
+func RouteScheduleFlags(parser argParser) (*flag.FlagSet, func(context.Context), func(*core.RouteConfig) bool) {
+	f := flag.NewFlagSet("", flag.ContinueOnError)
+	interval := f.String("interval", "", "The minimum time between scheduled updates of the route (default 24h)")
+	jitter := f.String("jitter", "", "The maximum random delay added to the update interval")
+	priority := f.String("priority", "", "The priority of the route when multiple routes are due (default 0)")
+
+	var intervalVal, jitterVal time.Duration
+	var priorityVal int
+
+	validationFunc := func(ctx context.Context) {
+		var err error
+		if *interval != "" {
+			intervalVal, err = core.ParseUpdateInterval(*interval)
+			if err != nil {
+				parser.Usage(ctx, "%s", err)
+			}
+		}
+		if *jitter != "" {
+			jitterVal, err = core.ParseUpdateJitter(*jitter)
+			if err != nil {
+				parser.Usage(ctx, "%s", err)
+			}
+		}
+		if *priority != "" {
+			priorityVal, err = strconv.Atoi(*priority)
+			if err != nil {
+				parser.Usage(ctx, "Invalid priority '%s'.", *priority)
+			}
+		}
+	}
+
+	applyFunc := func(config *core.RouteConfig) bool {
+		if *interval != "" {
+			config.UpdateInterval = core.FormatDuration(intervalVal)
+		}
+		if *jitter != "" {
+			config.UpdateJitter = core.FormatDuration(jitterVal)
+		}
+		if *priority != "" {
+			config.Priority = priorityVal
+		}
+
+		return *interval != "" || *jitter != "" || *priority != ""
+	}
+
+	return f, validationFunc, applyFunc
+}
+
+// RouteCredentialFlags returns the flags configuring the credentials with which
+// a route's repository is fetched from its remote, a function to validate them
+// (may exit with 'Usage()'), and a function applying the specified flags to a
+// route config. The latter returns whether any of the flags were specified.
+// Specified credentials replace those of the route config.
+func RouteCredentialFlags(parser argParser) (*flag.FlagSet, func(context.Context), func(*core.RouteConfig) bool) {
+	f := flag.NewFlagSet("", flag.ContinueOnError)
+	credentials := &git.RemoteCredentials{}
+	f.StringVar(&credentials.SSHKeyFile, "ssh-key", "", "the path to the private key used to fetch from an SSH remote")
+	f.StringVar(&credentials.TokenFile, "token-file", "", "the path to a file containing a token used to fetch from an HTTP(S) remote")
+	f.StringVar(&credentials.TokenEnv, "token-env", "", "the environment variable containing a token used to fetch from an HTTP(S) remote")
+	f.StringVar(&credentials.TokenUsername, "token-username", "", fmt.Sprintf("the username sent with the token (default '%s')", git.DefaultTokenUsername))
+	f.StringVar(&credentials.CredentialHelper, "credential-helper", "", "a Git credential helper used to fetch from an HTTP(S) remote")
+	noCredentials := f.Bool("no-credentials", false, "fetch with the credentials of the user running the update")
+
+	validationFunc := func(ctx context.Context) {
+		if *noCredentials && !credentials.IsEmpty() {
+			parser.Usage(ctx, "'--no-credentials' cannot be used with other credential options.")
+		}
+		if err := credentials.Validate(); err != nil {
+			parser.Usage(ctx, "Invalid credentials: %s.", err)
+		}
+
+		// Updates run from other directories, so store absolute paths
+		for _, path := range []*string{&credentials.SSHKeyFile, &credentials.TokenFile} {
+			if *path == "" {
+				continue
+			}
+			absPath, err := filepath.Abs(*path)
+			if err != nil {
+				parser.Usage(ctx, "Could not get absolute path of '%s': %s", *path, err)
+			}
+			if _, err := os.Stat(absPath); err != nil {
+				parser.Usage(ctx, "Invalid credentials: %s.", err)
+			}
+			*path = absPath
+		}
+	}
+
+	applyFunc := func(config *core.RouteConfig) bool {
+		if *noCredentials {
+			config.Credentials = nil
+			return true
+		} else if !credentials.IsEmpty() {
+			config.Credentials = credentials
+			return true
+		}
+		return false
+	}
+
+	return f, validationFunc, applyFunc
+}
+
+// envListValue is a flag.Value accumulating the 'KEY=VALUE' pairs of a
+// repeated flag.
+type envListValue []string
+
+func (e *envListValue) String() string {
+	return strings.Join(*e, ",")
+}
+
+func (e *envListValue) Set(value string) error {
+	key, _, found := strings.Cut(value, "=")
+	if !found || key == "" || strings.ContainsAny(key, " \t\n") {
+		return fmt.Errorf("expected 'KEY=VALUE'")
+	}
+	*e = append(*e, value)
+	return nil
+}
+
+func (e *envListValue) Get() any {
+	return []string(*e)
+}
+
+var byteSizeUnits = map[string]uint64{
+	"":  1,
+	"K": 1 << 10,
+	"M": 1 << 20,
+	"G": 1 << 30,
+	"T": 1 << 40,
+}
+
+// parseByteSize parses a size in bytes with an optional binary unit suffix,
+// e.g. '512M' or '2G'.
+func parseByteSize(size string) (uint64, error) {
+	upper := strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(size), "B"), "I")
+	numEnd := len(upper)
+	if numEnd > 0 && (upper[numEnd-1] < '0' || upper[numEnd-1] > '9') {
+		numEnd--
+	}
+
+	multiplier, ok := byteSizeUnits[upper[numEnd:]]
+	if !ok {
+		return 0, fmt.Errorf("invalid size '%s'", size)
+	}
+	value, err := strconv.ParseUint(upper[:numEnd], 10, 64)
+	if err != nil || value == 0 {
+		return 0, fmt.Errorf("invalid size '%s'", size)
+	}
+
+	return value * multiplier, nil
+}
+
+// The options setting the locations of the server's data, with the environment
+// variables (see 'core') they override. Each option takes precedence over the
+// server config setting of the same name.
+var dataRoots = []struct {
+	flag   string
+	envVar string
+	usage  string
+}{
+	{
+		"root", core.DataRootEnvVar,
+		"The directory containing the server's data (default: '~/git-bundle-server')",
+	},
+	{
+		"repo-root", core.RepoRootEnvVar,
+		"The directory containing the repositories of all routes (default: '<root>/git')",
+	},
+	{
+		"web-root", core.WebRootEnvVar,
+		"The directory containing the bundles of all routes (default: '<root>/www')",
+	},
+}
+
+// DataRootFlags returns the flags setting the locations of the server's data,
+// and a function applying them (may exit with 'Usage()'). Locations not given
+// on the command line or in the environment are read from the server config.
+// The resulting locations are exported to the environment, where they are
+// used by 'core' and inherited by subprocesses.
+func DataRootFlags(parser argParser) (*flag.FlagSet, func(context.Context)) {
+	f := flag.NewFlagSet("", flag.ContinueOnError)
+	values := make([]*string, len(dataRoots))
+	for i, root := range dataRoots {
+		values[i] = f.String(root.flag, "", root.usage)
+	}
+
+	applyFunc := func(ctx context.Context) {
+		var config core.ServerConfig
+		for i, root := range dataRoots {
+			value := *values[i]
+			if value == "" {
+				value = os.Getenv(root.envVar)
+			}
+			if value == "" {
+				if config == nil {
+					config = readServerConfig(ctx, parser)
+				}
+				value = config[root.flag]
+			}
+			if value == "" {
+				continue
+			}
+
+			absPath, err := filepath.Abs(value)
+			if err != nil {
+				parser.Usage(ctx, "Invalid %s '%s': %s", root.flag, value, err)
+			}
+			os.Setenv(root.envVar, absPath)
+		}
+	}
+
+	return f, applyFunc
+}
+
+// DataRootEnvironment returns the environment variables ('KEY=value') setting
+// the locations of the server's data, if they differ from the defaults.
+func DataRootEnvironment() []string {
+	env := []string{}
+	for _, root := range dataRoots {
+		if value := os.Getenv(root.envVar); value != "" {
+			env = append(env, fmt.Sprintf("%s=%s", root.envVar, value))
+		}
+	}
+	return env
+}
+
+// DataRootArgs returns the 'git-bundle-server' options setting the locations
+// of the server's data, if they differ from the defaults.
+func DataRootArgs() []string {
+	args := []string{}
+	for _, root := range dataRoots {
+		if value := os.Getenv(root.envVar); value != "" {
+			args = append(args, fmt.Sprintf("--%s", root.flag), value)
+		}
+	}
+	return args
+}
+
+// DaemonFlags returns the flags configuring how a daemon process is run, a
+// function to validate them (may exit with 'Usage()'), and a function applying
+// them to a daemon config.
+func DaemonFlags(parser argParser) (*flag.FlagSet, func(context.Context), func(*daemon.DaemonConfig) error) {
+	f := flag.NewFlagSet("", flag.ContinueOnError)
+	env := envListValue{}
+	f.Var(&env, "env", "An environment variable ('KEY=VALUE') to set for the daemon process; may be repeated")
+	workingDir := f.String("working-dir", "", "The directory in which to run the daemon process")
+	restart := f.Bool("restart-on-failure", false, "Restart the daemon process when it fails")
+	restartDelay := f.Duration("restart-delay", time.Second, "The time to wait before restarting the failed daemon process")
+	restartMaxDelay := f.Duration("restart-max-delay", time.Minute, "The maximum time to wait before restarting the daemon process after repeated failures")
+	stdoutLog := f.String("stdout-log", "", "The file to which the output of the daemon process is appended")
+	stderrLog := f.String("stderr-log", "", "The file to which the errors of the daemon process are appended")
+	memoryLimit := f.String("memory-limit", "", "The maximum memory the daemon process may use (e.g. '512M')")
+	cpuQuota := f.Int("cpu-quota", 0, "The maximum CPU time the daemon process may use, as a percentage of one CPU")
+
+	var memoryLimitVal uint64
+
+	validationFunc := func(ctx context.Context) {
+		if *restartDelay < 0 {
+			parser.Usage(ctx, "Invalid restart delay '%s'.", *restartDelay)
+		}
+		if *restartMaxDelay < 0 {
+			parser.Usage(ctx, "Invalid maximum restart delay '%s'.", *restartMaxDelay)
+		}
+		if *memoryLimit != "" {
+			var err error
+			memoryLimitVal, err = parseByteSize(*memoryLimit)
+			if err != nil {
+				parser.Usage(ctx, "%s", err)
+			}
+		}
+		if *cpuQuota < 0 {
+			parser.Usage(ctx, "Invalid CPU quota '%d'.", *cpuQuota)
+		}
+	}
+
+	applyFunc := func(config *daemon.DaemonConfig) error {
+		// Run the daemon on the same data as the current command, unless
+		// overridden with '--env'
+		overridden := map[string]bool{}
+		for _, keyValue := range env {
+			key, _, _ := strings.Cut(keyValue, "=")
+			overridden[key] = true
+		}
+		config.Environment = []string{}
+		for _, keyValue := range DataRootEnvironment() {
+			key, _, _ := strings.Cut(keyValue, "=")
+			if !overridden[key] {
+				config.Environment = append(config.Environment, keyValue)
+			}
+		}
+		config.Environment = append(config.Environment, env...)
+
+		// The daemon manager doesn't run in the current directory, so all
+		// paths need to be absolute
+		for _, path := range []struct {
+			value  string
+			target *string
+		}{
+			{*workingDir, &config.WorkingDirectory},
+			{*stdoutLog, &config.StdOutPath},
+			{*stderrLog, &config.StdErrPath},
+		} {
+			if path.value == "" {
+				continue
+			}
+			absPath, err := filepath.Abs(path.value)
+			if err != nil {
+				return fmt.Errorf("could not get absolute path of '%s': %w", path.value, err)
+			}
+			*path.target = absPath
+		}
+
+		if *restart {
+			config.Restart = &daemon.RestartPolicy{
+				Delay:    *restartDelay,
+				MaxDelay: *restartMaxDelay,
+			}
+		}
+
+		config.MemoryLimit = memoryLimitVal
+		config.CPUQuota = *cpuQuota
+
+		return nil
+	}
+
+	return f, validationFunc, applyFunc
+}
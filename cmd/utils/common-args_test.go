@@ -0,0 +1,219 @@
+package utils_test
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/git"
+	"github.com/stretchr/testify/assert"
+)
+
+// usageError is panicked by testArgParser.Usage in place of exiting.
+type usageError string
+
+// testArgParser is a minimal stand-in for the argparse parser, panicking with
+// the message of the first call to 'Usage()' in place of exiting.
+type testArgParser struct {
+	*flag.FlagSet
+}
+
+func (p *testArgParser) Usage(ctx context.Context, errFmt string, args ...any) {
+	panic(usageError(fmt.Sprintf(errFmt, args...)))
+}
+
+func validateWithUsage(validate func(context.Context)) (usage string) {
+	defer func() {
+		if r := recover(); r != nil {
+			err, ok := r.(usageError)
+			if !ok {
+				panic(r)
+			}
+			usage = string(err)
+		}
+	}()
+	validate(context.Background())
+	return ""
+}
+
+var routeCredentialFlagsTests = []struct {
+	title string
+
+	args []string // '<dir>' is replaced with a directory containing 'token' and 'key'
+	env  map[string]string
+
+	expectedUsage       string // a substring of the message, if validation fails
+	expectApplied       bool
+	expectedCredentials *git.RemoteCredentials
+}{
+	{
+		"No flags leave the credentials unchanged",
+		[]string{},
+		nil,
+		"",
+		false,
+		nil,
+	},
+	{
+		"--no-credentials clears the credentials",
+		[]string{"--no-credentials"},
+		nil,
+		"",
+		true,
+		nil,
+	},
+	{
+		"--ssh-key",
+		[]string{"--ssh-key", "<dir>/key"},
+		nil,
+		"",
+		true,
+		&git.RemoteCredentials{SSHKeyFile: "<dir>/key"},
+	},
+	{
+		"--token-file with --token-username",
+		[]string{"--token-file", "<dir>/token", "--token-username", "bot"},
+		nil,
+		"",
+		true,
+		&git.RemoteCredentials{TokenFile: "<dir>/token", TokenUsername: "bot"},
+	},
+	{
+		"--token-env",
+		[]string{"--token-env", "BUNDLE_SERVER_TOKEN"},
+		map[string]string{"BUNDLE_SERVER_TOKEN": "secret"},
+		"",
+		true,
+		&git.RemoteCredentials{TokenEnv: "BUNDLE_SERVER_TOKEN"},
+	},
+	{
+		"--credential-helper",
+		[]string{"--credential-helper", "store"},
+		nil,
+		"",
+		true,
+		&git.RemoteCredentials{CredentialHelper: "store"},
+	},
+	{
+		"--no-credentials with another option is rejected",
+		[]string{"--no-credentials", "--credential-helper", "store"},
+		nil,
+		"'--no-credentials' cannot be used with other credential options",
+		false,
+		nil,
+	},
+	{
+		"--token-file with --token-env is rejected",
+		[]string{"--token-file", "<dir>/token", "--token-env", "BUNDLE_SERVER_TOKEN"},
+		nil,
+		"Invalid credentials",
+		false,
+		nil,
+	},
+	{
+		"--token-env with --credential-helper is rejected",
+		[]string{"--token-env", "BUNDLE_SERVER_TOKEN", "--credential-helper", "store"},
+		nil,
+		"Invalid credentials",
+		false,
+		nil,
+	},
+	{
+		"--token-username without a token is rejected",
+		[]string{"--token-username", "bot"},
+		nil,
+		"Invalid credentials",
+		false,
+		nil,
+	},
+	{
+		"--token-username with a credential helper is rejected",
+		[]string{"--token-username", "bot", "--credential-helper", "store"},
+		nil,
+		"Invalid credentials",
+		false,
+		nil,
+	},
+	{
+		"Invalid --token-env name is rejected",
+		[]string{"--token-env", "NOT-A=NAME"},
+		nil,
+		"Invalid credentials",
+		false,
+		nil,
+	},
+	{
+		"Missing --token-file is rejected",
+		[]string{"--token-file", "<dir>/missing"},
+		nil,
+		"Invalid credentials",
+		false,
+		nil,
+	},
+	{
+		"Missing --ssh-key is rejected",
+		[]string{"--ssh-key", "<dir>/missing"},
+		nil,
+		"Invalid credentials",
+		false,
+		nil,
+	},
+}
+
+func Test_RouteCredentialFlags(t *testing.T) {
+	for _, tt := range routeCredentialFlagsTests {
+		t.Run(tt.title, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range []string{"token", "key"} {
+				err := os.WriteFile(filepath.Join(dir, name), []byte("secret\n"), 0o600)
+				assert.Nil(t, err)
+			}
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			args := make([]string, len(tt.args))
+			for i, arg := range tt.args {
+				args[i] = strings.Replace(arg, "<dir>", dir, 1)
+			}
+
+			parser := &testArgParser{flag.NewFlagSet("", flag.ContinueOnError)}
+			flags, validate, apply := utils.RouteCredentialFlags(parser)
+			err := flags.Parse(args)
+			assert.Nil(t, err)
+
+			usage := validateWithUsage(validate)
+			if tt.expectedUsage != "" {
+				assert.Contains(t, usage, tt.expectedUsage)
+				return
+			}
+			assert.Empty(t, usage)
+
+			config := &core.RouteConfig{
+				Credentials: &git.RemoteCredentials{CredentialHelper: "previous"},
+			}
+			applied := apply(config)
+			assert.Equal(t, tt.expectApplied, applied)
+
+			if !tt.expectApplied {
+				assert.Equal(t, "previous", config.Credentials.CredentialHelper)
+				return
+			}
+			if tt.expectedCredentials == nil {
+				assert.Nil(t, config.Credentials)
+				return
+			}
+
+			expected := *tt.expectedCredentials
+			expected.SSHKeyFile = strings.Replace(expected.SSHKeyFile, "<dir>", dir, 1)
+			expected.TokenFile = strings.Replace(expected.TokenFile, "<dir>", dir, 1)
+			assert.Equal(t, &expected, config.Credentials)
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package utils
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/bundles"
+	"github.com/git-ecosystem/git-bundle-server/internal/common"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/git"
+)
+
+// The prefix of the server config settings holding web server options (e.g.
+// 'web-server.port'). The options of a named instance are scoped to it (e.g.
+// 'web-server.<instance>.port').
+const webServerConfigPrefix string = "web-server."
+
+// webServerConfigKey returns the name of the server config setting holding the
+// given option of the web server instance (empty for the default instance).
+func webServerConfigKey(instance string, option string) string {
+	if instance == "" {
+		return webServerConfigPrefix + option
+	}
+	return webServerConfigPrefix + instance + "." + option
+}
+
+// The web server options whose values are paths, which must be made absolute
+// before being passed to a daemon.
+var WebServerPathFlags = map[string]bool{
+	"cert":                true,
+	"key":                 true,
+	"client-ca":           true,
+	"client-crl":          true,
+	"auth-config":         true,
+	"webhook-secret-file": true,
+}
+
+// ConfigSetting describes a setting of the server config (see
+// 'core.ServerConfig').
+type ConfigSetting struct {
+	Name        string
+	Description string
+
+	// Whether the value is a path, which is stored as an absolute path.
+	isPath bool
+
+	// Returns an error if the value is invalid.
+	validate func(value string) error
+}
+
+// Normalize validates the value of the setting, returning the value to store.
+func (s *ConfigSetting) Normalize(value string) (string, error) {
+	if s.isPath {
+		absPath, err := filepath.Abs(value)
+		if err != nil {
+			return "", fmt.Errorf("could not get absolute path of '%s': %w", value, err)
+		}
+		value = absPath
+	}
+
+	if s.validate != nil {
+		err := s.validate(value)
+		if err != nil {
+			return "", fmt.Errorf("invalid value for '%s': %w", s.Name, err)
+		}
+	}
+
+	return value, nil
+}
+
+// ConfigSettings returns all settings of the server config, sorted by name.
+func ConfigSettings() []ConfigSetting {
+	settings := []ConfigSetting{
+		{
+			Name:        "refs",
+			Description: "The refs included in bundles: 'branches' (default), 'tags', or 'branches,tags'",
+			validate: func(value string) error {
+				_, err := git.ParseRefSelection(value)
+				return err
+			},
+		},
+		{
+			Name:        "max-bundles",
+			Description: fmt.Sprintf("The number of bundles per route above which the oldest are collapsed into a base bundle (default %d)", bundles.DefaultMaxBundles),
+			validate: func(value string) error {
+				_, err := parseMaxBundles(value)
+				return err
+			},
+		},
+		{
+			Name:        "schedule",
+			Description: fmt.Sprintf("The cron expression on which routes are updated, unless changed with 'cron set' (default '%s')", core.CronDaily),
+			validate: func(value string) error {
+				_, err := core.ParseCronSchedule(value)
+				return err
+			},
+		},
+	}
+
+	for _, root := range dataRoots {
+		settings = append(settings, ConfigSetting{
+			Name:        root.flag,
+			Description: root.usage,
+			isPath:      true,
+		})
+	}
+
+	webServerFlags, _ := WebServerFlags(nil)
+	webServerFlags.VisitAll(func(f *flag.Flag) {
+		name := f.Name
+		settings = append(settings, ConfigSetting{
+			Name:        webServerConfigKey("", name),
+			Description: f.Usage,
+			isPath:      WebServerPathFlags[name],
+			validate: func(value string) error {
+				// Parse the value as the web server would
+				flags, _ := WebServerFlags(nil)
+				return flags.Set(name, value)
+			},
+		})
+	})
+
+	sort.Slice(settings, func(i, j int) bool { return settings[i].Name < settings[j].Name })
+	return settings
+}
+
+// LookupConfigSetting returns the server config setting with the given name,
+// including the web server options of named instances (e.g.
+// 'web-server.<instance>.port').
+func LookupConfigSetting(name string) (*ConfigSetting, bool) {
+	lookupName := name
+	if rest, ok := strings.CutPrefix(name, webServerConfigPrefix); ok {
+		instance, option, scoped := strings.Cut(rest, ".")
+		if scoped {
+			if !instanceNameRegex.MatchString(instance) {
+				return nil, false
+			}
+			lookupName = webServerConfigKey("", option)
+		}
+	}
+
+	for _, setting := range ConfigSettings() {
+		if setting.Name == lookupName {
+			setting.Name = name
+			return &setting, true
+		}
+	}
+	return nil, false
+}
+
+func parseMaxBundles(value string) (int, error) {
+	maxBundles, err := strconv.Atoi(value)
+	if err != nil || maxBundles < 1 {
+		return 0, fmt.Errorf("expected a positive number of bundles, got '%s'", value)
+	}
+	return maxBundles, nil
+}
+
+// ConfiguredRefSelection returns the refs included in bundles.
+func ConfiguredRefSelection(config core.ServerConfig) (git.RefSelection, error) {
+	if value, ok := config["refs"]; ok {
+		return git.ParseRefSelection(value)
+	}
+	return git.DefaultRefSelection, nil
+}
+
+// ConfiguredMaxBundles returns the maximum number of bundles in a list.
+func ConfiguredMaxBundles(config core.ServerConfig) (int, error) {
+	if value, ok := config["max-bundles"]; ok {
+		return parseMaxBundles(value)
+	}
+	return bundles.DefaultMaxBundles, nil
+}
+
+// ConfiguredSchedule returns the cron expression on which routes are updated
+// by default.
+func ConfiguredSchedule(config core.ServerConfig) (string, error) {
+	if value, ok := config["schedule"]; ok {
+		schedule, err := core.ParseCronSchedule(value)
+		return string(schedule), err
+	}
+	return string(core.CronDaily), nil
+}
+
+// readServerConfig reads the server config of the current user (may exit with
+// 'Usage()').
+func readServerConfig(ctx context.Context, parser argParser) core.ServerConfig {
+	user, err := common.NewUserProvider().CurrentUser()
+	if err != nil {
+		parser.Usage(ctx, "Could not read server config: %s", err)
+	}
+	config, err := core.ReadServerConfig(user)
+	if err != nil {
+		parser.Usage(ctx, "Could not read server config: %s", err)
+	}
+	return config
+}
+
+// WebServerConfigOptions returns the web server options (without their
+// leading dashes) set in the server config for the given instance (empty for the
+// default instance). Each instance has its own options: a named instance
+// doesn't inherit those of the default instance.
+func WebServerConfigOptions(config core.ServerConfig, instance string) map[string]string {
+	options := map[string]string{}
+	prefix := webServerConfigKey(instance, "")
+	for key, value := range config {
+		option, ok := strings.CutPrefix(key, prefix)
+		if !ok || strings.Contains(option, ".") {
+			// Another instance's option
+			continue
+		}
+		options[option] = value
+	}
+	return options
+}
+
+// ApplyWebServerConfig sets the web server options not given on the command
+// line to their values for the given instance in the server config, if any
+// (may exit with 'Usage()').
+func ApplyWebServerConfig(ctx context.Context, parser argParser, instance string) {
+	isSet := map[string]bool{}
+	parser.Visit(func(f *flag.Flag) { isSet[f.Name] = true })
+
+	config := readServerConfig(ctx, parser)
+	for name, value := range WebServerConfigOptions(config, instance) {
+		if isSet[name] || parser.Lookup(name) == nil {
+			continue
+		}
+
+		err := parser.Set(name, value)
+		if err != nil {
+			parser.Usage(ctx, "Invalid server config setting '%s': %s", webServerConfigKey(instance, name), err)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package utils_test
+
+import (
+	"testing"
+
+	"github.com/git-ecosystem/git-bundle-server/cmd/utils"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/stretchr/testify/assert"
+)
+
+var testInstancesConfig = core.ServerConfig{
+	"max-bundles":                   "3",
+	"web-server.port":               "443",
+	"web-server.cert":               "/etc/bundles/server.crt",
+	"web-server.auth-config":        "/etc/bundles/auth.json",
+	"web-server.internal.port":      "8080",
+	"web-server.external.port":      "8443",
+	"web-server.external.cert":      "/etc/bundles/external.crt",
+	"web-server.external.key":       "/etc/bundles/external.key",
+	"web-server.external.client-ca": "/etc/bundles/ca.pem",
+}
+
+var webServerConfigOptionsTests = []struct {
+	title string
+
+	instance string
+
+	expectedOptions map[string]string
+}{
+	{
+		"Default instance",
+		"",
+		map[string]string{
+			"port":        "443",
+			"cert":        "/etc/bundles/server.crt",
+			"auth-config": "/etc/bundles/auth.json",
+		},
+	},
+	{
+		"Plaintext instance doesn't inherit default options",
+		"internal",
+		map[string]string{
+			"port": "8080",
+		},
+	},
+	{
+		"mTLS instance",
+		"external",
+		map[string]string{
+			"port":      "8443",
+			"cert":      "/etc/bundles/external.crt",
+			"key":       "/etc/bundles/external.key",
+			"client-ca": "/etc/bundles/ca.pem",
+		},
+	},
+	{
+		"Instance without options",
+		"other",
+		map[string]string{},
+	},
+}
+
+func Test_WebServerConfigOptions(t *testing.T) {
+	for _, tt := range webServerConfigOptionsTests {
+		t.Run(tt.title, func(t *testing.T) {
+			options := utils.WebServerConfigOptions(testInstancesConfig, tt.instance)
+			assert.Equal(t, tt.expectedOptions, options)
+		})
+	}
+}
+
+var lookupConfigSettingTests = []struct {
+	title string
+
+	name string
+
+	expectFound bool
+}{
+	{"Top-level setting", "max-bundles", true},
+	{"Default instance option", "web-server.port", true},
+	{"Named instance option", "web-server.internal.port", true},
+	{"Unknown option", "web-server.unknown", false},
+	{"Unknown named instance option", "web-server.internal.unknown", false},
+	{"Invalid instance name", "web-server.-internal.port", false},
+	{"Nested instance name", "web-server.a.b.port", false},
+}
+
+func Test_LookupConfigSetting(t *testing.T) {
+	for _, tt := range lookupConfigSettingTests {
+		t.Run(tt.title, func(t *testing.T) {
+			setting, found := utils.LookupConfigSetting(tt.name)
+			assert.Equal(t, tt.expectFound, found)
+			if tt.expectFound {
+				assert.Equal(t, tt.name, setting.Name)
+			}
+		})
+	}
+}
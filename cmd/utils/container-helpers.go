@@ -10,6 +10,7 @@ import (
 	"github.com/git-ecosystem/git-bundle-server/internal/daemon"
 	"github.com/git-ecosystem/git-bundle-server/internal/git"
 	"github.com/git-ecosystem/git-bundle-server/internal/log"
+	"github.com/git-ecosystem/git-bundle-server/internal/scheduler"
 )
 
 func BuildGitBundleServerContainer(logger log.TraceLogger) *DependencyContainer {
@@ -23,6 +24,17 @@ func BuildGitBundleServerContainer(logger log.TraceLogger) *DependencyContainer
 	registerDependency(container, func(ctx context.Context) common.FileSystem {
 		return common.NewFileSystem()
 	})
+	registerDependency(container, func(ctx context.Context) core.ServerConfig {
+		user, err := GetDependency[common.UserProvider](ctx, container).CurrentUser()
+		if err != nil {
+			logger.Fatal(ctx, err)
+		}
+		config, err := core.ReadServerConfig(user)
+		if err != nil {
+			logger.Fatal(ctx, err)
+		}
+		return config
+	})
 	registerDependency(container, func(ctx context.Context) core.RepositoryProvider {
 		return core.NewRepositoryProvider(
 			logger,
@@ -32,10 +44,15 @@ func BuildGitBundleServerContainer(logger log.TraceLogger) *DependencyContainer
 		)
 	})
 	registerDependency(container, func(ctx context.Context) bundles.BundleProvider {
+		maxBundles, err := ConfiguredMaxBundles(GetDependency[core.ServerConfig](ctx, container))
+		if err != nil {
+			logger.Fatal(ctx, err)
+		}
 		return bundles.NewBundleProvider(
 			logger,
 			GetDependency[common.FileSystem](ctx, container),
 			GetDependency[git.GitHelper](ctx, container),
+			maxBundles,
 		)
 	})
 	registerDependency(container, func(ctx context.Context) core.CronScheduler {
@@ -47,16 +64,46 @@ func BuildGitBundleServerContainer(logger log.TraceLogger) *DependencyContainer
 		)
 	})
 	registerDependency(container, func(ctx context.Context) CronHelper {
+		schedule, err := ConfiguredSchedule(GetDependency[core.ServerConfig](ctx, container))
+		if err != nil {
+			logger.Fatal(ctx, err)
+		}
 		return NewCronHelper(
 			logger,
+			GetDependency[common.UserProvider](ctx, container),
 			GetDependency[common.FileSystem](ctx, container),
 			GetDependency[core.CronScheduler](ctx, container),
+			// Fall back to cron if the platform has no supported daemon
+			// manager, rather than failing
+			optionalDaemonProvider(ctx, logger, container),
+			schedule,
+		)
+	})
+	registerDependency(container, func(ctx context.Context) scheduler.RunHistory {
+		return scheduler.NewRunHistory(
+			logger,
+			GetDependency[common.UserProvider](ctx, container),
+			GetDependency[common.FileSystem](ctx, container),
+		)
+	})
+	registerDependency(container, func(ctx context.Context) scheduler.Scheduler {
+		return scheduler.NewScheduler(
+			logger,
+			GetDependency[core.RepositoryProvider](ctx, container),
+			GetDependency[scheduler.RunHistory](ctx, container),
+			GetDependency[cmd.CommandExecutor](ctx, container),
+			GetDependency[common.FileSystem](ctx, container),
 		)
 	})
 	registerDependency(container, func(ctx context.Context) git.GitHelper {
+		refs, err := ConfiguredRefSelection(GetDependency[core.ServerConfig](ctx, container))
+		if err != nil {
+			logger.Fatal(ctx, err)
+		}
 		return git.NewGitHelper(
 			logger,
 			GetDependency[cmd.CommandExecutor](ctx, container),
+			refs,
 		)
 	})
 	registerDependency(container, func(ctx context.Context) daemon.DaemonProvider {
@@ -74,3 +121,16 @@ func BuildGitBundleServerContainer(logger log.TraceLogger) *DependencyContainer
 
 	return container
 }
+
+func optionalDaemonProvider(ctx context.Context, logger log.TraceLogger, container *DependencyContainer) daemon.DaemonProvider {
+	d, err := daemon.NewDaemonProvider(
+		logger,
+		GetDependency[common.UserProvider](ctx, container),
+		GetDependency[cmd.CommandExecutor](ctx, container),
+		GetDependency[common.FileSystem](ctx, container),
+	)
+	if err != nil {
+		return nil
+	}
+	return d
+}
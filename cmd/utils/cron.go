@@ -2,44 +2,285 @@ package utils
 
 import (
 	"context"
+	"path/filepath"
+	"strings"
 
 	"github.com/git-ecosystem/git-bundle-server/internal/common"
 	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/daemon"
 	"github.com/git-ecosystem/git-bundle-server/internal/log"
+	"github.com/git-ecosystem/git-bundle-server/internal/scheduler"
 )
 
+// The label of the systemd or launchd timer running 'update-all'.
+const UpdateTimerLabel string = "com.git-ecosystem.gitbundleserver.update-all"
+
 type CronHelper interface {
+	// SetCronSchedule makes sure the job running 'update-all' is configured,
+	// keeping its current schedule if it already exists. The job is a systemd
+	// or launchd timer if the platform supports them, a cron job otherwise.
 	SetCronSchedule(ctx context.Context) error
+
+	// GetCronSchedule returns the cron expression on which 'update-all' is
+	// run, or false if the job is not configured.
+	GetCronSchedule(ctx context.Context) (string, bool, error)
+
+	// ChangeCronSchedule configures the job running 'update-all' to run on the
+	// given cron expression.
+	ChangeCronSchedule(ctx context.Context, expr string) error
+
+	// RemoveCronSchedule removes the job running 'update-all'.
+	RemoveCronSchedule(ctx context.Context) error
 }
 
 type cronHelper struct {
 	logger     log.TraceLogger
+	user       common.UserProvider
 	fileSystem common.FileSystem
 	scheduler  core.CronScheduler
+	daemon     daemon.DaemonProvider
+
+	// The cron expression of a newly configured job.
+	defaultSchedule string
 }
 
+// NewCronHelper creates a CronHelper. If 'd' is nil (i.e. the platform has no
+// supported daemon manager), updates are always scheduled with cron. New jobs
+// run on 'defaultSchedule'.
 func NewCronHelper(
 	l log.TraceLogger,
+	u common.UserProvider,
 	fs common.FileSystem,
 	s core.CronScheduler,
+	d daemon.DaemonProvider,
+	defaultSchedule string,
 ) CronHelper {
 	return &cronHelper{
-		logger:     l,
-		fileSystem: fs,
-		scheduler:  s,
+		logger:          l,
+		user:            u,
+		fileSystem:      fs,
+		scheduler:       s,
+		daemon:          d,
+		defaultSchedule: defaultSchedule,
 	}
 }
 
-func (c *cronHelper) SetCronSchedule(ctx context.Context) error {
+func (c *cronHelper) schedulerEnabled(ctx context.Context) (bool, error) {
+	user, err := c.user.CurrentUser()
+	if err != nil {
+		return false, c.logger.Errorf(ctx, "failed to get current user: %w", err)
+	}
+	schedulerEnabled, err := c.fileSystem.FileExists(
+		filepath.Join(core.SchedulerDir(user), scheduler.EnabledFilename))
+	if err != nil {
+		return false, c.logger.Errorf(ctx, "could not determine whether the scheduler is enabled: %w", err)
+	}
+	return schedulerEnabled, nil
+}
+
+func (c *cronHelper) useTimers(ctx context.Context) bool {
+	return c.daemon != nil && c.daemon.TimersAvailable(ctx)
+}
+
+func (c *cronHelper) timerScheduleFile(ctx context.Context) (string, error) {
+	user, err := c.user.CurrentUser()
+	if err != nil {
+		return "", c.logger.Errorf(ctx, "failed to get current user: %w", err)
+	}
+	return core.TimerScheduleFile(user), nil
+}
+
+func (c *cronHelper) getTimerSchedule(ctx context.Context) (string, bool, error) {
+	filename, err := c.timerScheduleFile(ctx)
+	if err != nil {
+		return "", false, err
+	}
+
+	lines, err := c.fileSystem.ReadFileLines(filename)
+	if err != nil {
+		return "", false, c.logger.Errorf(ctx, "failed to read timer schedule: %w", err)
+	}
+
+	for _, line := range lines {
+		if expr := strings.TrimSpace(line); expr != "" {
+			return expr, true, nil
+		}
+	}
+
+	return "", false, nil
+}
+
+func (c *cronHelper) setTimer(ctx context.Context, expr string, force bool) error {
 	pathToExec, err := c.fileSystem.GetLocalExecutable("git-bundle-server")
 	if err != nil {
 		return c.logger.Errorf(ctx, "failed to get executable: %w", err)
 	}
 
-	err = c.scheduler.AddJob(ctx, core.CronDaily, pathToExec, []string{"update-all"})
+	cronSchedule, err := core.ParseCronSchedule(expr)
+	if err != nil {
+		return c.logger.Error(ctx, err)
+	}
+	calendar, err := daemon.ParseCalendarSchedule(string(cronSchedule))
+	if err != nil {
+		return c.logger.Error(ctx, err)
+	}
+
+	config := &daemon.DaemonConfig{
+		Label:       UpdateTimerLabel,
+		Description: "Git Bundle Server scheduled update",
+		Program:     pathToExec,
+		Arguments:   []string{"update-all"},
+		Environment: DataRootEnvironment(),
+	}
+	err = c.daemon.CreateTimer(ctx, config, calendar, force)
+	if err != nil {
+		return c.logger.Errorf(ctx, "failed to set timer schedule: %w", err)
+	}
+
+	filename, err := c.timerScheduleFile(ctx)
+	if err != nil {
+		return err
+	}
+	err = c.fileSystem.WriteFile(filename, []byte(string(cronSchedule)+"\n"))
+	if err != nil {
+		return c.logger.Errorf(ctx, "failed to save timer schedule: %w", err)
+	}
+
+	return nil
+}
+
+func (c *cronHelper) setJob(ctx context.Context, schedule string) error {
+	pathToExec, err := c.fileSystem.GetLocalExecutable("git-bundle-server")
+	if err != nil {
+		return c.logger.Errorf(ctx, "failed to get executable: %w", err)
+	}
+
+	cronSchedule, err := core.ParseCronSchedule(schedule)
+	if err != nil {
+		return c.logger.Error(ctx, err)
+	}
+
+	// cron doesn't run jobs with our environment, so the data locations are
+	// passed as options
+	args := append(DataRootArgs(), "update-all")
+	err = c.scheduler.SetJob(ctx, cronSchedule, pathToExec, args)
 	if err != nil {
 		return c.logger.Errorf(ctx, "failed to set cron schedule: %w", err)
 	}
 
 	return nil
 }
+
+func (c *cronHelper) SetCronSchedule(ctx context.Context) error {
+	// If the built-in scheduler daemon is enabled, it runs the updates instead
+	// of cron.
+	schedulerEnabled, err := c.schedulerEnabled(ctx)
+	if err != nil {
+		return err
+	} else if schedulerEnabled {
+		return nil
+	}
+
+	if c.useTimers(ctx) {
+		expr, exists, err := c.getTimerSchedule(ctx)
+		if err != nil {
+			return err
+		} else if exists {
+			return c.setTimer(ctx, expr, false)
+		}
+
+		// Take over the schedule of an existing cron job. Cron may be
+		// unavailable altogether, so failing to read the crontab isn't fatal.
+		expr = c.defaultSchedule
+		schedule, cronExists, err := c.scheduler.GetJob(ctx)
+		if err == nil && cronExists {
+			expr = string(schedule)
+		}
+
+		err = c.setTimer(ctx, expr, true)
+		if err != nil {
+			return err
+		}
+
+		if cronExists {
+			return c.removeCronJob(ctx)
+		}
+		return nil
+	}
+
+	schedule, exists, err := c.scheduler.GetJob(ctx)
+	if err != nil {
+		return c.logger.Errorf(ctx, "failed to get cron schedule: %w", err)
+	} else if !exists {
+		return c.setJob(ctx, c.defaultSchedule)
+	}
+
+	return c.setJob(ctx, string(schedule))
+}
+
+func (c *cronHelper) GetCronSchedule(ctx context.Context) (string, bool, error) {
+	if c.useTimers(ctx) {
+		return c.getTimerSchedule(ctx)
+	}
+
+	schedule, exists, err := c.scheduler.GetJob(ctx)
+	if err != nil {
+		return "", false, c.logger.Errorf(ctx, "failed to get cron schedule: %w", err)
+	}
+	return string(schedule), exists, nil
+}
+
+func (c *cronHelper) ChangeCronSchedule(ctx context.Context, expr string) error {
+	schedulerEnabled, err := c.schedulerEnabled(ctx)
+	if err != nil {
+		return err
+	} else if schedulerEnabled {
+		return c.logger.Errorf(ctx, "updates are run by the scheduler daemon; "+
+			"use 'git-bundle-server scheduler stop --remove' to use cron instead")
+	}
+
+	if c.useTimers(ctx) {
+		return c.setTimer(ctx, expr, true)
+	}
+
+	return c.setJob(ctx, expr)
+}
+
+// removeCronJob removes the crontab entry running 'update-all'.
+func (c *cronHelper) removeCronJob(ctx context.Context) error {
+	err := c.scheduler.RemoveJob(ctx)
+	if err != nil {
+		return c.logger.Errorf(ctx, "failed to remove cron schedule: %w", err)
+	}
+
+	return nil
+}
+
+func (c *cronHelper) RemoveCronSchedule(ctx context.Context) error {
+	if !c.useTimers(ctx) {
+		return c.removeCronJob(ctx)
+	}
+
+	_, exists, err := c.getTimerSchedule(ctx)
+	if err != nil {
+		return err
+	} else if !exists {
+		return nil
+	}
+
+	err = c.daemon.RemoveTimer(ctx, UpdateTimerLabel)
+	if err != nil {
+		return c.logger.Errorf(ctx, "failed to remove timer: %w", err)
+	}
+
+	filename, err := c.timerScheduleFile(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = c.fileSystem.DeleteFile(filename)
+	if err != nil {
+		return c.logger.Errorf(ctx, "failed to remove timer schedule: %w", err)
+	}
+
+	return nil
+}
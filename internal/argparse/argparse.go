@@ -143,6 +143,33 @@ func (a *argParser) PositionalList(name string, description string, required boo
 	return arg
 }
 
+// stringListValue is a flag.Value that accumulates the values of a repeated
+// flag (e.g. '--opt a --opt b').
+type stringListValue []string
+
+func (s *stringListValue) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringListValue) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+func (s *stringListValue) Get() any {
+	return []string(*s)
+}
+
+func (a *argParser) StringListVar(arg *[]string, name string, usage string) {
+	a.FlagSet.Var((*stringListValue)(arg), name, usage)
+}
+
+func (a *argParser) StringList(name string, usage string) *[]string {
+	arg := &[]string{}
+	a.StringListVar(arg, name, usage)
+	return arg
+}
+
 func (a *argParser) Parse(ctx context.Context, args []string) {
 	if a.parsed {
 		// Do nothing if we've already parsed args
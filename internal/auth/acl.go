@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/git-ecosystem/git-bundle-server/pkg/auth"
+)
+
+// The prefix identifying a group, rather than a user, in an ACL.
+const aclGroupPrefix string = "@"
+
+// Authorize users with credentials matching an entry of an htpasswd-style file
+// or an inline list of users, restricting each user to the routes their ACL
+// entries (or those of their groups) allow.
+type aclAuth struct {
+	// Exactly one of the following is set.
+	htpasswd *htpasswdAuth
+	users    *htpasswdUsers
+
+	// The groups each user belongs to.
+	userGroups map[string][]string
+
+	// The route patterns each user or group ('@<group>') can access.
+	acl map[string][]string
+}
+
+type aclAuthParams struct {
+	Htpasswd string              `json:"htpasswd"`
+	Users    map[string]string   `json:"users"`
+	Groups   map[string][]string `json:"groups"`
+	ACL      map[string][]string `json:"acl"`
+}
+
+func NewACLAuth(rawParameters json.RawMessage) (auth.AuthMiddleware, error) {
+	if len(rawParameters) == 0 {
+		return nil, fmt.Errorf("parameters JSON must exist")
+	}
+
+	var params aclAuthParams
+	err := json.Unmarshal(rawParameters, &params)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &aclAuth{
+		userGroups: map[string][]string{},
+		acl:        params.ACL,
+	}
+
+	// Configure the users
+	if (params.Htpasswd == "") == (params.Users == nil) {
+		return nil, fmt.Errorf("exactly one of 'htpasswd' and 'users' must be specified")
+	} else if params.Htpasswd != "" {
+		a.htpasswd, err = newHtpasswdAuth(params.Htpasswd)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		a.users = newHtpasswdUsers()
+		for username, hashStr := range params.Users {
+			err = a.users.add(username, hashStr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid user '%s': %w", username, err)
+			}
+		}
+	}
+
+	// Configure the groups
+	for group, members := range params.Groups {
+		if group == "" || strings.HasPrefix(group, aclGroupPrefix) {
+			return nil, fmt.Errorf("invalid group name '%s'", group)
+		}
+		for _, member := range members {
+			a.userGroups[member] = append(a.userGroups[member], group)
+		}
+	}
+
+	// Validate the ACL
+	if len(params.ACL) == 0 {
+		return nil, fmt.Errorf("'acl' must contain at least one entry")
+	}
+	for principal, patterns := range params.ACL {
+		group, isGroup := strings.CutPrefix(principal, aclGroupPrefix)
+		if _, exists := params.Groups[group]; isGroup && !exists {
+			return nil, fmt.Errorf("ACL entry references unknown group '%s'", group)
+		}
+
+		for _, pattern := range patterns {
+			err := validateRoutePattern(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid route pattern in ACL entry '%s': %w", principal, err)
+			}
+		}
+	}
+
+	return a, nil
+}
+
+// validateRoutePattern checks that the pattern is a valid 'path.Match()'
+// pattern matching routes of the form '<owner>/<repo>'.
+func validateRoutePattern(pattern string) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("malformed pattern '%s'", pattern)
+	}
+	if strings.Count(pattern, "/") != 1 {
+		return fmt.Errorf("pattern '%s' must have the form '<owner>/<repo>'", pattern)
+	}
+	return nil
+}
+
+// matchRoute returns whether the route of a request matches any of the
+// patterns.
+func matchRoute(patterns []string, owner string, repo string) bool {
+	route := owner + "/" + repo
+	for _, pattern := range patterns {
+		// Patterns are validated on initialization, so ignore the error
+		if matched, _ := path.Match(pattern, route); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *aclAuth) currentUsers() *htpasswdUsers {
+	if a.htpasswd != nil {
+		return a.htpasswd.currentUsers()
+	}
+	return a.users
+}
+
+// canAccess returns whether the user, or one of their groups, may access the
+// route.
+func (a *aclAuth) canAccess(username string, owner string, repo string) bool {
+	if matchRoute(a.acl[username], owner, repo) {
+		return true
+	}
+	for _, group := range a.userGroups[username] {
+		if matchRoute(a.acl[aclGroupPrefix+group], owner, repo) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *aclAuth) Authorize(r *http.Request, owner string, repo string) auth.AuthResult {
+	username, password, ok := r.BasicAuth()
+	if ok {
+		if a.currentUsers().authenticate(username, password) && a.canAccess(username, owner, repo) {
+			identity := auth.Identity{Name: username, Method: "basic"}
+			if groups := a.userGroups[username]; len(groups) > 0 {
+				identity.Attributes = map[string]string{"groups": strings.Join(groups, ",")}
+			}
+			return auth.AllowAs(identity)
+		} else {
+			// Return a 404 status whether the credentials are invalid or the
+			// user can't access the route, so we don't indirectly reveal which
+			// repositories are configured in the bundle server.
+			return auth.Deny(404)
+		}
+	}
+
+	return auth.Deny(401, basicAuthChallenge)
+}
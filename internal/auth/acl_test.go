@@ -0,0 +1,113 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+// Users 'alice', 'bob', and 'carol', all with password 'test123'.
+var aclParameters = `{
+	"users": {
+		"alice": "{SHA256}ecd71870d1963316a97e3ac3408c9835ad8cf0f3c1bc703527c30265534f75ae",
+		"bob": "{SHA256}ecd71870d1963316a97e3ac3408c9835ad8cf0f3c1bc703527c30265534f75ae",
+		"carol": "{SHA256}ecd71870d1963316a97e3ac3408c9835ad8cf0f3c1bc703527c30265534f75ae"
+	},
+	"groups": {
+		"maintainers": ["alice", "bob"]
+	},
+	"acl": {
+		"@maintainers": ["myorg/*"],
+		"carol": ["team/app", "public/*"]
+	}
+}`
+
+var aclAuthTests = []struct {
+	title string
+
+	// Inputs
+	username string
+	password string
+	owner    string
+	repo     string
+
+	// Expected outputs
+	expectedDoExit       bool
+	expectedResponseCode int
+}{
+	{"Group member can access matching route", "alice", "test123", "myorg", "repo", false, 200},
+	{"Group member can't access other route", "bob", "test123", "team", "app", true, 404},
+	{"User can access exact route", "carol", "test123", "team", "app", false, 200},
+	{"User can access route matching glob", "carol", "test123", "public", "docs", false, 200},
+	{"User can't access other route", "carol", "test123", "myorg", "repo", true, 404},
+	{"Incorrect password returns 404", "alice", "test", "myorg", "repo", true, 404},
+	{"Unknown user returns 404", "dave", "test123", "myorg", "repo", true, 404},
+}
+
+func Test_ACLAuth(t *testing.T) {
+	middleware, err := auth.NewACLAuth([]byte(aclParameters))
+	assert.Nil(t, err)
+
+	for _, tt := range aclAuthTests {
+		t.Run(tt.title, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tt.owner+"/"+tt.repo, nil)
+			assert.Nil(t, err)
+			req.SetBasicAuth(tt.username, tt.password)
+
+			result := middleware.Authorize(req, tt.owner, tt.repo)
+
+			wExpect := httptest.NewRecorder()
+			if tt.expectedDoExit {
+				wExpect.HeaderMap = map[string][]string{} //lint:ignore SA1019 set headers manually for test
+				wExpect.WriteHeader(tt.expectedResponseCode)
+			}
+
+			wActual := httptest.NewRecorder()
+			actualDoExit := result.ApplyResult(wActual)
+
+			assert.Equal(t, tt.expectedDoExit, actualDoExit)
+			assert.Equal(t, wExpect, wActual)
+		})
+	}
+
+	t.Run("No auth returns 401", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "myorg/repo", nil)
+		assert.Nil(t, err)
+
+		result := middleware.Authorize(req, "myorg", "repo")
+
+		w := httptest.NewRecorder()
+		assert.True(t, result.ApplyResult(w))
+		assert.Equal(t, 401, w.Code)
+		assert.Equal(t, `Basic realm="restricted", charset="UTF-8"`, w.Header().Get("WWW-Authenticate"))
+	})
+}
+
+var aclInitTests = []struct {
+	title      string
+	parameters string
+}{
+	{"Missing parameters", ""},
+	{"Missing users", `{ "acl": { "alice": ["*/*"] } }`},
+	{
+		"Both users and htpasswd file",
+		`{ "htpasswd": "/etc/htpasswd", "users": {}, "acl": { "alice": ["*/*"] } }`,
+	},
+	{"Missing ACL", `{ "users": {} }`},
+	{"Unknown group", `{ "users": {}, "acl": { "@admins": ["*/*"] } }`},
+	{"Malformed pattern", `{ "users": {}, "acl": { "alice": ["myorg/[a-"] } }`},
+	{"Pattern without owner", `{ "users": {}, "acl": { "alice": ["repo"] } }`},
+	{"Invalid hash", `{ "users": { "alice": "test123" }, "acl": { "alice": ["*/*"] } }`},
+}
+
+func Test_ACLAuth_InvalidParameters(t *testing.T) {
+	for _, tt := range aclInitTests {
+		t.Run(tt.title, func(t *testing.T) {
+			_, err := auth.NewACLAuth([]byte(tt.parameters))
+			assert.NotNil(t, err)
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/pkg/auth"
+)
+
+type cachedDecision struct {
+	result  auth.AuthResult
+	expires time.Time
+}
+
+// DecisionCache holds the decisions of an auth middleware for a limited time,
+// keyed by a hash of the request properties they were made on. Hashing the
+// properties keeps credentials out of memory.
+type DecisionCache struct {
+	ttl        time.Duration
+	maxEntries int
+
+	lock      sync.Mutex
+	decisions map[[sha256.Size]byte]cachedDecision
+}
+
+// NewDecisionCache creates a cache keeping each decision for 'ttl', holding at
+// most 'maxEntries' decisions.
+func NewDecisionCache(ttl time.Duration, maxEntries int) *DecisionCache {
+	return &DecisionCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		decisions:  map[[sha256.Size]byte]cachedDecision{},
+	}
+}
+
+// Get returns the unexpired decision cached for the key, if any.
+func (c *DecisionCache) Get(key [sha256.Size]byte) (auth.AuthResult, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	cached, found := c.decisions[key]
+	if !found || !time.Now().Before(cached.expires) {
+		return auth.AuthResult{}, false
+	}
+	return cached.result, true
+}
+
+// Add caches the decision for the key. Failures of the middleware (results
+// applied as a 500 response, e.g. because an authorization service is
+// unreachable) are not cached.
+func (c *DecisionCache) Add(key [sha256.Size]byte, result auth.AuthResult) {
+	if result.Status() == http.StatusInternalServerError {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := time.Now()
+	if len(c.decisions) >= c.maxEntries {
+		for cachedKey, cached := range c.decisions {
+			if !now.Before(cached.expires) {
+				delete(c.decisions, cachedKey)
+			}
+		}
+		if len(c.decisions) >= c.maxEntries {
+			// Still full of live decisions; start over rather than track usage
+			c.decisions = map[[sha256.Size]byte]cachedDecision{}
+		}
+	}
+	c.decisions[key] = cachedDecision{result: result, expires: now.Add(c.ttl)}
+}
+
+// decisionHeaderProvider is implemented by middlewares that decide on request
+// headers other than 'Authorization'.
+type decisionHeaderProvider interface {
+	DecisionHeaders() []string
+}
+
+// DecisionHeaders returns the headers other than 'Authorization' that the
+// decisions of a middleware depend on, so that a cache can tell apart the
+// requests the middleware may decide differently on.
+func DecisionHeaders(middleware auth.AuthMiddleware) []string {
+	if provider, ok := middleware.(decisionHeaderProvider); ok {
+		return provider.DecisionHeaders()
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package auth_test
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/auth"
+	pkgauth "github.com/git-ecosystem/git-bundle-server/pkg/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func testCacheKey(i int) [sha256.Size]byte {
+	return sha256.Sum256([]byte(fmt.Sprintf("request %d", i)))
+}
+
+func Test_DecisionCache(t *testing.T) {
+	t.Run("Decisions are cached per key", func(t *testing.T) {
+		cache := auth.NewDecisionCache(time.Minute, 10)
+		cache.Add(testCacheKey(1), pkgauth.Allow())
+		cache.Add(testCacheKey(2), pkgauth.Deny(403))
+
+		result, found := cache.Get(testCacheKey(1))
+		assert.True(t, found)
+		assert.Equal(t, 200, result.Status())
+
+		result, found = cache.Get(testCacheKey(2))
+		assert.True(t, found)
+		assert.Equal(t, 403, result.Status())
+
+		_, found = cache.Get(testCacheKey(3))
+		assert.False(t, found)
+	})
+
+	t.Run("Failures are not cached", func(t *testing.T) {
+		cache := auth.NewDecisionCache(time.Minute, 10)
+		cache.Add(testCacheKey(1), pkgauth.AuthResult{})
+
+		_, found := cache.Get(testCacheKey(1))
+		assert.False(t, found)
+	})
+
+	t.Run("Decisions expire", func(t *testing.T) {
+		cache := auth.NewDecisionCache(10*time.Millisecond, 10)
+		cache.Add(testCacheKey(1), pkgauth.Allow())
+		time.Sleep(20 * time.Millisecond)
+
+		_, found := cache.Get(testCacheKey(1))
+		assert.False(t, found)
+	})
+
+	t.Run("Full cache is cleared", func(t *testing.T) {
+		cache := auth.NewDecisionCache(time.Minute, 3)
+		for i := 0; i < 4; i++ {
+			cache.Add(testCacheKey(i), pkgauth.Allow())
+		}
+
+		_, found := cache.Get(testCacheKey(0))
+		assert.False(t, found)
+		_, found = cache.Get(testCacheKey(3))
+		assert.True(t, found)
+	})
+}
+
+func Test_DecisionHeaders(t *testing.T) {
+	newNetworkAuth := func(parameters string) pkgauth.AuthMiddleware {
+		middleware, err := auth.NewNetworkAuth([]byte(parameters))
+		if err != nil {
+			panic(err)
+		}
+		return middleware
+	}
+	direct := newNetworkAuth(`{ "allow": ["192.0.2.0/24"] }`)
+	proxied := newNetworkAuth(`{ "allow": ["192.0.2.0/24"], "trustedProxies": ["203.0.113.1/32"] }`)
+	forwarded := newNetworkAuth(`{ "allow": ["192.0.2.0/24"], "trustedProxies": ["203.0.113.1/32"], "forwardedHeader": "Forwarded" }`)
+
+	assert.Empty(t, auth.DecisionHeaders(direct))
+	assert.Equal(t, []string{"X-Forwarded-For"}, auth.DecisionHeaders(proxied))
+	assert.Equal(t, []string{"Forwarded"}, auth.DecisionHeaders(forwarded))
+
+	chain := auth.NewAuthChain([]pkgauth.AuthMiddleware{direct, proxied, forwarded, proxied}, true)
+	assert.Equal(t, []string{"X-Forwarded-For", "Forwarded"}, auth.DecisionHeaders(chain))
+}
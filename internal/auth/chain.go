@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/git-ecosystem/git-bundle-server/pkg/auth"
+)
+
+// resultRecorder is an http.ResponseWriter capturing the status and headers an
+// AuthResult applies, so that the results of several middlewares can be
+// combined.
+type resultRecorder struct {
+	header http.Header
+	code   int
+}
+
+func newResultRecorder() *resultRecorder {
+	return &resultRecorder{header: http.Header{}, code: http.StatusOK}
+}
+
+func (r *resultRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *resultRecorder) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (r *resultRecorder) WriteHeader(code int) {
+	r.code = code
+}
+
+func (r *resultRecorder) headers() []auth.Header {
+	headers := []auth.Header{}
+	for key, values := range r.header {
+		for _, value := range values {
+			headers = append(headers, auth.Header{Key: key, Value: value})
+		}
+	}
+	return headers
+}
+
+func containsHeader(headers []auth.Header, header auth.Header) bool {
+	for _, h := range headers {
+		if h == header {
+			return true
+		}
+	}
+	return false
+}
+
+// recordedResult is the outcome of applying an AuthResult.
+type recordedResult struct {
+	deny    bool
+	invalid bool
+	*resultRecorder
+}
+
+func recordResult(result auth.AuthResult) recordedResult {
+	recorder := newResultRecorder()
+	deny := result.ApplyResult(recorder)
+	return recordedResult{
+		deny:           deny,
+		invalid:        deny && (recorder.code < 400 || recorder.code > 499),
+		resultRecorder: recorder,
+	}
+}
+
+// Authorize requests with a sequence of middlewares: if 'requireAll' is false,
+// a request is allowed by the first middleware that allows it; otherwise, it is
+// only allowed if all middlewares allow it.
+type authChain struct {
+	links      []auth.AuthMiddleware
+	requireAll bool
+}
+
+func NewAuthChain(links []auth.AuthMiddleware, requireAll bool) auth.AuthMiddleware {
+	return &authChain{
+		links:      links,
+		requireAll: requireAll,
+	}
+}
+
+// DecisionHeaders returns the headers any of the links decides on.
+func (a *authChain) DecisionHeaders() []string {
+	headers := []string{}
+	for _, link := range a.links {
+		for _, header := range DecisionHeaders(link) {
+			if !containsString(headers, header) {
+				headers = append(headers, header)
+			}
+		}
+	}
+	return headers
+}
+
+func (a *authChain) Authorize(r *http.Request, owner string, repo string) auth.AuthResult {
+	if a.requireAll {
+		return a.authorizeAll(r, owner, repo)
+	}
+	return a.authorizeAny(r, owner, repo)
+}
+
+// authorizeAll denies the request with the first denial, or allows it with the
+// headers of all middlewares and the identity provided by the first middleware
+// that provided one, with the attributes of all identities.
+func (a *authChain) authorizeAll(r *http.Request, owner string, repo string) auth.AuthResult {
+	headers := []auth.Header{}
+	var identity *auth.Identity
+	for _, link := range a.links {
+		result := link.Authorize(r, owner, repo)
+		recorded := recordResult(result)
+		if recorded.deny {
+			return result
+		}
+		headers = append(headers, recorded.headers()...)
+
+		if linkIdentity := result.Identity(); linkIdentity == nil {
+			continue
+		} else if identity == nil {
+			identity = &auth.Identity{
+				Name:       linkIdentity.Name,
+				Method:     linkIdentity.Method,
+				Attributes: map[string]string{},
+			}
+		}
+		for key, value := range result.Identity().Attributes {
+			if _, exists := identity.Attributes[key]; !exists {
+				identity.Attributes[key] = value
+			}
+		}
+	}
+
+	if identity != nil {
+		return auth.AllowAs(*identity, headers...)
+	}
+	return auth.Allow(headers...)
+}
+
+// authorizeAny allows the request with the first allowing middleware. If none
+// allows it, the request is denied with a 401 status and the challenges of all
+// middlewares that responded with one, so the client can pick a way to
+// authenticate, or with the denial of the last middleware otherwise.
+func (a *authChain) authorizeAny(r *http.Request, owner string, repo string) auth.AuthResult {
+	var lastDenial auth.AuthResult
+	unauthorized := false
+	challenges := []auth.Header{}
+	for _, link := range a.links {
+		result := link.Authorize(r, owner, repo)
+		recorded := recordResult(result)
+		if !recorded.deny || recorded.invalid {
+			// Invalid results are passed on, so that they respond with an
+			// error rather than letting another middleware allow the request
+			return result
+		}
+
+		if recorded.code == http.StatusUnauthorized {
+			unauthorized = true
+			for _, header := range recorded.headers() {
+				// Middlewares using the same scheme (e.g. 'htpasswd' and 'acl')
+				// send the same challenge
+				if !containsHeader(challenges, header) {
+					challenges = append(challenges, header)
+				}
+			}
+		}
+		lastDenial = result
+	}
+
+	if unauthorized {
+		return auth.Deny(http.StatusUnauthorized, challenges...)
+	}
+	return lastDenial
+}
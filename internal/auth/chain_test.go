@@ -0,0 +1,180 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/auth"
+	pkgauth "github.com/git-ecosystem/git-bundle-server/pkg/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+// staticAuth is an AuthMiddleware returning a fixed result, counting its calls.
+type staticAuth struct {
+	result pkgauth.AuthResult
+	calls  int
+}
+
+func (a *staticAuth) Authorize(_ *http.Request, _ string, _ string) pkgauth.AuthResult {
+	a.calls++
+	return a.result
+}
+
+var (
+	allow         = func() pkgauth.AuthResult { return pkgauth.Allow() }
+	allowWithHdr  = func() pkgauth.AuthResult { return pkgauth.Allow(pkgauth.Header{Key: "X-Test", Value: "a"}) }
+	denyNotFound  = func() pkgauth.AuthResult { return pkgauth.Deny(404) }
+	denyForbidden = func() pkgauth.AuthResult { return pkgauth.Deny(403) }
+	denyBasic     = func() pkgauth.AuthResult {
+		return pkgauth.Deny(401, pkgauth.Header{Key: "WWW-Authenticate", Value: `Basic realm="restricted"`})
+	}
+	denyBearer = func() pkgauth.AuthResult {
+		return pkgauth.Deny(401, pkgauth.Header{Key: "WWW-Authenticate", Value: `Bearer realm="restricted"`})
+	}
+	invalid = func() pkgauth.AuthResult { return pkgauth.AuthResult{} }
+)
+
+var authChainTests = []struct {
+	title string
+
+	// Inputs
+	requireAll bool
+	links      []func() pkgauth.AuthResult
+
+	// Expected outputs
+	expectedResponseCode int
+	expectedHeaders      http.Header
+	expectedCalls        []int
+}{
+	{
+		"Any: first allow wins",
+		false,
+		[]func() pkgauth.AuthResult{denyForbidden, allowWithHdr, allow},
+		200,
+		http.Header{"X-Test": {"a"}},
+		[]int{1, 1, 0},
+	},
+	{
+		"Any: challenges are combined",
+		false,
+		[]func() pkgauth.AuthResult{denyForbidden, denyBasic, denyBearer},
+		401,
+		http.Header{"Www-Authenticate": {`Basic realm="restricted"`, `Bearer realm="restricted"`}},
+		[]int{1, 1, 1},
+	},
+	{
+		"Any: identical challenges are sent once",
+		false,
+		[]func() pkgauth.AuthResult{denyBasic, denyBearer, denyBasic},
+		401,
+		http.Header{"Www-Authenticate": {`Basic realm="restricted"`, `Bearer realm="restricted"`}},
+		[]int{1, 1, 1},
+	},
+	{
+		"Any: last denial without challenges",
+		false,
+		[]func() pkgauth.AuthResult{denyForbidden, denyNotFound},
+		404,
+		http.Header{},
+		[]int{1, 1},
+	},
+	{
+		"Any: invalid result stops the chain",
+		false,
+		[]func() pkgauth.AuthResult{invalid, allow},
+		500,
+		http.Header{},
+		[]int{1, 0},
+	},
+	{
+		"All: every link allows",
+		true,
+		[]func() pkgauth.AuthResult{allow, allowWithHdr},
+		200,
+		http.Header{"X-Test": {"a"}},
+		[]int{1, 1},
+	},
+	{
+		"All: first denial wins",
+		true,
+		[]func() pkgauth.AuthResult{allow, denyBasic, denyNotFound},
+		401,
+		http.Header{"Www-Authenticate": {`Basic realm="restricted"`}},
+		[]int{1, 1, 0},
+	},
+}
+
+func Test_AuthChain(t *testing.T) {
+	for _, tt := range authChainTests {
+		t.Run(tt.title, func(t *testing.T) {
+			links := []*staticAuth{}
+			middlewares := []pkgauth.AuthMiddleware{}
+			for _, result := range tt.links {
+				link := &staticAuth{result: result()}
+				links = append(links, link)
+				middlewares = append(middlewares, link)
+			}
+
+			req, err := http.NewRequest("GET", "test/repo", nil)
+			assert.Nil(t, err)
+
+			chain := auth.NewAuthChain(middlewares, tt.requireAll)
+			result := chain.Authorize(req, "test", "repo")
+
+			w := httptest.NewRecorder()
+			doExit := result.ApplyResult(w)
+
+			assert.Equal(t, tt.expectedResponseCode != 200, doExit)
+			assert.Equal(t, tt.expectedResponseCode, w.Code)
+			assert.Equal(t, tt.expectedHeaders, w.Header())
+			for i, link := range links {
+				assert.Equal(t, tt.expectedCalls[i], link.calls, "calls of link %d", i)
+			}
+		})
+	}
+}
+
+func Test_AuthChain_Identity(t *testing.T) {
+	network := &staticAuth{result: pkgauth.Allow()}
+	basic := &staticAuth{result: pkgauth.AllowAs(pkgauth.Identity{
+		Name:       "alice",
+		Method:     "basic",
+		Attributes: map[string]string{"groups": "admins", "team": "core"},
+	})}
+	jwt := &staticAuth{result: pkgauth.AllowAs(pkgauth.Identity{
+		Name:       "alice@example.com",
+		Method:     "jwt",
+		Attributes: map[string]string{"issuer": "https://idp.example.com", "team": "other"},
+	})}
+
+	req, err := http.NewRequest("GET", "test/repo", nil)
+	assert.Nil(t, err)
+
+	t.Run("'all' chain keeps the first identity and merges attributes", func(t *testing.T) {
+		chain := auth.NewAuthChain([]pkgauth.AuthMiddleware{network, basic, jwt}, true)
+		result := chain.Authorize(req, "test", "repo")
+		assert.Equal(t, &pkgauth.Identity{
+			Name:   "alice",
+			Method: "basic",
+			Attributes: map[string]string{
+				"groups": "admins",
+				"team":   "core",
+				"issuer": "https://idp.example.com",
+			},
+		}, result.Identity())
+	})
+
+	t.Run("'all' chain without identities", func(t *testing.T) {
+		chain := auth.NewAuthChain([]pkgauth.AuthMiddleware{network, network}, true)
+		result := chain.Authorize(req, "test", "repo")
+		assert.Nil(t, result.Identity())
+	})
+
+	t.Run("'any' chain uses the identity of the allowing link", func(t *testing.T) {
+		denied := &staticAuth{result: pkgauth.Deny(404)}
+		chain := auth.NewAuthChain([]pkgauth.AuthMiddleware{denied, jwt, basic}, false)
+		result := chain.Authorize(req, "test", "repo")
+		assert.Equal(t, "alice@example.com", result.Identity().Name)
+	})
+}
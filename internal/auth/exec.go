@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/pkg/auth"
+)
+
+// The time a command has to exit after its decision timed out and it was
+// killed, before the web server stops waiting for its output.
+const execAuthWaitDelay = time.Second
+
+type execAuthParams struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+	externalAuthParams
+}
+
+// NewExecAuth creates an AuthMiddleware running a command for each request,
+// which reads the request metadata as JSON on stdin and writes its decision as
+// JSON to stdout. The command's stderr is forwarded to that of the web server.
+func NewExecAuth(rawParameters json.RawMessage) (auth.AuthMiddleware, error) {
+	if len(rawParameters) == 0 {
+		return nil, fmt.Errorf("parameters JSON must exist")
+	}
+
+	var params execAuthParams
+	err := json.Unmarshal(rawParameters, &params)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.Command == "" {
+		return nil, fmt.Errorf("command must be specified")
+	}
+	command, err := exec.LookPath(params.Command)
+	if err != nil {
+		return nil, fmt.Errorf("invalid command: %w", err)
+	}
+
+	decide := func(ctx context.Context, request []byte) ([]byte, error) {
+		cmd := exec.CommandContext(ctx, command, params.Args...)
+		cmd.Stdin = bytes.NewReader(request)
+		cmd.Stderr = os.Stderr
+		cmd.WaitDelay = execAuthWaitDelay
+		return cmd.Output()
+	}
+
+	a, err := newExternalAuth(params.externalAuthParams, decide)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
@@ -0,0 +1,135 @@
+package auth_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+// An authorizer allowing 'test/repo' with the token 'secret', and echoing the
+// request it received to stderr.
+const execAuthScript = `#!/bin/sh
+request=$(cat)
+echo "$request" >&2
+case "$request" in
+*'"owner":"test","repo":"repo"'*'"Authorization":["Bearer secret"]'*)
+	echo '{"allow": true, "identity": {"name": "alice", "method": "token"}}' ;;
+*'"Authorization"'*)
+	echo '{"allow": false}' ;;
+*)
+	echo '{"allow": false, "status": 401, "headers": {"WWW-Authenticate": ["Bearer"]}}' ;;
+esac
+`
+
+func writeExecAuthScript(t *testing.T, script string) string {
+	path := filepath.Join(t.TempDir(), "authorizer.sh")
+	err := os.WriteFile(path, []byte(script), 0o755)
+	assert.Nil(t, err)
+	return path
+}
+
+var execAuthTests = []struct {
+	title string
+
+	// Inputs
+	route         string
+	authorization string
+
+	// Expected outputs
+	expectedCode     int
+	expectedHeaders  http.Header
+	expectedIdentity string
+}{
+	{"Allowed token", "test/repo", "Bearer secret", 200, http.Header{}, "alice"},
+	{"Allowed token on other route", "test/other", "Bearer secret", 404, http.Header{}, ""},
+	{"Invalid token", "test/repo", "Bearer wrong", 404, http.Header{}, ""},
+	{
+		"No token",
+		"test/repo",
+		"",
+		401,
+		http.Header{"Www-Authenticate": {"Bearer"}},
+		"",
+	},
+}
+
+func Test_ExecAuth(t *testing.T) {
+	script := writeExecAuthScript(t, execAuthScript)
+	middleware, err := auth.NewExecAuth([]byte(fmt.Sprintf(`{ "command": "%s" }`, script)))
+	assert.Nil(t, err)
+
+	for _, tt := range execAuthTests {
+		t.Run(tt.title, func(t *testing.T) {
+			owner, repo, _ := strings.Cut(tt.route, "/")
+			req, err := http.NewRequest("GET", tt.route, nil)
+			assert.Nil(t, err)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			result := middleware.Authorize(req, owner, repo)
+
+			w := httptest.NewRecorder()
+			doExit := result.ApplyResult(w)
+			assert.Equal(t, tt.expectedCode != 200, doExit)
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.Equal(t, tt.expectedHeaders, w.Header())
+			if tt.expectedIdentity != "" {
+				assert.Equal(t, tt.expectedIdentity, result.Identity().Name)
+			} else {
+				assert.Nil(t, result.Identity())
+			}
+		})
+	}
+}
+
+func Test_ExecAuth_Failure(t *testing.T) {
+	for title, script := range map[string]string{
+		"Command fails":      "#!/bin/sh\nexit 1\n",
+		"Invalid JSON":       "#!/bin/sh\necho 'allow'\n",
+		"Invalid status":     "#!/bin/sh\necho '{\"allow\": false, \"status\": 302}'\n",
+		"Decision times out": "#!/bin/sh\nexec sleep 5\n",
+	} {
+		t.Run(title, func(t *testing.T) {
+			path := writeExecAuthScript(t, script)
+			middleware, err := auth.NewExecAuth([]byte(fmt.Sprintf(`{ "command": "%s", "timeout": "100ms" }`, path)))
+			assert.Nil(t, err)
+
+			req, err := http.NewRequest("GET", "test/repo", nil)
+			assert.Nil(t, err)
+			result := middleware.Authorize(req, "test", "repo")
+
+			// The middleware fails closed
+			w := httptest.NewRecorder()
+			assert.True(t, result.ApplyResult(w))
+			assert.Equal(t, 500, w.Code)
+		})
+	}
+}
+
+var execInitTests = []struct {
+	title      string
+	parameters string
+}{
+	{"Missing parameters", ""},
+	{"Missing command", `{ "args": ["--check"] }`},
+	{"Unknown command", `{ "command": "/does/not/exist" }`},
+	{"Invalid timeout", `{ "command": "true", "timeout": "soon" }`},
+	{"Invalid cache TTL", `{ "command": "true", "cacheTTL": "-1s" }`},
+}
+
+func Test_ExecAuth_InvalidParameters(t *testing.T) {
+	for _, tt := range execInitTests {
+		t.Run(tt.title, func(t *testing.T) {
+			_, err := auth.NewExecAuth([]byte(tt.parameters))
+			assert.NotNil(t, err)
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/pkg/auth"
+)
+
+// The default time an external authorizer has to make a decision.
+const defaultExternalAuthTimeout = 5 * time.Second
+
+// The maximum number of decisions cached by an external auth middleware.
+const maxCachedExternalDecisions = 4096
+
+// The request headers sent to an external authorizer by default.
+var defaultExternalAuthHeaders = []string{"Authorization"}
+
+// The request metadata sent to an external authorizer.
+type externalAuthRequest struct {
+	Method            string              `json:"method"`
+	Path              string              `json:"path"`
+	Owner             string              `json:"owner"`
+	Repo              string              `json:"repo"`
+	RemoteAddr        string              `json:"remoteAddr"`
+	Headers           map[string][]string `json:"headers"`
+	ClientCertificate *externalAuthCert   `json:"clientCertificate,omitempty"`
+}
+
+type externalAuthCert struct {
+	Subject  string `json:"subject"`
+	SPIFFEID string `json:"spiffeId,omitempty"`
+}
+
+// The decision of an external authorizer.
+type externalAuthResponse struct {
+	Allow    bool                  `json:"allow"`
+	Status   int                   `json:"status"`
+	Headers  map[string][]string   `json:"headers"`
+	Identity *externalAuthIdentity `json:"identity"`
+}
+
+type externalAuthIdentity struct {
+	Name       string            `json:"name"`
+	Method     string            `json:"method"`
+	Attributes map[string]string `json:"attributes"`
+}
+
+// result converts the decision to an AuthResult.
+func (d *externalAuthResponse) result() (auth.AuthResult, error) {
+	headers := []auth.Header{}
+	for key, values := range d.Headers {
+		for _, value := range values {
+			headers = append(headers, auth.Header{Key: key, Value: value})
+		}
+	}
+
+	if d.Allow {
+		if d.Identity == nil {
+			return auth.Allow(headers...), nil
+		}
+		return auth.AllowAs(auth.Identity{
+			Name:       d.Identity.Name,
+			Method:     d.Identity.Method,
+			Attributes: d.Identity.Attributes,
+		}, headers...), nil
+	}
+
+	switch {
+	case d.Status == 0:
+		// Don't indirectly reveal which repositories are configured in the
+		// bundle server unless the authorizer chooses to.
+		return auth.Deny(404, headers...), nil
+	case d.Status < 400 || d.Status > 499:
+		return auth.AuthResult{}, fmt.Errorf("invalid denial status %d (must be 4XX)", d.Status)
+	default:
+		return auth.Deny(d.Status, headers...), nil
+	}
+}
+
+type externalAuthParams struct {
+	Timeout  string   `json:"timeout"`
+	Headers  []string `json:"headers"`
+	CacheTTL string   `json:"cacheTTL"`
+}
+
+// Authorize requests by sending their metadata to an authorizer outside of the
+// web server process (see the 'exec' and 'http' modes) and applying its
+// decision. Requests are denied with a 500 status if the authorizer fails.
+type externalAuth struct {
+	timeout  time.Duration
+	headers  []string
+	cacheTTL time.Duration
+
+	// decide sends the encoded request metadata to the authorizer and returns
+	// its encoded decision.
+	decide func(ctx context.Context, request []byte) ([]byte, error)
+
+	// The cached decisions, if 'cacheTTL' is set.
+	cache *DecisionCache
+}
+
+func newExternalAuth(
+	params externalAuthParams,
+	decide func(ctx context.Context, request []byte) ([]byte, error),
+) (*externalAuth, error) {
+	a := &externalAuth{
+		timeout: defaultExternalAuthTimeout,
+		headers: defaultExternalAuthHeaders,
+		decide:  decide,
+	}
+
+	var err error
+	if params.Timeout != "" {
+		a.timeout, err = time.ParseDuration(params.Timeout)
+		if err != nil || a.timeout <= 0 {
+			return nil, fmt.Errorf("invalid timeout '%s'", params.Timeout)
+		}
+	}
+	if params.CacheTTL != "" {
+		a.cacheTTL, err = time.ParseDuration(params.CacheTTL)
+		if err != nil || a.cacheTTL < 0 {
+			return nil, fmt.Errorf("invalid cacheTTL '%s'", params.CacheTTL)
+		}
+	}
+	if params.Headers != nil {
+		a.headers = params.Headers
+	}
+	if a.cacheTTL > 0 {
+		a.cache = NewDecisionCache(a.cacheTTL, maxCachedExternalDecisions)
+	}
+
+	return a, nil
+}
+
+func (a *externalAuth) requestMetadata(r *http.Request, owner string, repo string) externalAuthRequest {
+	request := externalAuthRequest{
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		Owner:      owner,
+		Repo:       repo,
+		RemoteAddr: r.RemoteAddr,
+		Headers:    map[string][]string{},
+	}
+	// Drop the port, which changes with each connection, so that the requests
+	// of a client can share a cached decision
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		request.RemoteAddr = host
+	}
+	for _, header := range a.headers {
+		if values := r.Header.Values(header); len(values) > 0 {
+			request.Headers[http.CanonicalHeaderKey(header)] = values
+		}
+	}
+	if cert := auth.VerifiedClientCertificate(r); cert != nil {
+		request.ClientCertificate = &externalAuthCert{
+			Subject:  cert.Subject.String(),
+			SPIFFEID: auth.SPIFFEID(cert),
+		}
+	}
+	return request
+}
+
+func (a *externalAuth) Authorize(r *http.Request, owner string, repo string) auth.AuthResult {
+	request, err := json.Marshal(a.requestMetadata(r, owner, repo))
+	if err != nil {
+		return auth.AuthResult{}
+	}
+
+	// The request metadata (including credentials) is the cache key, so only
+	// identical requests share a decision
+	key := sha256.Sum256(request)
+	if a.cache != nil {
+		if result, found := a.cache.Get(key); found {
+			return result
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), a.timeout)
+	defer cancel()
+
+	response, err := a.decide(ctx, request)
+	if err != nil {
+		// Fail closed; an invalid AuthResult results in a 500 response
+		return auth.AuthResult{}
+	}
+
+	var decision externalAuthResponse
+	err = json.Unmarshal(response, &decision)
+	if err != nil {
+		return auth.AuthResult{}
+	}
+	result, err := decision.result()
+	if err != nil {
+		return auth.AuthResult{}
+	}
+
+	if a.cache != nil {
+		a.cache.Add(key, result)
+	}
+	return result
+}
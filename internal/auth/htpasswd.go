@@ -0,0 +1,235 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/pkg/auth"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// The prefix of a hex-encoded SHA256 password hash in an htpasswd file.
+const sha256HashPrefix string = "{SHA256}"
+
+// A password hash read from an htpasswd file.
+type passwordHash interface {
+	matches(password string) bool
+}
+
+type bcryptHash []byte
+
+func (h bcryptHash) matches(password string) bool {
+	// bcrypt compares the hashes in constant time
+	return bcrypt.CompareHashAndPassword(h, []byte(password)) == nil
+}
+
+type sha256Hash [32]byte
+
+func (h sha256Hash) matches(password string) bool {
+	hash := sha256.Sum256([]byte(password))
+	return subtle.ConstantTimeCompare(hash[:], h[:]) == 1
+}
+
+func parsePasswordHash(value string) (passwordHash, error) {
+	switch {
+	case strings.HasPrefix(value, "$2a$"),
+		strings.HasPrefix(value, "$2b$"),
+		strings.HasPrefix(value, "$2y$"):
+		_, err := bcrypt.Cost([]byte(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid bcrypt hash: %w", err)
+		}
+		return bcryptHash(value), nil
+	case strings.HasPrefix(value, sha256HashPrefix):
+		hashBytes, err := hex.DecodeString(strings.TrimPrefix(value, sha256HashPrefix))
+		if err != nil {
+			return nil, fmt.Errorf("invalid SHA256 hash: %w", err)
+		} else if len(hashBytes) != 32 {
+			return nil, fmt.Errorf("SHA256 hash is incorrect length (%d vs. expected 32)", len(hashBytes))
+		}
+		return sha256Hash(hashBytes), nil
+	default:
+		return nil, fmt.Errorf("unsupported hash format (expected bcrypt or '%s')", sha256HashPrefix)
+	}
+}
+
+// The users of an htpasswd file.
+type htpasswdUsers struct {
+	modTime time.Time
+	size    int64
+	hashes  map[string]passwordHash
+
+	// A hash checked when the username is unknown, so that the response time
+	// doesn't reveal which users exist.
+	dummyHash passwordHash
+}
+
+func newHtpasswdUsers() *htpasswdUsers {
+	return &htpasswdUsers{
+		hashes:    map[string]passwordHash{},
+		dummyHash: sha256Hash{},
+	}
+}
+
+func (u *htpasswdUsers) add(username string, hashStr string) error {
+	if strings.Contains(username, ":") {
+		return fmt.Errorf("username '%s' contains a colon (\":\")", username)
+	}
+	if _, exists := u.hashes[username]; exists {
+		return fmt.Errorf("duplicate user '%s'", username)
+	}
+
+	hash, err := parsePasswordHash(hashStr)
+	if err != nil {
+		return err
+	}
+	u.hashes[username] = hash
+
+	if _, isBcrypt := hash.(bcryptHash); isBcrypt {
+		// Take as long as a bcrypt check of a real user would
+		u.dummyHash = hash
+	}
+
+	return nil
+}
+
+// authenticate returns whether the password matches the one of the user.
+func (u *htpasswdUsers) authenticate(username string, password string) bool {
+	hash, userExists := u.hashes[username]
+	if !userExists {
+		hash = u.dummyHash
+	}
+
+	return hash.matches(password) && userExists
+}
+
+func readHtpasswdFile(path string) (*htpasswdUsers, error) {
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fileBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	users := newHtpasswdUsers()
+	users.modTime = fileInfo.ModTime()
+	users.size = fileInfo.Size()
+
+	lineNum := 0
+	scanner := bufio.NewScanner(bytes.NewReader(fileBytes))
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		username, hashStr, found := strings.Cut(line, ":")
+		if !found {
+			return nil, fmt.Errorf("line %d: expected '<username>:<hash>'", lineNum)
+		}
+
+		err := users.add(username, hashStr)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// Authorize users with credentials matching an entry of an htpasswd-style file
+// that applies to the whole server. The file is reloaded whenever it changes.
+type htpasswdAuth struct {
+	path string
+
+	usersLock sync.Mutex
+	users     *htpasswdUsers
+}
+
+type htpasswdAuthParams struct {
+	Path string `json:"path"`
+}
+
+func NewHtpasswdAuth(rawParameters json.RawMessage) (auth.AuthMiddleware, error) {
+	if len(rawParameters) == 0 {
+		return nil, fmt.Errorf("parameters JSON must exist")
+	}
+
+	var params htpasswdAuthParams
+	err := json.Unmarshal(rawParameters, &params)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.Path == "" {
+		return nil, fmt.Errorf("path must be specified")
+	}
+
+	htpasswd, err := newHtpasswdAuth(params.Path)
+	if err != nil {
+		return nil, err
+	}
+	return htpasswd, nil
+}
+
+func newHtpasswdAuth(path string) (*htpasswdAuth, error) {
+	users, err := readHtpasswdFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read htpasswd file: %w", err)
+	}
+
+	return &htpasswdAuth{
+		path:  path,
+		users: users,
+	}, nil
+}
+
+// currentUsers returns the users of the htpasswd file, reloading it if it
+// changed. If the file can no longer be read, the last valid users are kept.
+func (a *htpasswdAuth) currentUsers() *htpasswdUsers {
+	a.usersLock.Lock()
+	defer a.usersLock.Unlock()
+
+	fileInfo, err := os.Stat(a.path)
+	if err == nil && (!fileInfo.ModTime().Equal(a.users.modTime) || fileInfo.Size() != a.users.size) {
+		users, err := readHtpasswdFile(a.path)
+		if err == nil {
+			a.users = users
+		}
+	}
+
+	return a.users
+}
+
+func (a *htpasswdAuth) Authorize(r *http.Request, _ string, _ string) auth.AuthResult {
+	username, password, ok := r.BasicAuth()
+	if ok {
+		if a.currentUsers().authenticate(username, password) {
+			return auth.AllowAs(auth.Identity{Name: username, Method: "basic"})
+		} else {
+			// Return a 404 status even though the issue is that the user is
+			// forbidden so we don't indirectly reveal which repositories are
+			// configured in the bundle server.
+			return auth.Deny(404)
+		}
+	}
+
+	return auth.Deny(401, basicAuthChallenge)
+}
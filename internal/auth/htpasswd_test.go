@@ -0,0 +1,194 @@
+package auth_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/auth"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func bcryptHash(t *testing.T, password string) string {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	assert.Nil(t, err)
+	return string(hash)
+}
+
+func writeHtpasswdFile(t *testing.T, path string, contents string) {
+	err := os.WriteFile(path, []byte(contents), 0o600)
+	assert.Nil(t, err)
+}
+
+func htpasswdParams(path string) []byte {
+	params, _ := json.Marshal(map[string]string{"path": path})
+	return params
+}
+
+var htpasswdAuthTests = []struct {
+	title string
+
+	// Inputs
+	authHeader string
+
+	// Expected outputs
+	expectedDoExit       bool
+	expectedResponseCode int
+	expectedHeaders      http.Header
+}{
+	{
+		"No auth returns 401",
+		"",
+		true,
+		401,
+		map[string][]string{
+			"Www-Authenticate": {`Basic realm="restricted", charset="UTF-8"`},
+		},
+	},
+	{
+		"Correct bcrypt password returns Authorized",
+		"Basic YWxpY2U6dGVzdDEyMw==", // Base64 encoded "alice:test123"
+		false,
+		200,
+		nil,
+	},
+	{
+		"Correct SHA256 password returns Authorized",
+		"Basic Ym9iOnRlc3QxMjM=", // Base64 encoded "bob:test123"
+		false,
+		200,
+		nil,
+	},
+	{
+		"Incorrect bcrypt password returns 404",
+		"Basic YWxpY2U6dGVzdA==", // Base64 encoded "alice:test"
+		true,
+		404,
+		map[string][]string{},
+	},
+	{
+		"Incorrect SHA256 password returns 404",
+		"Basic Ym9iOnRlc3Q=", // Base64 encoded "bob:test"
+		true,
+		404,
+		map[string][]string{},
+	},
+	{
+		"Unknown user returns 404",
+		"Basic aW52YWxpZDp0ZXN0MTIz", // Base64 encoded "invalid:test123"
+		true,
+		404,
+		map[string][]string{},
+	},
+}
+
+func Test_HtpasswdAuth(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	writeHtpasswdFile(t, path, fmt.Sprintf(`# Test users
+alice:%s
+
+bob:{SHA256}ecd71870d1963316a97e3ac3408c9835ad8cf0f3c1bc703527c30265534f75ae
+`, bcryptHash(t, "test123")))
+
+	middleware, err := auth.NewHtpasswdAuth(htpasswdParams(path))
+	assert.Nil(t, err)
+
+	for _, tt := range htpasswdAuthTests {
+		t.Run(tt.title, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "test/repo", nil)
+			assert.Nil(t, err)
+
+			if len(tt.authHeader) > 0 {
+				req.Header.Set("Authorization", tt.authHeader)
+			}
+
+			result := middleware.Authorize(req, "test", "repo")
+
+			wExpect := httptest.NewRecorder()
+			if tt.expectedDoExit {
+				wExpect.HeaderMap = tt.expectedHeaders //lint:ignore SA1019 set headers manually for test
+				wExpect.WriteHeader(tt.expectedResponseCode)
+			}
+
+			wActual := httptest.NewRecorder()
+			actualDoExit := result.ApplyResult(wActual)
+
+			assert.Equal(t, tt.expectedDoExit, actualDoExit)
+			assert.Equal(t, wExpect, wActual)
+		})
+	}
+}
+
+var htpasswdInitTests = []struct {
+	title    string
+	contents string
+}{
+	{"Missing separator", "alice\n"},
+	{"Unsupported hash", "alice:{SHA}qUqP5cyxm6YcTAhz05Hph5gvu9M=\n"},
+	{"Malformed SHA256 hash", "alice:{SHA256}test123\n"},
+	{"Malformed bcrypt hash", "alice:$2y$05$abc\n"},
+	{"Duplicate user", "alice:{SHA256}ecd71870d1963316a97e3ac3408c9835ad8cf0f3c1bc703527c30265534f75ae\n" +
+		"alice:{SHA256}ecd71870d1963316a97e3ac3408c9835ad8cf0f3c1bc703527c30265534f75ae\n"},
+}
+
+func Test_HtpasswdAuth_InvalidFile(t *testing.T) {
+	for _, tt := range htpasswdInitTests {
+		t.Run(tt.title, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "htpasswd")
+			writeHtpasswdFile(t, path, tt.contents)
+
+			_, err := auth.NewHtpasswdAuth(htpasswdParams(path))
+			assert.NotNil(t, err)
+		})
+	}
+
+	t.Run("Missing file", func(t *testing.T) {
+		_, err := auth.NewHtpasswdAuth(htpasswdParams(filepath.Join(t.TempDir(), "missing")))
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Missing path", func(t *testing.T) {
+		_, err := auth.NewHtpasswdAuth([]byte("{}"))
+		assert.NotNil(t, err)
+	})
+}
+
+func Test_HtpasswdAuth_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	writeHtpasswdFile(t, path, "alice:{SHA256}ecd71870d1963316a97e3ac3408c9835ad8cf0f3c1bc703527c30265534f75ae\n")
+
+	middleware, err := auth.NewHtpasswdAuth(htpasswdParams(path))
+	assert.Nil(t, err)
+
+	authorize := func(username string, password string) bool {
+		req, err := http.NewRequest("GET", "test/repo", nil)
+		assert.Nil(t, err)
+		req.SetBasicAuth(username, password)
+		result := middleware.Authorize(req, "test", "repo")
+		return !result.ApplyResult(httptest.NewRecorder())
+	}
+
+	assert.True(t, authorize("alice", "test123"))
+	assert.False(t, authorize("bob", "secret"))
+
+	// Replace alice with bob
+	writeHtpasswdFile(t, path, fmt.Sprintf("bob:%s\n", bcryptHash(t, "secret")))
+	later := time.Now().Add(time.Minute)
+	assert.Nil(t, os.Chtimes(path, later, later))
+
+	assert.False(t, authorize("alice", "test123"))
+	assert.True(t, authorize("bob", "secret"))
+
+	// An invalid file keeps the last valid users
+	writeHtpasswdFile(t, path, "invalid")
+	later = later.Add(time.Minute)
+	assert.Nil(t, os.Chtimes(path, later, later))
+
+	assert.True(t, authorize("bob", "secret"))
+}
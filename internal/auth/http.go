@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/git-ecosystem/git-bundle-server/pkg/auth"
+)
+
+// The maximum size of a decision read from an authorization service.
+const maxHTTPAuthResponseSize = 1 << 20
+
+type httpAuthParams struct {
+	URL string `json:"url"`
+	externalAuthParams
+}
+
+// NewHTTPAuth creates an AuthMiddleware POSTing the metadata of each request as
+// JSON to an authorization service, which responds with its decision as JSON
+// (with a 200 status).
+func NewHTTPAuth(rawParameters json.RawMessage) (auth.AuthMiddleware, error) {
+	if len(rawParameters) == 0 {
+		return nil, fmt.Errorf("parameters JSON must exist")
+	}
+
+	var params httpAuthParams
+	err := json.Unmarshal(rawParameters, &params)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.URL == "" {
+		return nil, fmt.Errorf("url must be specified")
+	}
+	serviceUrl, err := url.Parse(params.URL)
+	if err != nil || (serviceUrl.Scheme != "http" && serviceUrl.Scheme != "https") || serviceUrl.Host == "" {
+		return nil, fmt.Errorf("invalid url '%s' (expected an http or https URL)", params.URL)
+	}
+
+	client := &http.Client{
+		// Redirects could send the request metadata (including credentials)
+		// elsewhere
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	decide := func(ctx context.Context, request []byte) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", serviceUrl.String(), bytes.NewReader(request))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("authorization service responded with status %d", resp.StatusCode)
+		}
+		return io.ReadAll(io.LimitReader(resp.Body, maxHTTPAuthResponseSize))
+	}
+
+	a, err := newExternalAuth(params.externalAuthParams, decide)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
@@ -0,0 +1,134 @@
+package auth_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+// newAuthorizationService starts a service allowing requests with the token
+// 'secret' and denying others, counting the requests it receives.
+func newAuthorizationService(t *testing.T, calls *int) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		var request struct {
+			Owner   string              `json:"owner"`
+			Repo    string              `json:"repo"`
+			Headers map[string][]string `json:"headers"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&request)
+		assert.Nil(t, err)
+
+		// Only the configured headers are forwarded
+		assert.NotContains(t, request.Headers, "Cookie")
+
+		authorization := request.Headers["Authorization"]
+		switch {
+		case request.Owner == "broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		case len(authorization) == 1 && authorization[0] == "Bearer secret":
+			fmt.Fprintf(w, `{"allow": true, "identity": {"name": "alice", "attributes": {"repo": "%s"}}}`, request.Repo)
+		default:
+			fmt.Fprint(w, `{"allow": false, "status": 403}`)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func Test_HTTPAuth(t *testing.T) {
+	calls := 0
+	server := newAuthorizationService(t, &calls)
+	middleware, err := auth.NewHTTPAuth([]byte(fmt.Sprintf(`{ "url": "%s", "cacheTTL": "1m" }`, server.URL)))
+	assert.Nil(t, err)
+
+	authorize := func(owner string, repo string, token string) (int, *http.Request) {
+		req, err := http.NewRequest("GET", owner+"/"+repo, nil)
+		assert.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Cookie", "session=abc")
+
+		result := middleware.Authorize(req, owner, repo)
+		w := httptest.NewRecorder()
+		result.ApplyResult(w)
+		if identity := result.Identity(); identity != nil {
+			assert.Equal(t, "alice", identity.Name)
+			assert.Equal(t, repo, identity.Attributes["repo"])
+		}
+		return w.Code, req
+	}
+
+	t.Run("Allowed and denied requests", func(t *testing.T) {
+		code, _ := authorize("test", "repo", "secret")
+		assert.Equal(t, 200, code)
+		code, _ = authorize("test", "repo", "wrong")
+		assert.Equal(t, 403, code)
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("Decisions are cached per request", func(t *testing.T) {
+		calls = 0
+		code, _ := authorize("test", "repo", "secret")
+		assert.Equal(t, 200, code)
+		code, _ = authorize("test", "repo", "wrong")
+		assert.Equal(t, 403, code)
+		assert.Equal(t, 0, calls)
+
+		code, _ = authorize("test", "other", "secret")
+		assert.Equal(t, 200, code)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("Service errors deny the request and are not cached", func(t *testing.T) {
+		calls = 0
+		code, _ := authorize("broken", "repo", "secret")
+		assert.Equal(t, 500, code)
+		code, _ = authorize("broken", "repo", "secret")
+		assert.Equal(t, 500, code)
+		assert.Equal(t, 2, calls)
+	})
+}
+
+func Test_HTTPAuth_NoCache(t *testing.T) {
+	calls := 0
+	server := newAuthorizationService(t, &calls)
+	middleware, err := auth.NewHTTPAuth([]byte(fmt.Sprintf(`{ "url": "%s" }`, server.URL)))
+	assert.Nil(t, err)
+
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest("GET", "test/repo", nil)
+		assert.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer secret")
+		result := middleware.Authorize(req, "test", "repo")
+		assert.False(t, result.ApplyResult(httptest.NewRecorder()))
+	}
+	assert.Equal(t, 2, calls)
+}
+
+var httpInitTests = []struct {
+	title      string
+	parameters string
+}{
+	{"Missing parameters", ""},
+	{"Missing URL", `{ "timeout": "1s" }`},
+	{"Invalid URL scheme", `{ "url": "unix:///run/authz.sock" }`},
+	{"Invalid timeout", `{ "url": "http://localhost:8181", "timeout": "0s" }`},
+	{"Invalid cache TTL", `{ "url": "http://localhost:8181", "cacheTTL": "forever" }`},
+}
+
+func Test_HTTPAuth_InvalidParameters(t *testing.T) {
+	for _, tt := range httpInitTests {
+		t.Run(tt.title, func(t *testing.T) {
+			_, err := auth.NewHTTPAuth([]byte(tt.parameters))
+			assert.NotNil(t, err)
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+
+	"github.com/go-jose/go-jose/v4"
+)
+
+// readJWKSFile reads the signing keys of a JSON Web Key Set file. Keys used
+// for encryption rather than signatures are ignored.
+func readJWKSFile(path string) ([]jose.JSONWebKey, error) {
+	fileBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var jwks jose.JSONWebKeySet
+	err = json.Unmarshal(fileBytes, &jwks)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []jose.JSONWebKey{}
+	for i, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if secret, isSecret := jwk.Key.([]byte); isSecret {
+			if len(secret) == 0 {
+				return nil, fmt.Errorf("key %d: invalid symmetric key", i)
+			}
+		} else if !jwk.Valid() {
+			return nil, fmt.Errorf("key %d: invalid key", i)
+		} else {
+			// Only the public part of a private key is needed
+			jwk = jwk.Public()
+		}
+		keys = append(keys, jwk)
+	}
+
+	return keys, nil
+}
+
+// readPublicKeyFile reads a PEM-encoded public key or certificate.
+func readPublicKeyFile(path string) (any, error) {
+	fileBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(fileBytes)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+
+	var publicKey any
+	switch block.Type {
+	case "PUBLIC KEY":
+		publicKey, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		publicKey, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		cert, err = x509.ParseCertificate(block.Bytes)
+		if err == nil {
+			publicKey = cert.PublicKey
+		}
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type '%s'", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch publicKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+		return publicKey, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", publicKey)
+	}
+}
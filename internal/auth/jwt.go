@@ -0,0 +1,346 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/pkg/auth"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+// The default clock skew tolerated when checking the expiry of a token.
+const defaultJWTLeeway = 30 * time.Second
+
+// The header requesting a Bearer token from the client (see RFC 6750).
+var bearerAuthChallenge = auth.Header{Key: "WWW-Authenticate", Value: `Bearer realm="restricted"`}
+
+// The header reporting that the Bearer token sent by the client is invalid.
+var invalidTokenChallenge = auth.Header{Key: "WWW-Authenticate", Value: `Bearer realm="restricted", error="invalid_token"`}
+
+// The algorithms a token may be signed with; in particular, 'none' is rejected.
+var jwtSignatureAlgorithms = []jose.SignatureAlgorithm{
+	jose.RS256, jose.RS384, jose.RS512,
+	jose.PS256, jose.PS384, jose.PS512,
+	jose.ES256, jose.ES384, jose.ES512,
+	jose.EdDSA,
+	jose.HS256, jose.HS384, jose.HS512,
+}
+
+// Matches the claim references ('{<claim>}') in a route pattern.
+var claimReferenceRegexp = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// A rule granting the tokens whose claims match to access the routes matching
+// the patterns.
+type jwtRouteRule struct {
+	Claims map[string]string `json:"claims"`
+	Routes []string          `json:"routes"`
+}
+
+type jwtStaticKey struct {
+	ID         string `json:"kid"`
+	Algorithm  string `json:"alg"`
+	PublicKey  string `json:"publicKey"`
+	SecretFile string `json:"secretFile"`
+}
+
+// Authorize clients with a JSON Web Token (JWT) Bearer token signed by one of
+// the configured keys, restricting each token to the routes the rules matching
+// its claims allow.
+type jwtAuth struct {
+	issuer   string
+	audience string
+	leeway   time.Duration
+	rules    []jwtRouteRule
+
+	staticKeys []jose.JSONWebKey
+
+	jwksPath    string
+	jwksLock    sync.Mutex
+	jwksModTime time.Time
+	jwksKeys    []jose.JSONWebKey
+
+	now func() time.Time
+}
+
+type jwtAuthParams struct {
+	Issuer   string         `json:"issuer"`
+	Audience string         `json:"audience"`
+	JWKS     string         `json:"jwks"`
+	Keys     []jwtStaticKey `json:"keys"`
+	Leeway   string         `json:"leeway"`
+	Routes   []jwtRouteRule `json:"routes"`
+}
+
+func NewJWTAuth(rawParameters json.RawMessage) (auth.AuthMiddleware, error) {
+	if len(rawParameters) == 0 {
+		return nil, fmt.Errorf("parameters JSON must exist")
+	}
+
+	var params jwtAuthParams
+	err := json.Unmarshal(rawParameters, &params)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.Issuer == "" {
+		return nil, fmt.Errorf("issuer must be specified")
+	}
+	if params.Audience == "" {
+		return nil, fmt.Errorf("audience must be specified")
+	}
+
+	a := &jwtAuth{
+		issuer:   params.Issuer,
+		audience: params.Audience,
+		leeway:   defaultJWTLeeway,
+		rules:    params.Routes,
+		jwksPath: params.JWKS,
+		now:      time.Now,
+	}
+
+	if params.Leeway != "" {
+		a.leeway, err = time.ParseDuration(params.Leeway)
+		if err != nil || a.leeway < 0 {
+			return nil, fmt.Errorf("invalid leeway '%s'", params.Leeway)
+		}
+	}
+
+	// Load the keys
+	if params.JWKS == "" && len(params.Keys) == 0 {
+		return nil, fmt.Errorf("at least one of 'jwks' and 'keys' must be specified")
+	}
+	if params.JWKS != "" {
+		fileInfo, err := os.Stat(params.JWKS)
+		if err != nil {
+			return nil, fmt.Errorf("could not read JWKS file: %w", err)
+		}
+		a.jwksKeys, err = readJWKSFile(params.JWKS)
+		if err != nil {
+			return nil, fmt.Errorf("could not read JWKS file: %w", err)
+		}
+		a.jwksModTime = fileInfo.ModTime()
+	}
+	for i, staticKey := range params.Keys {
+		key := jose.JSONWebKey{
+			KeyID:     staticKey.ID,
+			Algorithm: staticKey.Algorithm,
+		}
+		switch {
+		case (staticKey.PublicKey == "") == (staticKey.SecretFile == ""):
+			return nil, fmt.Errorf("key %d: exactly one of 'publicKey' and 'secretFile' must be specified", i)
+		case staticKey.PublicKey != "":
+			key.Key, err = readPublicKeyFile(staticKey.PublicKey)
+		default:
+			var secret []byte
+			secret, err = os.ReadFile(staticKey.SecretFile)
+			if err == nil && len(secret) == 0 {
+				err = fmt.Errorf("secret is empty")
+			}
+			key.Key = secret
+		}
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %w", i, err)
+		}
+		a.staticKeys = append(a.staticKeys, key)
+	}
+
+	// Validate the route rules
+	if len(params.Routes) == 0 {
+		return nil, fmt.Errorf("'routes' must contain at least one rule")
+	}
+	for i, rule := range params.Routes {
+		for _, pattern := range rule.Routes {
+			if claimReferenceRegexp.MatchString(pattern) {
+				// The number of path components depends on the claims, so only
+				// check the syntax
+				_, err = path.Match(claimReferenceRegexp.ReplaceAllString(pattern, "x"), "")
+			} else {
+				err = validateRoutePattern(pattern)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid route pattern in rule %d: %w", i, err)
+			}
+		}
+	}
+
+	return a, nil
+}
+
+// currentKeys returns the keys that can verify a token, reloading the JWKS
+// file if it changed. If the file can no longer be read, the last valid keys
+// are kept.
+func (a *jwtAuth) currentKeys() []jose.JSONWebKey {
+	if a.jwksPath == "" {
+		return a.staticKeys
+	}
+
+	a.jwksLock.Lock()
+	defer a.jwksLock.Unlock()
+
+	fileInfo, err := os.Stat(a.jwksPath)
+	if err == nil && !fileInfo.ModTime().Equal(a.jwksModTime) {
+		keys, err := readJWKSFile(a.jwksPath)
+		if err == nil {
+			a.jwksKeys = keys
+			a.jwksModTime = fileInfo.ModTime()
+		}
+	}
+
+	return append(append([]jose.JSONWebKey{}, a.staticKeys...), a.jwksKeys...)
+}
+
+// claimValues returns the string values of a claim: the claim itself if it is
+// a string, number, or boolean, or its elements if it is an array.
+func claimValues(claims map[string]any, name string) []string {
+	switch value := claims[name].(type) {
+	case nil:
+		return nil
+	case []any:
+		values := []string{}
+		for _, element := range value {
+			if _, isObject := element.(map[string]any); !isObject {
+				values = append(values, fmt.Sprint(element))
+			}
+		}
+		return values
+	case map[string]any:
+		return nil
+	default:
+		return []string{fmt.Sprint(value)}
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// validateToken checks the signature, issuer, audience and validity period of
+// a JWT, returning its claims.
+func (a *jwtAuth) validateToken(token string) (map[string]any, error) {
+	parsed, err := jwt.ParseSigned(token, jwtSignatureAlgorithms)
+	if err != nil {
+		return nil, err
+	}
+	header := parsed.Headers[0]
+
+	// Verify the signature with the key identified by the token, or with any
+	// key if the token doesn't identify one
+	var registered jwt.Claims
+	claims := map[string]any{}
+	verified := false
+	for _, key := range a.currentKeys() {
+		if header.KeyID != "" && key.KeyID != header.KeyID {
+			continue
+		}
+		if key.Algorithm != "" && key.Algorithm != header.Algorithm {
+			continue
+		}
+		if parsed.Claims(key.Key, &registered, &claims) == nil {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, fmt.Errorf("signature could not be verified")
+	}
+
+	if registered.Expiry == nil {
+		return nil, fmt.Errorf("token has no expiry")
+	}
+	err = registered.ValidateWithLeeway(jwt.Expected{
+		Issuer:      a.issuer,
+		AnyAudience: jwt.Audience{a.audience},
+		Time:        a.now(),
+	}, a.leeway)
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// expandRoutePattern replaces the claim references in a route pattern with the
+// values of the claims, escaped so they only match themselves. Returns false if
+// a referenced claim isn't a string.
+func expandRoutePattern(pattern string, claims map[string]any) (string, bool) {
+	ok := true
+	expanded := claimReferenceRegexp.ReplaceAllStringFunc(pattern, func(reference string) string {
+		value, isString := claims[reference[1:len(reference)-1]].(string)
+		if !isString || value == "" {
+			ok = false
+			return ""
+		}
+		for _, c := range `\*?[` {
+			value = strings.ReplaceAll(value, string(c), `\`+string(c))
+		}
+		return value
+	})
+	return expanded, ok
+}
+
+// canAccess returns whether a rule matching the claims allows access to the
+// route.
+func (a *jwtAuth) canAccess(claims map[string]any, owner string, repo string) bool {
+	for _, rule := range a.rules {
+		matches := true
+		for name, value := range rule.Claims {
+			if !containsString(claimValues(claims, name), value) {
+				matches = false
+				break
+			}
+		}
+		if !matches {
+			continue
+		}
+
+		patterns := []string{}
+		for _, pattern := range rule.Routes {
+			if expanded, ok := expandRoutePattern(pattern, claims); ok {
+				patterns = append(patterns, expanded)
+			}
+		}
+		if matchRoute(patterns, owner, repo) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *jwtAuth) Authorize(r *http.Request, owner string, repo string) auth.AuthResult {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return auth.Deny(401, bearerAuthChallenge)
+	}
+
+	claims, err := a.validateToken(strings.TrimSpace(token))
+	if err != nil {
+		return auth.Deny(401, invalidTokenChallenge)
+	}
+
+	if !a.canAccess(claims, owner, repo) {
+		// Return a 404 status even though the issue is that the token is
+		// forbidden so we don't indirectly reveal which repositories are
+		// configured in the bundle server.
+		return auth.Deny(404)
+	}
+
+	subject, _ := claims["sub"].(string)
+	return auth.AllowAs(auth.Identity{
+		Name:       subject,
+		Method:     "jwt",
+		Attributes: map[string]string{"issuer": a.issuer},
+	})
+}
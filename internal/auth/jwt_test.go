@@ -0,0 +1,299 @@
+package auth_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+type jwtTestKeys struct {
+	rsaKey    *rsa.PrivateKey
+	ecKey     *ecdsa.PrivateKey
+	hmacKey   []byte
+	otherKey  *rsa.PrivateKey
+	jwksPath  string
+	pemPath   string
+	secretDir string
+}
+
+func newJWTTestKeys(t *testing.T) *jwtTestKeys {
+	dir := t.TempDir()
+	keys := &jwtTestKeys{
+		hmacKey:   []byte("my-shared-secret-of-at-least-32-bytes"),
+		jwksPath:  filepath.Join(dir, "jwks.json"),
+		pemPath:   filepath.Join(dir, "key.pem"),
+		secretDir: dir,
+	}
+
+	var err error
+	keys.rsaKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	keys.otherKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	keys.ecKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	// JWKS with the RSA key
+	encode := base64.RawURLEncoding.EncodeToString
+	jwks, err := json.Marshal(map[string]any{
+		"keys": []map[string]string{
+			{
+				"kty": "RSA",
+				"kid": "rsa-key",
+				"use": "sig",
+				"n":   encode(keys.rsaKey.N.Bytes()),
+				"e":   encode([]byte{1, 0, 1}),
+			},
+		},
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(keys.jwksPath, jwks, 0o600))
+
+	// PEM file with the EC key
+	der, err := x509.MarshalPKIXPublicKey(&keys.ecKey.PublicKey)
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(keys.pemPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600))
+
+	// Shared secret
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "secret"), keys.hmacKey, 0o600))
+
+	return keys
+}
+
+func (k *jwtTestKeys) parameters(t *testing.T) []byte {
+	params, err := json.Marshal(map[string]any{
+		"issuer":   "https://issuer.example.com",
+		"audience": "git-bundle-server",
+		"jwks":     k.jwksPath,
+		"keys": []map[string]string{
+			{"kid": "ec-key", "publicKey": k.pemPath},
+			{"kid": "hmac-key", "alg": "HS256", "secretFile": filepath.Join(k.secretDir, "secret")},
+		},
+		"routes": []map[string]any{
+			{"claims": map[string]string{"groups": "admins"}, "routes": []string{"*/*"}},
+			{"claims": map[string]string{"repository_owner": "myorg"}, "routes": []string{"{repository}", "myorg/public"}},
+		},
+	})
+	assert.Nil(t, err)
+	return params
+}
+
+// sign creates a JWT with the given claims, signed by the key with the given
+// ID.
+func (k *jwtTestKeys) sign(t *testing.T, kid string, claims map[string]any) string {
+	encode := base64.RawURLEncoding.EncodeToString
+
+	alg := map[string]string{"rsa-key": "RS256", "other-key": "RS256", "ec-key": "ES256", "hmac-key": "HS256"}[kid]
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	assert.Nil(t, err)
+	payload, err := json.Marshal(claims)
+	assert.Nil(t, err)
+
+	signingInput := encode(header) + "." + encode(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	var signature []byte
+	switch kid {
+	case "rsa-key":
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k.rsaKey, crypto.SHA256, digest[:])
+	case "other-key":
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k.otherKey, crypto.SHA256, digest[:])
+	case "ec-key":
+		r, s, ecErr := ecdsa.Sign(rand.Reader, k.ecKey, digest[:])
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+		err = ecErr
+	case "hmac-key":
+		mac := hmac.New(sha256.New, k.hmacKey)
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	}
+	assert.Nil(t, err)
+
+	return signingInput + "." + encode(signature)
+}
+
+func jwtClaims(overrides map[string]any) map[string]any {
+	claims := map[string]any{
+		"iss":              "https://issuer.example.com",
+		"aud":              "git-bundle-server",
+		"exp":              time.Now().Add(time.Hour).Unix(),
+		"repository":       "myorg/app",
+		"repository_owner": "myorg",
+	}
+	for key, value := range overrides {
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+	}
+	return claims
+}
+
+var jwtAuthTests = []struct {
+	title string
+
+	// Inputs
+	kid    string
+	claims map[string]any
+	owner  string
+	repo   string
+
+	// Expected outputs
+	expectedResponseCode int
+	expectedChallenge    string
+}{
+	{"RSA key from JWKS", "rsa-key", jwtClaims(nil), "myorg", "app", 200, ""},
+	{"EC key from PEM file", "ec-key", jwtClaims(nil), "myorg", "app", 200, ""},
+	{"HMAC secret", "hmac-key", jwtClaims(nil), "myorg", "app", 200, ""},
+	{"Static route of matching rule", "rsa-key", jwtClaims(nil), "myorg", "public", 200, ""},
+	{"Audience in list", "rsa-key", jwtClaims(map[string]any{"aud": []string{"other", "git-bundle-server"}}), "myorg", "app", 200, ""},
+	{"Array claim", "rsa-key", jwtClaims(map[string]any{"groups": []string{"admins"}}), "other", "repo", 200, ""},
+	{"Expiry within leeway", "rsa-key", jwtClaims(map[string]any{"exp": time.Now().Add(-10 * time.Second).Unix()}), "myorg", "app", 200, ""},
+	{"Route of other repository", "rsa-key", jwtClaims(nil), "myorg", "other", 404, ""},
+	{"Route of other owner", "rsa-key", jwtClaims(nil), "other", "app", 404, ""},
+	{"No matching rule", "rsa-key", jwtClaims(map[string]any{"repository_owner": "other"}), "myorg", "app", 404, ""},
+	{"Glob in claim is escaped", "rsa-key", jwtClaims(map[string]any{"repository": "myorg/*"}), "myorg", "app", 404, ""},
+	{"Expired token", "rsa-key", jwtClaims(map[string]any{"exp": time.Now().Add(-time.Hour).Unix()}), "myorg", "app", 401, "invalid_token"},
+	{"Missing expiry", "rsa-key", jwtClaims(map[string]any{"exp": nil}), "myorg", "app", 401, "invalid_token"},
+	{"Not valid yet", "rsa-key", jwtClaims(map[string]any{"nbf": time.Now().Add(time.Hour).Unix()}), "myorg", "app", 401, "invalid_token"},
+	{"Wrong issuer", "rsa-key", jwtClaims(map[string]any{"iss": "https://other.example.com"}), "myorg", "app", 401, "invalid_token"},
+	{"Wrong audience", "rsa-key", jwtClaims(map[string]any{"aud": "other"}), "myorg", "app", 401, "invalid_token"},
+	{"Unknown key", "other-key", jwtClaims(nil), "myorg", "app", 401, "invalid_token"},
+}
+
+func Test_JWTAuth(t *testing.T) {
+	keys := newJWTTestKeys(t)
+	middleware, err := auth.NewJWTAuth(keys.parameters(t))
+	assert.Nil(t, err)
+
+	for _, tt := range jwtAuthTests {
+		t.Run(tt.title, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tt.owner+"/"+tt.repo, nil)
+			assert.Nil(t, err)
+			req.Header.Set("Authorization", "Bearer "+keys.sign(t, tt.kid, tt.claims))
+
+			result := middleware.Authorize(req, tt.owner, tt.repo)
+
+			w := httptest.NewRecorder()
+			doExit := result.ApplyResult(w)
+			assert.Equal(t, tt.expectedResponseCode != 200, doExit)
+			assert.Equal(t, tt.expectedResponseCode, w.Code)
+			if tt.expectedChallenge != "" {
+				assert.Equal(t,
+					fmt.Sprintf(`Bearer realm="restricted", error="%s"`, tt.expectedChallenge),
+					w.Header().Get("WWW-Authenticate"))
+			} else {
+				assert.Empty(t, w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+
+	t.Run("Tampered token", func(t *testing.T) {
+		token := keys.sign(t, "rsa-key", jwtClaims(nil))
+		other := keys.sign(t, "rsa-key", jwtClaims(map[string]any{"groups": "admins"}))
+
+		// Swap in the payload of another token
+		req, err := http.NewRequest("GET", "myorg/app", nil)
+		assert.Nil(t, err)
+		tokenParts := strings.Split(token, ".")
+		otherParts := strings.Split(other, ".")
+		req.Header.Set("Authorization", "Bearer "+tokenParts[0]+"."+otherParts[1]+"."+tokenParts[2])
+
+		result := middleware.Authorize(req, "other", "repo")
+		w := httptest.NewRecorder()
+		assert.True(t, result.ApplyResult(w))
+		assert.Equal(t, 401, w.Code)
+	})
+
+	t.Run("Unsigned token", func(t *testing.T) {
+		encode := base64.RawURLEncoding.EncodeToString
+		payload, _ := json.Marshal(jwtClaims(nil))
+
+		req, err := http.NewRequest("GET", "myorg/app", nil)
+		assert.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer "+encode([]byte(`{"alg":"none"}`))+"."+encode(payload)+".")
+
+		result := middleware.Authorize(req, "myorg", "app")
+		w := httptest.NewRecorder()
+		assert.True(t, result.ApplyResult(w))
+		assert.Equal(t, 401, w.Code)
+	})
+
+	t.Run("HMAC secret shorter than the hash", func(t *testing.T) {
+		shortKeys := newJWTTestKeys(t)
+		shortKeys.hmacKey = []byte("short-secret")
+		assert.Nil(t, os.WriteFile(filepath.Join(shortKeys.secretDir, "secret"), shortKeys.hmacKey, 0o600))
+		shortMiddleware, err := auth.NewJWTAuth(shortKeys.parameters(t))
+		assert.Nil(t, err)
+
+		req, err := http.NewRequest("GET", "myorg/app", nil)
+		assert.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer "+shortKeys.sign(t, "hmac-key", jwtClaims(nil)))
+
+		result := shortMiddleware.Authorize(req, "myorg", "app")
+		w := httptest.NewRecorder()
+		assert.True(t, result.ApplyResult(w))
+		assert.Equal(t, 401, w.Code)
+	})
+
+	t.Run("No token returns 401", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "myorg/app", nil)
+		assert.Nil(t, err)
+		req.SetBasicAuth("admin", "test123")
+
+		result := middleware.Authorize(req, "myorg", "app")
+		w := httptest.NewRecorder()
+		assert.True(t, result.ApplyResult(w))
+		assert.Equal(t, 401, w.Code)
+		assert.Equal(t, `Bearer realm="restricted"`, w.Header().Get("WWW-Authenticate"))
+	})
+}
+
+var jwtInitTests = []struct {
+	title      string
+	parameters string
+}{
+	{"Missing parameters", ""},
+	{"Missing issuer", `{ "audience": "a", "keys": [{ "secretFile": "/dev/null" }], "routes": [{ "routes": ["*/*"] }] }`},
+	{"Missing audience", `{ "issuer": "i", "keys": [{ "secretFile": "/dev/null" }], "routes": [{ "routes": ["*/*"] }] }`},
+	{"Missing keys", `{ "issuer": "i", "audience": "a", "routes": [{ "routes": ["*/*"] }] }`},
+	{"Missing JWKS file", `{ "issuer": "i", "audience": "a", "jwks": "/does/not/exist", "routes": [{ "routes": ["*/*"] }] }`},
+	{"Empty secret", `{ "issuer": "i", "audience": "a", "keys": [{ "secretFile": "/dev/null" }], "routes": [{ "routes": ["*/*"] }] }`},
+	{"Invalid leeway", `{ "issuer": "i", "audience": "a", "leeway": "soon", "keys": [{ "secretFile": "/dev/null" }], "routes": [{ "routes": ["*/*"] }] }`},
+}
+
+func Test_JWTAuth_InvalidParameters(t *testing.T) {
+	for _, tt := range jwtInitTests {
+		t.Run(tt.title, func(t *testing.T) {
+			_, err := auth.NewJWTAuth([]byte(tt.parameters))
+			assert.NotNil(t, err)
+		})
+	}
+
+	t.Run("Missing routes", func(t *testing.T) {
+		keys := newJWTTestKeys(t)
+		params := fmt.Sprintf(`{ "issuer": "i", "audience": "a", "jwks": "%s" }`, keys.jwksPath)
+		_, err := auth.NewJWTAuth([]byte(params))
+		assert.NotNil(t, err)
+	})
+}
@@ -13,6 +13,9 @@ import (
 )
 
 /* Built-in auth modes */
+// The header requesting Basic authentication credentials from the client.
+var basicAuthChallenge = auth.Header{Key: "WWW-Authenticate", Value: `Basic realm="restricted", charset="UTF-8"`}
+
 // Authorize users with credentials matching a static username/password pair
 // that applies to the whole server.
 type fixedCredentialAuth struct {
@@ -65,7 +68,7 @@ func (a *fixedCredentialAuth) Authorize(r *http.Request, _ string, _ string) aut
 		passwordMatch := (subtle.ConstantTimeCompare(passwordHash[:], a.passwordHash[:]) == 1)
 
 		if usernameMatch && passwordMatch {
-			return auth.Allow()
+			return auth.AllowAs(auth.Identity{Name: username, Method: "basic"})
 		} else {
 			// Return a 404 status even though the issue is that the user is
 			// forbidden so we don't indirectly reveal which repositories are
@@ -74,5 +77,5 @@ func (a *fixedCredentialAuth) Authorize(r *http.Request, _ string, _ string) aut
 		}
 	}
 
-	return auth.Deny(401, auth.Header{Key: "WWW-Authenticate", Value: `Basic realm="restricted", charset="UTF-8"`})
+	return auth.Deny(401, basicAuthChallenge)
 }
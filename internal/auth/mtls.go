@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+
+	"github.com/git-ecosystem/git-bundle-server/pkg/auth"
+)
+
+// A rule granting the client certificates whose identity matches to access the
+// routes matching the patterns. Exactly one identity pattern is set.
+type mtlsRule struct {
+	Subject    string   `json:"subject"`
+	CommonName string   `json:"commonName"`
+	DNSName    string   `json:"dnsName"`
+	Email      string   `json:"email"`
+	URI        string   `json:"uri"`
+	SPIFFEID   string   `json:"spiffeId"`
+	Routes     []string `json:"routes"`
+}
+
+// identityPattern returns the identity pattern of the rule, and the identities
+// of a certificate it is matched against.
+func (rule *mtlsRule) identityPattern() (string, func(*x509.Certificate) []string, error) {
+	candidates := []struct {
+		pattern    string
+		identities func(*x509.Certificate) []string
+	}{
+		{rule.Subject, func(c *x509.Certificate) []string { return []string{c.Subject.String()} }},
+		{rule.CommonName, func(c *x509.Certificate) []string { return []string{c.Subject.CommonName} }},
+		{rule.DNSName, func(c *x509.Certificate) []string { return c.DNSNames }},
+		{rule.Email, func(c *x509.Certificate) []string { return c.EmailAddresses }},
+		{rule.URI, func(c *x509.Certificate) []string {
+			uris := []string{}
+			for _, uri := range c.URIs {
+				uris = append(uris, uri.String())
+			}
+			return uris
+		}},
+		{rule.SPIFFEID, func(c *x509.Certificate) []string { return []string{auth.SPIFFEID(c)} }},
+	}
+
+	var pattern string
+	var identities func(*x509.Certificate) []string
+	for _, candidate := range candidates {
+		if candidate.pattern == "" {
+			continue
+		} else if identities != nil {
+			return "", nil, fmt.Errorf("rule has more than one identity pattern")
+		}
+		pattern = candidate.pattern
+		identities = candidate.identities
+	}
+	if identities == nil {
+		return "", nil, fmt.Errorf("rule has no identity pattern")
+	}
+
+	if _, err := path.Match(pattern, ""); err != nil {
+		return "", nil, fmt.Errorf("malformed identity pattern '%s'", pattern)
+	}
+
+	return pattern, identities, nil
+}
+
+type compiledMTLSRule struct {
+	pattern    string
+	identities func(*x509.Certificate) []string
+	routes     []string
+}
+
+// Authorize clients with a verified TLS client certificate, restricting each
+// certificate to the routes the rules matching its identity allow.
+type mtlsAuth struct {
+	rules []compiledMTLSRule
+}
+
+type mtlsAuthParams struct {
+	Rules []mtlsRule `json:"rules"`
+}
+
+func NewMTLSAuth(rawParameters json.RawMessage) (auth.AuthMiddleware, error) {
+	if len(rawParameters) == 0 {
+		return nil, fmt.Errorf("parameters JSON must exist")
+	}
+
+	var params mtlsAuthParams
+	err := json.Unmarshal(rawParameters, &params)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(params.Rules) == 0 {
+		return nil, fmt.Errorf("'rules' must contain at least one rule")
+	}
+
+	a := &mtlsAuth{}
+	for i, rule := range params.Rules {
+		pattern, identities, err := rule.identityPattern()
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+		for _, routePattern := range rule.Routes {
+			err := validateRoutePattern(routePattern)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: invalid route pattern: %w", i, err)
+			}
+		}
+
+		a.rules = append(a.rules, compiledMTLSRule{
+			pattern:    pattern,
+			identities: identities,
+			routes:     rule.Routes,
+		})
+	}
+
+	return a, nil
+}
+
+// certificateIdentity returns the identity of the caller presenting a client
+// certificate: its SPIFFE ID, if any, or its subject.
+func certificateIdentity(cert *x509.Certificate) auth.Identity {
+	identity := auth.Identity{
+		Name:       auth.SPIFFEID(cert),
+		Method:     "mtls",
+		Attributes: map[string]string{"subject": cert.Subject.String()},
+	}
+	if identity.Name == "" {
+		identity.Name = cert.Subject.String()
+	}
+	return identity
+}
+
+func (a *mtlsAuth) Authorize(r *http.Request, owner string, repo string) auth.AuthResult {
+	cert := auth.VerifiedClientCertificate(r)
+	if cert == nil {
+		// There's no challenge to send for a missing client certificate, so
+		// refuse the request outright.
+		return auth.Deny(403)
+	}
+
+	for _, rule := range a.rules {
+		for _, identity := range rule.identities(cert) {
+			// Patterns are validated on initialization, so ignore the error
+			if matched, _ := path.Match(rule.pattern, identity); matched && identity != "" {
+				if matchRoute(rule.routes, owner, repo) {
+					return auth.AllowAs(certificateIdentity(cert))
+				}
+				break
+			}
+		}
+	}
+
+	// Return a 404 status even though the issue is that the certificate is
+	// forbidden so we don't indirectly reveal which repositories are
+	// configured in the bundle server.
+	return auth.Deny(404)
+}
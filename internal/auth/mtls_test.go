@@ -0,0 +1,159 @@
+package auth_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+var mtlsParameters = `{
+	"rules": [
+		{ "spiffeId": "spiffe://example.org/ci/*", "routes": ["myorg/*"] },
+		{ "subject": "CN=alice,O=Example", "routes": ["team/app"] },
+		{ "commonName": "bob", "routes": ["team/*"] },
+		{ "dnsName": "*.build.example.com", "routes": ["public/*"] }
+	]
+}`
+
+func mustParseURL(rawURL string) *url.URL {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+var mtlsAuthTests = []struct {
+	title string
+
+	// Inputs
+	cert  *x509.Certificate
+	owner string
+	repo  string
+
+	// Expected outputs
+	expectedResponseCode int
+}{
+	{
+		"SPIFFE ID matches",
+		&x509.Certificate{URIs: []*url.URL{mustParseURL("spiffe://example.org/ci/runner")}},
+		"myorg", "repo",
+		200,
+	},
+	{
+		"SPIFFE ID matches, other route",
+		&x509.Certificate{URIs: []*url.URL{mustParseURL("spiffe://example.org/ci/runner")}},
+		"team", "app",
+		404,
+	},
+	{
+		"SPIFFE ID doesn't match",
+		&x509.Certificate{URIs: []*url.URL{mustParseURL("spiffe://example.org/deploy/runner")}},
+		"myorg", "repo",
+		404,
+	},
+	{
+		"Subject matches",
+		&x509.Certificate{Subject: pkix.Name{CommonName: "alice", Organization: []string{"Example"}}},
+		"team", "app",
+		200,
+	},
+	{
+		"Subject doesn't match",
+		&x509.Certificate{Subject: pkix.Name{CommonName: "alice", Organization: []string{"Other"}}},
+		"team", "app",
+		404,
+	},
+	{
+		"Common name matches",
+		&x509.Certificate{Subject: pkix.Name{CommonName: "bob", Organization: []string{"Other"}}},
+		"team", "other",
+		200,
+	},
+	{
+		"DNS SAN matches",
+		&x509.Certificate{DNSNames: []string{"other.example.com", "runner1.build.example.com"}},
+		"public", "docs",
+		200,
+	},
+	{
+		"Certificate without identity",
+		&x509.Certificate{},
+		"public", "docs",
+		404,
+	},
+	{
+		"No certificate",
+		nil,
+		"myorg", "repo",
+		403,
+	},
+}
+
+func Test_MTLSAuth(t *testing.T) {
+	middleware, err := auth.NewMTLSAuth([]byte(mtlsParameters))
+	assert.Nil(t, err)
+
+	for _, tt := range mtlsAuthTests {
+		t.Run(tt.title, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tt.owner+"/"+tt.repo, nil)
+			assert.Nil(t, err)
+			req.TLS = &tls.ConnectionState{}
+			if tt.cert != nil {
+				req.TLS.PeerCertificates = []*x509.Certificate{tt.cert}
+				req.TLS.VerifiedChains = [][]*x509.Certificate{{tt.cert}}
+			}
+
+			result := middleware.Authorize(req, tt.owner, tt.repo)
+
+			w := httptest.NewRecorder()
+			doExit := result.ApplyResult(w)
+			assert.Equal(t, tt.expectedResponseCode != 200, doExit)
+			assert.Equal(t, tt.expectedResponseCode, w.Code)
+		})
+	}
+
+	t.Run("Unverified certificate is ignored", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "myorg/repo", nil)
+		assert.Nil(t, err)
+		req.TLS = &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{
+				{URIs: []*url.URL{mustParseURL("spiffe://example.org/ci/runner")}},
+			},
+		}
+
+		result := middleware.Authorize(req, "myorg", "repo")
+
+		w := httptest.NewRecorder()
+		assert.True(t, result.ApplyResult(w))
+		assert.Equal(t, 403, w.Code)
+	})
+}
+
+var mtlsInitTests = []struct {
+	title      string
+	parameters string
+}{
+	{"Missing parameters", ""},
+	{"Missing rules", `{}`},
+	{"Rule without identity", `{ "rules": [{ "routes": ["*/*"] }] }`},
+	{"Rule with multiple identities", `{ "rules": [{ "commonName": "bob", "dnsName": "bob.example.com", "routes": ["*/*"] }] }`},
+	{"Malformed identity pattern", `{ "rules": [{ "commonName": "[bob", "routes": ["*/*"] }] }`},
+	{"Malformed route pattern", `{ "rules": [{ "commonName": "bob", "routes": ["repo"] }] }`},
+}
+
+func Test_MTLSAuth_InvalidParameters(t *testing.T) {
+	for _, tt := range mtlsInitTests {
+		t.Run(tt.title, func(t *testing.T) {
+			_, err := auth.NewMTLSAuth([]byte(tt.parameters))
+			assert.NotNil(t, err)
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/git-ecosystem/git-bundle-server/pkg/auth"
+)
+
+// parsePrefixes parses a list of CIDR blocks (e.g. '10.0.0.0/8') or single
+// addresses.
+func parsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := []netip.Prefix{}
+	for _, value := range values {
+		if strings.Contains(value, "/") {
+			prefix, err := netip.ParsePrefix(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR block '%s'", value)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+		} else {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address '%s'", value)
+			}
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+		}
+	}
+	return prefixes, nil
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseNodeAddr parses an address that may include a port and, for IPv6,
+// brackets (e.g. '192.0.2.1', '192.0.2.1:443' or '[2001:db8::1]:443').
+func parseNodeAddr(value string) (netip.Addr, error) {
+	value = strings.TrimSpace(value)
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+	addr, err := netip.ParseAddr(strings.Trim(value, "[]"))
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	return addr.Unmap(), nil
+}
+
+// The forwarding headers trusted proxies may set. Only the header configured
+// for a 'network' middleware is read: proxies typically append to one of them
+// and pass the other through from the client unchanged.
+const (
+	forwardedHeader     string = "Forwarded"
+	xForwardedForHeader string = "X-Forwarded-For"
+)
+
+// forwardedFor returns the addresses of the client and the proxies a request
+// went through (excluding the last one), as reported by the given header: the
+// 'Forwarded' header (see RFC 7239) or the 'X-Forwarded-For' header. Returns
+// false if the request has no such header.
+func forwardedFor(r *http.Request, header string) ([]string, bool) {
+	values := r.Header.Values(header)
+	if len(values) == 0 {
+		return nil, false
+	}
+
+	if header == forwardedHeader {
+		nodes := []string{}
+		for _, element := range strings.Split(strings.Join(values, ","), ",") {
+			node := ""
+			for _, pair := range strings.Split(element, ";") {
+				key, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+				if strings.EqualFold(key, "for") {
+					node = strings.Trim(value, `"`)
+				}
+			}
+			nodes = append(nodes, node)
+		}
+		return nodes, true
+	}
+
+	return strings.Split(strings.Join(values, ","), ","), true
+}
+
+// Authorize requests by the network address of the client, which is taken from
+// the forwarding header set by the trusted proxies ('X-Forwarded-For' unless
+// configured otherwise) only if the request comes from a trusted proxy.
+type networkAuth struct {
+	allow           []netip.Prefix
+	deny            []netip.Prefix
+	trustedProxies  []netip.Prefix
+	forwardedHeader string
+}
+
+type networkAuthParams struct {
+	Allow           []string `json:"allow"`
+	Deny            []string `json:"deny"`
+	TrustedProxies  []string `json:"trustedProxies"`
+	ForwardedHeader string   `json:"forwardedHeader"`
+}
+
+func NewNetworkAuth(rawParameters json.RawMessage) (auth.AuthMiddleware, error) {
+	if len(rawParameters) == 0 {
+		return nil, fmt.Errorf("parameters JSON must exist")
+	}
+
+	var params networkAuthParams
+	err := json.Unmarshal(rawParameters, &params)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(params.Allow) == 0 && len(params.Deny) == 0 {
+		return nil, fmt.Errorf("at least one of 'allow' and 'deny' must be specified")
+	}
+
+	a := &networkAuth{forwardedHeader: xForwardedForHeader}
+	switch http.CanonicalHeaderKey(params.ForwardedHeader) {
+	case "", xForwardedForHeader:
+	case forwardedHeader:
+		a.forwardedHeader = forwardedHeader
+	default:
+		return nil, fmt.Errorf("invalid 'forwardedHeader' '%s' (must be '%s' or '%s')",
+			params.ForwardedHeader, xForwardedForHeader, forwardedHeader)
+	}
+
+	a.allow, err = parsePrefixes(params.Allow)
+	if err != nil {
+		return nil, fmt.Errorf("invalid 'allow' list: %w", err)
+	}
+	a.deny, err = parsePrefixes(params.Deny)
+	if err != nil {
+		return nil, fmt.Errorf("invalid 'deny' list: %w", err)
+	}
+	a.trustedProxies, err = parsePrefixes(params.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid 'trustedProxies' list: %w", err)
+	}
+
+	return a, nil
+}
+
+// clientAddr returns the address of the client that sent the request. If the
+// request came through trusted proxies, this is the address closest to the
+// server in the forwarding headers that isn't a trusted proxy.
+func (a *networkAuth) clientAddr(r *http.Request) (netip.Addr, error) {
+	addr, err := parseNodeAddr(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("invalid remote address '%s'", r.RemoteAddr)
+	}
+
+	if !containsAddr(a.trustedProxies, addr) {
+		return addr, nil
+	}
+
+	nodes, found := forwardedFor(r, a.forwardedHeader)
+	if !found {
+		return addr, nil
+	}
+
+	// Walk back from the proxy closest to the server; the headers can only be
+	// trusted as far as they were added by trusted proxies
+	for i := len(nodes) - 1; i >= 0; i-- {
+		addr, err = parseNodeAddr(nodes[i])
+		if err != nil {
+			// Unknown or obfuscated nodes can't be checked
+			return netip.Addr{}, fmt.Errorf("invalid forwarded address '%s'", nodes[i])
+		}
+		if !containsAddr(a.trustedProxies, addr) {
+			break
+		}
+	}
+
+	return addr, nil
+}
+
+// DecisionHeaders returns the forwarding header if the client address may be
+// taken from it.
+func (a *networkAuth) DecisionHeaders() []string {
+	if len(a.trustedProxies) == 0 {
+		return nil
+	}
+	return []string{a.forwardedHeader}
+}
+
+func (a *networkAuth) Authorize(r *http.Request, _ string, _ string) auth.AuthResult {
+	addr, err := a.clientAddr(r)
+	if err != nil ||
+		containsAddr(a.deny, addr) ||
+		(len(a.allow) > 0 && !containsAddr(a.allow, addr)) {
+		// The decision doesn't depend on the route, so a 403 status doesn't
+		// reveal which repositories are configured in the bundle server.
+		return auth.Deny(403)
+	}
+
+	return auth.Allow()
+}
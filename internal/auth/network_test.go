@@ -0,0 +1,182 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+var networkParameters = `{
+	"allow": ["10.0.0.0/8", "2001:db8::/32", "192.0.2.7"],
+	"deny": ["10.13.0.0/16"],
+	"trustedProxies": ["127.0.0.1", "172.16.0.0/12"]
+}`
+
+type networkAuthTest struct {
+	title string
+
+	// Inputs
+	remoteAddr string
+	headers    map[string]string
+
+	// Expected outputs
+	expectedAllowed bool
+}
+
+var networkAuthTests = []networkAuthTest{
+	{"Allowed CIDR", "10.1.2.3:51234", nil, true},
+	{"Allowed address", "192.0.2.7:51234", nil, true},
+	{"Allowed IPv6 CIDR", "[2001:db8::1]:51234", nil, true},
+	{"IPv4-mapped IPv6 address", "[::ffff:10.1.2.3]:51234", nil, true},
+	{"Denied CIDR within allowed CIDR", "10.13.2.3:51234", nil, false},
+	{"Address not allowed", "198.51.100.1:51234", nil, false},
+	{
+		"Forwarding headers of untrusted client are ignored",
+		"198.51.100.1:51234",
+		map[string]string{"X-Forwarded-For": "10.1.2.3"},
+		false,
+	},
+	{
+		"X-Forwarded-For from trusted proxy",
+		"127.0.0.1:51234",
+		map[string]string{"X-Forwarded-For": "10.1.2.3"},
+		true,
+	},
+	{
+		"X-Forwarded-For through several trusted proxies",
+		"127.0.0.1:51234",
+		map[string]string{"X-Forwarded-For": "10.1.2.3, 172.16.0.5"},
+		true,
+	},
+	{
+		"X-Forwarded-For entries before an untrusted proxy are ignored",
+		"127.0.0.1:51234",
+		map[string]string{"X-Forwarded-For": "10.1.2.3, 198.51.100.1"},
+		false,
+	},
+	{
+		"Spoofed X-Forwarded-For entry is ignored",
+		"127.0.0.1:51234",
+		map[string]string{"X-Forwarded-For": "10.1.2.3, 10.13.2.3"},
+		false,
+	},
+	{
+		"Spoofed Forwarded header passed through by proxy is ignored",
+		"127.0.0.1:51234",
+		map[string]string{"Forwarded": "for=10.1.2.3", "X-Forwarded-For": "198.51.100.1"},
+		false,
+	},
+	{
+		"Forwarded header is not read",
+		"127.0.0.1:51234",
+		map[string]string{"Forwarded": "for=10.1.2.3"},
+		false,
+	},
+	{
+		"Trusted proxy without forwarding headers",
+		"172.16.0.5:51234",
+		nil,
+		false,
+	},
+}
+
+var networkForwardedParameters = `{
+	"allow": ["10.0.0.0/8", "2001:db8::/32"],
+	"trustedProxies": ["127.0.0.1", "172.16.0.0/12"],
+	"forwardedHeader": "forwarded"
+}`
+
+var networkForwardedTests = []networkAuthTest{
+	{
+		"Forwarded from trusted proxy",
+		"127.0.0.1:51234",
+		map[string]string{"Forwarded": `for="[2001:db8::1]:4711";proto=https, for=172.16.0.5`},
+		true,
+	},
+	{
+		"Spoofed X-Forwarded-For header passed through by proxy is ignored",
+		"127.0.0.1:51234",
+		map[string]string{"Forwarded": "for=198.51.100.1", "X-Forwarded-For": "10.1.2.3"},
+		false,
+	},
+	{
+		"Obfuscated Forwarded node is denied",
+		"127.0.0.1:51234",
+		map[string]string{"Forwarded": "for=_hidden"},
+		false,
+	},
+}
+
+func Test_NetworkAuth(t *testing.T) {
+	testNetworkAuth(t, networkParameters, networkAuthTests)
+}
+
+func Test_NetworkAuth_ForwardedHeader(t *testing.T) {
+	testNetworkAuth(t, networkForwardedParameters, networkForwardedTests)
+}
+
+func testNetworkAuth(t *testing.T, parameters string, tests []networkAuthTest) {
+	middleware, err := auth.NewNetworkAuth([]byte(parameters))
+	assert.Nil(t, err)
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "test/repo", nil)
+			assert.Nil(t, err)
+			req.RemoteAddr = tt.remoteAddr
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+
+			result := middleware.Authorize(req, "test", "repo")
+
+			w := httptest.NewRecorder()
+			doExit := result.ApplyResult(w)
+			assert.Equal(t, !tt.expectedAllowed, doExit)
+			if !tt.expectedAllowed {
+				assert.Equal(t, 403, w.Code)
+			}
+		})
+	}
+}
+
+func Test_NetworkAuth_DenyOnly(t *testing.T) {
+	middleware, err := auth.NewNetworkAuth([]byte(`{ "deny": ["198.51.100.0/24"] }`))
+	assert.Nil(t, err)
+
+	for remoteAddr, expectedAllowed := range map[string]bool{
+		"198.51.100.1:51234": false,
+		"203.0.113.1:51234":  true,
+	} {
+		req, err := http.NewRequest("GET", "test/repo", nil)
+		assert.Nil(t, err)
+		req.RemoteAddr = remoteAddr
+
+		result := middleware.Authorize(req, "test", "repo")
+		assert.Equal(t, !expectedAllowed, result.ApplyResult(httptest.NewRecorder()), remoteAddr)
+	}
+}
+
+var networkInitTests = []struct {
+	title      string
+	parameters string
+}{
+	{"Missing parameters", ""},
+	{"No allow or deny list", `{ "trustedProxies": ["127.0.0.1"] }`},
+	{"Invalid CIDR", `{ "allow": ["10.0.0.0/33"] }`},
+	{"Invalid address", `{ "deny": ["10.0.0"] }`},
+	{"Invalid proxy", `{ "allow": ["10.0.0.0/8"], "trustedProxies": ["localhost"] }`},
+	{"Invalid forwarding header", `{ "allow": ["10.0.0.0/8"], "forwardedHeader": "X-Real-IP" }`},
+}
+
+func Test_NetworkAuth_InvalidParameters(t *testing.T) {
+	for _, tt := range networkInitTests {
+		t.Run(tt.title, func(t *testing.T) {
+			_, err := auth.NewNetworkAuth([]byte(tt.parameters))
+			assert.NotNil(t, err)
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package bundles
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/utils"
+)
+
+// The reserved filename under a route that serves the route's bundle list
+// formatted as a response to the protocol v2 'bundle-uri' command.
+const BundleUriFilename string = "bundle-uri"
+
+// Maximum length of the payload of a single pkt-line (see Git's
+// 'gitprotocol-common' documentation).
+const maxPktLinePayload int = 65516
+
+// bundleUriKeyValues returns the contents of the bundle list as the ordered
+// 'bundle.*' key-value pairs used by Git in both config files and the
+// 'bundle-uri' protocol v2 command. Unlike the lists written to the web
+// directory, bundle URIs are absolute, using 'baseUrl' as the root of the
+// bundle web server: Git resolves relative URIs advertised by a remote
+// against the remote's URL, not the bundle server's.
+func bundleUriKeyValues(list *BundleList, baseUrl string) []utils.KeyValue[string, string] {
+	baseUrl = strings.TrimSuffix(baseUrl, "/")
+
+	kvs := []utils.KeyValue[string, string]{
+		utils.NewKeyValue("bundle.version", fmt.Sprintf("%d", list.Version)),
+		utils.NewKeyValue("bundle.mode", list.Mode),
+	}
+	if list.Heuristic != "" {
+		kvs = append(kvs, utils.NewKeyValue("bundle.heuristic", list.Heuristic))
+	}
+
+	for _, token := range list.sortedCreationTokens() {
+		bundle := list.Bundles[token]
+		kvs = append(kvs,
+			utils.NewKeyValue(fmt.Sprintf("bundle.%d.uri", token), baseUrl+bundle.URI),
+			utils.NewKeyValue(fmt.Sprintf("bundle.%d.creationToken", token), fmt.Sprintf("%d", token)),
+		)
+	}
+
+	return kvs
+}
+
+// WriteBundleUriPktLines writes the bundle list as the pkt-line encoded
+// response to a Git protocol v2 'bundle-uri' command, terminated by a flush
+// packet. A Git hosting server can relay this response verbatim to clients.
+func WriteBundleUriPktLines(w io.Writer, list *BundleList, baseUrl string) error {
+	out := bufio.NewWriter(w)
+
+	for _, kv := range bundleUriKeyValues(list, baseUrl) {
+		line := fmt.Sprintf("%s=%s\n", kv.Key, kv.Value)
+		if len(line) > maxPktLinePayload {
+			return fmt.Errorf("bundle list line for key '%s' is too long", kv.Key)
+		}
+
+		// The pkt-line length includes the 4 bytes of the length itself
+		_, err := fmt.Fprintf(out, "%04x%s", len(line)+4, line)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := out.WriteString("0000")
+	if err != nil {
+		return err
+	}
+
+	return out.Flush()
+}
+
+// WriteBundleUriConfig writes the bundle list in Git config format with
+// absolute bundle URIs, preceded by the setting that makes 'git upload-pack'
+// advertise it. The output can be included in the config of the repository
+// served by a Git hosting server so that clients cloning through that server
+// discover the bundle list automatically.
+func WriteBundleUriConfig(w io.Writer, list *BundleList, baseUrl string) error {
+	out := bufio.NewWriter(w)
+
+	fmt.Fprint(out, "[uploadpack]\n\tadvertiseBundleURIs = true\n\n")
+
+	lastSection := ""
+	for _, kv := range bundleUriKeyValues(list, baseUrl) {
+		// Keys are either 'bundle.<key>' or 'bundle.<id>.<key>'
+		section := "bundle"
+		key := strings.TrimPrefix(kv.Key, "bundle.")
+		if i := strings.LastIndex(key, "."); i >= 0 {
+			section = fmt.Sprintf("bundle \"%s\"", key[:i])
+			key = key[i+1:]
+		}
+
+		if section != lastSection {
+			if lastSection != "" {
+				fmt.Fprint(out, "\n")
+			}
+			fmt.Fprintf(out, "[%s]\n", section)
+			lastSection = section
+		}
+		fmt.Fprintf(out, "\t%s = %s\n", key, kv.Value)
+	}
+
+	return out.Flush()
+}
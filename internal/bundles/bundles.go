@@ -4,11 +4,14 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -24,6 +27,18 @@ const (
 	BundleListJsonFilename string = "bundle-list.json"
 	BundleListFilename     string = "bundle-list"
 	RepoBundleListFilename string = "repo-bundle-list"
+	MirrorListFilename     string = "mirror-list"
+)
+
+// Bundle list modes, as defined by Git's bundle URI specification.
+const (
+	// Every bundle in the list is needed to reconstruct the repository (e.g.,
+	// a base bundle and its incremental bundles).
+	BundleListModeAll string = "all"
+
+	// Any single bundle in the list is sufficient, i.e. every entry is a
+	// replica of the same content.
+	BundleListModeAny string = "any"
 )
 
 type BundleHeader struct {
@@ -50,7 +65,16 @@ type Bundle struct {
 }
 
 func NewBundle(repo *core.Repository, timestamp int64) Bundle {
+	return NewFilteredBundle(repo, "", timestamp)
+}
+
+// NewFilteredBundle creates a bundle containing only the objects matching the
+// given object filter. If 'filter' is empty, the bundle is unfiltered.
+func NewFilteredBundle(repo *core.Repository, filter string, timestamp int64) Bundle {
 	bundleName := fmt.Sprintf("bundle-%d.bundle", timestamp)
+	if filter != "" {
+		bundleName = fmt.Sprintf("bundle-%s-%d.bundle", FilterId(filter), timestamp)
+	}
 	return Bundle{
 		URI:           path.Join("/", repo.Route, bundleName),
 		Filename:      filepath.Join(repo.WebDir, bundleName),
@@ -63,17 +87,106 @@ type BundleList struct {
 	Mode      string
 	Heuristic string
 	Bundles   map[int64]Bundle
+
+	// The object filter (e.g. 'blob:none') applied to every bundle in the
+	// list, or empty if the bundles contain all objects.
+	Filter string `json:",omitempty"`
+
+	// The base URLs (e.g. 'https://eu.bundles.example.com') of the web servers
+	// hosting replicas of this route's content. If non-empty, an additional
+	// 'any' mode list pointing to the route on each mirror is written
+	// alongside the bundle list.
+	Mirrors []string `json:",omitempty"`
 }
 
 func NewBundleList() *BundleList {
 	return &BundleList{
 		Version:   1,
-		Mode:      "any",
+		Mode:      BundleListModeAny,
 		Heuristic: "creationToken",
 		Bundles:   make(map[int64]Bundle),
 	}
 }
 
+// ValidateFilter checks that the given object filter is one that the bundle
+// server supports for generating filtered bundles.
+func ValidateFilter(filter string) error {
+	if !filterPattern.MatchString(filter) {
+		return fmt.Errorf("unsupported filter '%s'; must be one of "+
+			"'blob:none', 'blob:limit=<n>[kmg]', or 'tree:<depth>'", filter)
+	}
+	return nil
+}
+
+var filterPattern = regexp.MustCompile(`^(blob:none|blob:limit=\d+[kmg]?|tree:\d+)$`)
+
+// FilterId returns an identifier for the given object filter that is safe to
+// use in filenames and URLs (e.g. 'blob:none' -> 'blob-none').
+func FilterId(filter string) string {
+	return strings.NewReplacer(":", "-", "=", "-").Replace(filter)
+}
+
+// FilteredBundleListFilename returns the name of the file in the route's web
+// directory listing the bundles created with the given filter.
+func FilteredBundleListFilename(filter string) string {
+	return BundleListFilename + "-" + FilterId(filter)
+}
+
+func bundleListJsonFilename(filter string) string {
+	if filter == "" {
+		return BundleListJsonFilename
+	}
+	return strings.TrimSuffix(BundleListJsonFilename, ".json") + "-" + FilterId(filter) + ".json"
+}
+
+// ValidateServerUrl checks that the given URL can be used as the base URL of a
+// bundle web server (e.g., a mirror), to which bundle URIs are appended.
+func ValidateServerUrl(serverUrl string) error {
+	u, err := url.Parse(serverUrl)
+	if err != nil {
+		return fmt.Errorf("invalid server URL '%s': %w", serverUrl, err)
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return fmt.Errorf("invalid server URL '%s': scheme must be 'http' or 'https'", serverUrl)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid server URL '%s': missing host", serverUrl)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("invalid server URL '%s': must not contain a query or fragment", serverUrl)
+	}
+
+	return nil
+}
+
+// AddMirror adds the given base URL to the list's mirrors. Returns false if
+// the mirror was already present.
+func (list *BundleList) AddMirror(mirror string) bool {
+	mirror = strings.TrimSuffix(mirror, "/")
+	for _, m := range list.Mirrors {
+		if m == mirror {
+			return false
+		}
+	}
+	list.Mirrors = append(list.Mirrors, mirror)
+	return true
+}
+
+// RemoveMirror removes the given base URL from the list's mirrors. Returns
+// false if the mirror was not found.
+func (list *BundleList) RemoveMirror(mirror string) bool {
+	mirror = strings.TrimSuffix(mirror, "/")
+	for i, m := range list.Mirrors {
+		if m == mirror {
+			list.Mirrors = append(list.Mirrors[:i], list.Mirrors[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
 func (list *BundleList) addBundle(bundle Bundle) {
 	list.Bundles[bundle.CreationToken] = bundle
 }
@@ -91,29 +204,52 @@ func (list *BundleList) sortedCreationTokens() []int64 {
 
 type BundleProvider interface {
 	CreateInitialBundle(ctx context.Context, repo *core.Repository) Bundle
-	CreateIncrementalBundle(ctx context.Context, repo *core.Repository, list *BundleList) (*Bundle, error)
+
+	// CreateIncrementalBundle fetches from the repository's remote, using the
+	// given credentials (if any), and creates a bundle of the new content.
+	CreateIncrementalBundle(ctx context.Context, repo *core.Repository, list *BundleList, credentials *git.RemoteCredentials) (*Bundle, error)
+
+	// CreateLocalIncrementalBundle is like CreateIncrementalBundle, but does
+	// not fetch from the repository's remote before creating the bundle.
+	CreateLocalIncrementalBundle(ctx context.Context, repo *core.Repository, list *BundleList) (*Bundle, error)
 
 	CreateSingletonList(ctx context.Context, bundle Bundle) *BundleList
 	WriteBundleList(ctx context.Context, list *BundleList, repo *core.Repository) error
 	GetBundleList(ctx context.Context, repo *core.Repository) (*BundleList, error)
 	CollapseList(ctx context.Context, repo *core.Repository, list *BundleList) error
+
+	// UpdateFilteredList creates the initial or next incremental bundle of the
+	// route's bundle set for the given object filter and writes its list. The
+	// repository is not fetched; filtered bundles are created from the
+	// repository's current content.
+	UpdateFilteredList(ctx context.Context, repo *core.Repository, filter string) error
+	RemoveFilteredList(ctx context.Context, repo *core.Repository, filter string) error
 }
 
+// The number of bundles in a list above which the oldest bundles are collapsed
+// into a new base bundle, unless configured otherwise.
+const DefaultMaxBundles int = 5
+
 type bundleProvider struct {
 	logger     log.TraceLogger
 	fileSystem common.FileSystem
 	gitHelper  git.GitHelper
+	maxBundles int
 }
 
+// NewBundleProvider creates a BundleProvider whose lists contain at most
+// 'maxBundles' bundles (see 'CollapseList()').
 func NewBundleProvider(
 	l log.TraceLogger,
 	fs common.FileSystem,
 	g git.GitHelper,
+	maxBundles int,
 ) BundleProvider {
 	return &bundleProvider{
 		logger:     l,
 		fileSystem: fs,
 		gitHelper:  g,
+		maxBundles: maxBundles,
 	}
 }
 
@@ -131,7 +267,7 @@ func (b *bundleProvider) createDistinctBundle(repo *core.Repository, list *Bundl
 		timestamp = maxTimestamp + 1
 	}
 
-	return NewBundle(repo, timestamp)
+	return NewFilteredBundle(repo, list.Filter, timestamp)
 }
 
 func (b *bundleProvider) CreateSingletonList(ctx context.Context, bundle Bundle) *BundleList {
@@ -146,7 +282,11 @@ func (b *bundleProvider) WriteBundleList(ctx context.Context, list *BundleList,
 	ctx, exitRegion := b.logger.Region(ctx, "bundles", "write_bundle_list")
 	defer exitRegion()
 
-	var listLockFile, repoListLockFile, jsonLockFile common.LockFile
+	if list.Filter != "" {
+		return b.writeFilteredBundleList(list, repo)
+	}
+
+	var listLockFile, repoListLockFile, mirrorListLockFile, jsonLockFile common.LockFile
 	rollbackAll := func() {
 		if listLockFile != nil {
 			listLockFile.Rollback()
@@ -154,6 +294,9 @@ func (b *bundleProvider) WriteBundleList(ctx context.Context, list *BundleList,
 		if repoListLockFile != nil {
 			repoListLockFile.Rollback()
 		}
+		if mirrorListLockFile != nil {
+			mirrorListLockFile.Rollback()
+		}
 		if jsonLockFile != nil {
 			jsonLockFile.Rollback()
 		}
@@ -211,9 +354,77 @@ func (b *bundleProvider) WriteBundleList(ctx context.Context, list *BundleList,
 		return err
 	}
 
+	// Write the list of mirrors, if any. Each entry points to the
+	// (non-trailing slash) bundle list of this route on a given mirror, so the
+	// relative bundle URIs in that list resolve against the mirror itself.
+	mirrorListFilename := filepath.Join(repo.WebDir, MirrorListFilename)
+	if len(list.Mirrors) > 0 {
+		mirrorListLockFile, err = b.fileSystem.WriteLockFileFunc(
+			mirrorListFilename,
+			func(f io.Writer) error {
+				out := bufio.NewWriter(f)
+				defer out.Flush()
+
+				fmt.Fprintf(
+					out, "[bundle]\n\tversion = %d\n\tmode = %s\n\n",
+					list.Version, BundleListModeAny)
+
+				for i, mirror := range list.Mirrors {
+					fmt.Fprintf(
+						out, "[bundle \"mirror-%d\"]\n\turi = %s\n\n",
+						i+1, strings.TrimSuffix(mirror, "/")+path.Join("/", repo.Route))
+				}
+				return nil
+			},
+		)
+		if err != nil {
+			rollbackAll()
+			return err
+		}
+	}
+
 	// Write the (internal-use) JSON representation of the bundle list
-	jsonLockFile, err = b.fileSystem.WriteLockFileFunc(
-		filepath.Join(repo.RepoDir, BundleListJsonFilename),
+	jsonLockFile, err = b.writeJsonLockFile(list, repo)
+	if err != nil {
+		rollbackAll()
+		return err
+	}
+
+	// Commit all lockfiles
+	err = jsonLockFile.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to rename JSON file: %w", err)
+	}
+
+	err = listLockFile.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to rename bundle list file: %w", err)
+	}
+
+	err = repoListLockFile.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to rename repo-level bundle list file: %w", err)
+	}
+
+	if mirrorListLockFile != nil {
+		err = mirrorListLockFile.Commit()
+		if err != nil {
+			return fmt.Errorf("failed to rename mirror list file: %w", err)
+		}
+	} else {
+		// No mirrors, so make sure we're not serving a stale mirror list
+		_, err = b.fileSystem.DeleteFile(mirrorListFilename)
+		if err != nil {
+			return fmt.Errorf("failed to remove mirror list file: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (b *bundleProvider) writeJsonLockFile(list *BundleList, repo *core.Repository) (common.LockFile, error) {
+	return b.fileSystem.WriteLockFileFunc(
+		filepath.Join(repo.RepoDir, bundleListJsonFilename(list.Filter)),
 		func(f io.Writer) error {
 			data, err := json.Marshal(list)
 			if err != nil {
@@ -232,25 +443,51 @@ func (b *bundleProvider) WriteBundleList(ctx context.Context, list *BundleList,
 			return nil
 		},
 	)
+}
+
+// writeFilteredBundleList writes the list of a filtered bundle set. Unlike the
+// full bundle list, a filtered list is only served at
+// '/<route>/<list filename>', so the bundle URIs are always relative to the
+// route directory.
+func (b *bundleProvider) writeFilteredBundleList(list *BundleList, repo *core.Repository) error {
+	listLockFile, err := b.fileSystem.WriteLockFileFunc(
+		filepath.Join(repo.WebDir, FilteredBundleListFilename(list.Filter)),
+		func(f io.Writer) error {
+			out := bufio.NewWriter(f)
+			defer out.Flush()
+
+			fmt.Fprintf(
+				out, "[bundle]\n\tversion = %d\n\tmode = %s\n\theuristic = %s\n\n",
+				list.Version, list.Mode, list.Heuristic)
+
+			for _, token := range list.sortedCreationTokens() {
+				bundle := list.Bundles[token]
+				fmt.Fprintf(
+					out, "[bundle \"%d\"]\n\turi = %s\n\tcreationToken = %d\n\n",
+					token, path.Base(bundle.URI), token)
+			}
+			return nil
+		},
+	)
 	if err != nil {
-		rollbackAll()
 		return err
 	}
 
-	// Commit all lockfiles
-	err = jsonLockFile.Commit()
+	jsonLockFile, err := b.writeJsonLockFile(list, repo)
 	if err != nil {
-		return fmt.Errorf("failed to rename JSON file: %w", err)
+		listLockFile.Rollback()
+		return err
 	}
 
-	err = listLockFile.Commit()
+	err = jsonLockFile.Commit()
 	if err != nil {
-		return fmt.Errorf("failed to rename bundle list file: %w", err)
+		listLockFile.Rollback()
+		return fmt.Errorf("failed to rename JSON file: %w", err)
 	}
 
-	err = repoListLockFile.Commit()
+	err = listLockFile.Commit()
 	if err != nil {
-		return fmt.Errorf("failed to rename repo-level bundle list file: %w", err)
+		return fmt.Errorf("failed to rename filtered bundle list file: %w", err)
 	}
 
 	return nil
@@ -261,12 +498,17 @@ func (b *bundleProvider) GetBundleList(ctx context.Context, repo *core.Repositor
 	ctx, exitRegion := b.logger.Region(ctx, "bundles", "get_bundle_list")
 	defer exitRegion()
 
-	jsonFile := filepath.Join(repo.RepoDir, BundleListJsonFilename)
+	return b.readBundleList(repo, "")
+}
+
+func (b *bundleProvider) readBundleList(repo *core.Repository, filter string) (*BundleList, error) {
+	jsonFile := filepath.Join(repo.RepoDir, bundleListJsonFilename(filter))
 
 	reader, err := os.Open(jsonFile)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
+	defer reader.Close()
 
 	var list BundleList
 	err = json.NewDecoder(reader).Decode(&list)
@@ -364,16 +606,30 @@ func (b *bundleProvider) getAllPrereqsForIncrementalBundle(list *BundleList) ([]
 	return prereqs, nil
 }
 
-func (b *bundleProvider) CreateIncrementalBundle(ctx context.Context, repo *core.Repository, list *BundleList) (*Bundle, error) {
+func (b *bundleProvider) CreateIncrementalBundle(ctx context.Context, repo *core.Repository, list *BundleList, credentials *git.RemoteCredentials) (*Bundle, error) {
 	ctx, exitRegion := b.logger.Region(ctx, "bundles", "create_incremental_bundle")
 	defer exitRegion()
 
 	// Fetch latest updates to repo
-	err := b.gitHelper.UpdateBareRepo(ctx, repo.RepoDir)
+	err := b.gitHelper.UpdateBareRepo(ctx, repo.RepoDir, credentials)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch updates to repo: %w", err)
 	}
 
+	return b.bundleNewContent(ctx, repo, list)
+}
+
+func (b *bundleProvider) CreateLocalIncrementalBundle(ctx context.Context, repo *core.Repository, list *BundleList) (*Bundle, error) {
+	ctx, exitRegion := b.logger.Region(ctx, "bundles", "create_local_incremental_bundle")
+	defer exitRegion()
+
+	return b.bundleNewContent(ctx, repo, list)
+}
+
+// bundleNewContent creates a bundle containing the content of the repository
+// that is not already in the bundles of 'list'. If there is no new content, no
+// bundle is created and nil is returned.
+func (b *bundleProvider) bundleNewContent(ctx context.Context, repo *core.Repository, list *BundleList) (*Bundle, error) {
 	bundle := b.createDistinctBundle(repo, list)
 
 	lines, err := b.getAllPrereqsForIncrementalBundle(list)
@@ -381,7 +637,7 @@ func (b *bundleProvider) CreateIncrementalBundle(ctx context.Context, repo *core
 		return nil, err
 	}
 
-	written, err := b.gitHelper.CreateIncrementalBundle(ctx, repo.RepoDir, bundle.Filename, lines)
+	written, err := b.gitHelper.CreateIncrementalBundle(ctx, repo.RepoDir, bundle.Filename, lines, list.Filter)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create incremental bundle: %w", err)
 	}
@@ -397,7 +653,7 @@ func (b *bundleProvider) CollapseList(ctx context.Context, repo *core.Repository
 	ctx, exitRegion := b.logger.Region(ctx, "bundles", "collapse_list")
 	defer exitRegion()
 
-	maxBundles := 5
+	maxBundles := b.maxBundles
 
 	if len(list.Bundles) <= maxBundles {
 		return nil
@@ -440,9 +696,9 @@ func (b *bundleProvider) CollapseList(ctx context.Context, repo *core.Repository
 	// branches that were never merged and may have been force-pushed or
 	// deleted.
 
-	bundle := NewBundle(repo, maxTimestamp)
+	bundle := NewFilteredBundle(repo, list.Filter, maxTimestamp)
 
-	err := b.gitHelper.CreateBundleFromRefs(ctx, repo.RepoDir, bundle.Filename, refs)
+	err := b.gitHelper.CreateBundleFromRefs(ctx, repo.RepoDir, bundle.Filename, refs, list.Filter)
 	if err != nil {
 		return err
 	}
@@ -450,3 +706,81 @@ func (b *bundleProvider) CollapseList(ctx context.Context, repo *core.Repository
 	list.Bundles[maxTimestamp] = bundle
 	return nil
 }
+
+func (b *bundleProvider) UpdateFilteredList(ctx context.Context, repo *core.Repository, filter string) error {
+	ctx, exitRegion := b.logger.Region(ctx, "bundles", "update_filtered_list")
+	defer exitRegion()
+
+	listExists, err := b.fileSystem.FileExists(filepath.Join(repo.RepoDir, bundleListJsonFilename(filter)))
+	if err != nil {
+		return fmt.Errorf("could not determine whether '%s' bundle list exists: %w", filter, err)
+	}
+
+	var list *BundleList
+	if !listExists {
+		// Create the initial bundle of the set
+		bundle := NewFilteredBundle(repo, filter, time.Now().UTC().Unix())
+		written, err := b.gitHelper.CreateBundle(ctx, repo.RepoDir, bundle.Filename, filter)
+		if err != nil {
+			return fmt.Errorf("failed to create '%s' bundle: %w", filter, err)
+		}
+		if !written {
+			return fmt.Errorf("refused to write empty '%s' bundle", filter)
+		}
+
+		list = b.CreateSingletonList(ctx, bundle)
+		list.Filter = filter
+	} else {
+		list, err = b.readBundleList(repo, filter)
+		if err != nil {
+			return fmt.Errorf("failed to load '%s' bundle list: %w", filter, err)
+		}
+
+		bundle, err := b.bundleNewContent(ctx, repo, list)
+		if err != nil {
+			return fmt.Errorf("failed to create incremental '%s' bundle: %w", filter, err)
+		}
+		if bundle == nil {
+			// Nothing new!
+			return nil
+		}
+
+		list.Bundles[bundle.CreationToken] = *bundle
+		err = b.CollapseList(ctx, repo, list)
+		if err != nil {
+			return err
+		}
+	}
+
+	return b.WriteBundleList(ctx, list, repo)
+}
+
+func (b *bundleProvider) RemoveFilteredList(ctx context.Context, repo *core.Repository, filter string) error {
+	ctx, exitRegion := b.logger.Region(ctx, "bundles", "remove_filtered_list")
+	defer exitRegion()
+
+	list, err := b.readBundleList(repo, filter)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			// The list was never created, so there's nothing to remove
+			return nil
+		}
+		return fmt.Errorf("failed to load '%s' bundle list: %w", filter, err)
+	}
+
+	// Stop serving the list before removing its bundles
+	filenames := []string{filepath.Join(repo.WebDir, FilteredBundleListFilename(filter))}
+	for _, bundle := range list.Bundles {
+		filenames = append(filenames, bundle.Filename)
+	}
+	filenames = append(filenames, filepath.Join(repo.RepoDir, bundleListJsonFilename(filter)))
+
+	for _, filename := range filenames {
+		_, err = b.fileSystem.DeleteFile(filename)
+		if err != nil {
+			return fmt.Errorf("failed to remove '%s': %w", filename, err)
+		}
+	}
+
+	return nil
+}
@@ -3,12 +3,15 @@ package bundles_test
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io"
+	"os"
 	"path/filepath"
 	"testing"
 
 	"github.com/git-ecosystem/git-bundle-server/internal/bundles"
 	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/git"
 	. "github.com/git-ecosystem/git-bundle-server/internal/testhelpers"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -24,6 +27,7 @@ var writeBundleListTests = []struct {
 	// Expected values
 	bundleListFile     []string
 	repoBundleListFile []string
+	mirrorListFile     []string // nil if no mirror list should be written
 
 	// Expected output
 	expectErr bool
@@ -55,6 +59,7 @@ var writeBundleListTests = []struct {
 			`	heuristic = creationToken`,
 			``,
 		},
+		nil,
 		false,
 	},
 	{
@@ -98,6 +103,7 @@ var writeBundleListTests = []struct {
 			`	creationToken = 1`,
 			``,
 		},
+		nil,
 		false,
 	},
 	{
@@ -167,6 +173,66 @@ var writeBundleListTests = []struct {
 			`	creationToken = 5`,
 			``,
 		},
+		nil,
+		false,
+	},
+	{
+		"Bundle list with mirrors",
+		&bundles.BundleList{
+			Version:   1,
+			Mode:      "all",
+			Heuristic: "creationToken",
+			Bundles: map[int64]bundles.Bundle{
+				1: {
+					URI:           "/test/myrepo/bundle-1.bundle",
+					Filename:      "/test/home/git-bundle-server/www/test/myrepo/bundle-1.bundle",
+					CreationToken: 1,
+				},
+			},
+			Mirrors: []string{
+				"https://us.bundles.example.com",
+				"https://eu.bundles.example.com/",
+			},
+		},
+		&core.Repository{
+			Route:   "test/myrepo",
+			RepoDir: "/test/home/git-bundle-server/git/test/myrepo/",
+			WebDir:  "/test/home/git-bundle-server/www/test/myrepo/",
+		},
+		[]string{
+			`[bundle]`,
+			`	version = 1`,
+			`	mode = all`,
+			`	heuristic = creationToken`,
+			``,
+			`[bundle "1"]`,
+			`	uri = bundle-1.bundle`,
+			`	creationToken = 1`,
+			``,
+		},
+		[]string{
+			`[bundle]`,
+			`	version = 1`,
+			`	mode = all`,
+			`	heuristic = creationToken`,
+			``,
+			`[bundle "1"]`,
+			`	uri = myrepo/bundle-1.bundle`,
+			`	creationToken = 1`,
+			``,
+		},
+		[]string{
+			`[bundle]`,
+			`	version = 1`,
+			`	mode = any`,
+			``,
+			`[bundle "mirror-1"]`,
+			`	uri = https://us.bundles.example.com/test/myrepo`,
+			``,
+			`[bundle "mirror-2"]`,
+			`	uri = https://eu.bundles.example.com/test/myrepo`,
+			``,
+		},
 		false,
 	},
 }
@@ -183,7 +249,7 @@ func TestBundles_WriteBundleList(t *testing.T) {
 	var mockWriteFunc func(io.Writer) error
 	var writeErr error
 
-	bundleProvider := bundles.NewBundleProvider(testLogger, testFileSystem, nil)
+	bundleProvider := bundles.NewBundleProvider(testLogger, testFileSystem, nil, bundles.DefaultMaxBundles)
 	for _, tt := range writeBundleListTests {
 		t.Run(tt.title, func(t *testing.T) {
 			// Set up mocks
@@ -209,6 +275,25 @@ func TestBundles_WriteBundleList(t *testing.T) {
 				func(mock.Arguments) { writeErr = mockWriteFunc(repoBundleListBuf) },
 			).Return(repoBundleListLockFile, writeErr).Once()
 
+			mirrorListBuf := &bytes.Buffer{}
+			if tt.mirrorListFile != nil {
+				mirrorListLockFile := &MockLockFile{}
+				mirrorListLockFile.On("Commit").Return(nil).Once()
+				testFileSystem.On("WriteLockFileFunc",
+					filepath.Join(tt.repo.WebDir, bundles.MirrorListFilename),
+					mock.MatchedBy(func(writeFunc func(io.Writer) error) bool {
+						mockWriteFunc = writeFunc
+						return true
+					}),
+				).Run(
+					func(mock.Arguments) { writeErr = mockWriteFunc(mirrorListBuf) },
+				).Return(mirrorListLockFile, writeErr).Once()
+			} else {
+				testFileSystem.On("DeleteFile",
+					filepath.Join(tt.repo.WebDir, bundles.MirrorListFilename),
+				).Return(false, nil).Once()
+			}
+
 			jsonLockFile := &MockLockFile{}
 			jsonLockFile.On("Commit").Return(nil).Once()
 			testFileSystem.On("WriteLockFileFunc",
@@ -234,8 +319,191 @@ func TestBundles_WriteBundleList(t *testing.T) {
 			expectedRepoBundleList := ConcatLines(tt.repoBundleListFile)
 			assert.Equal(t, expectedRepoBundleList, actualRepoBundleList)
 
+			if tt.mirrorListFile != nil {
+				actualMirrorList := mirrorListBuf.String()
+				expectedMirrorList := ConcatLines(tt.mirrorListFile)
+				assert.Equal(t, expectedMirrorList, actualMirrorList)
+			}
+			mock.AssertExpectationsForObjects(t, testFileSystem)
+
 			// Reset mocks
 			testFileSystem.Mock = mock.Mock{}
 		})
 	}
 }
+
+var bundleUriTestList = &bundles.BundleList{
+	Version:   1,
+	Mode:      "all",
+	Heuristic: "creationToken",
+	Bundles: map[int64]bundles.Bundle{
+		5: {
+			URI:           "/test/myrepo/bundle-5.bundle",
+			Filename:      "/test/home/git-bundle-server/www/test/myrepo/bundle-5.bundle",
+			CreationToken: 5,
+		},
+		1: {
+			URI:           "/test/myrepo/bundle-1.bundle",
+			Filename:      "/test/home/git-bundle-server/www/test/myrepo/bundle-1.bundle",
+			CreationToken: 1,
+		},
+	},
+}
+
+func TestBundles_WriteBundleUriPktLines(t *testing.T) {
+	t.Run("List is written as sorted, flush-terminated pkt-lines", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		err := bundles.WriteBundleUriPktLines(out, bundleUriTestList, "https://bundles.example.com/")
+		assert.Nil(t, err)
+
+		expected := "0015bundle.version=1\n" +
+			"0014bundle.mode=all\n" +
+			"0023bundle.heuristic=creationToken\n" +
+			"0049bundle.1.uri=https://bundles.example.com/test/myrepo/bundle-1.bundle\n" +
+			"001dbundle.1.creationToken=1\n" +
+			"0049bundle.5.uri=https://bundles.example.com/test/myrepo/bundle-5.bundle\n" +
+			"001dbundle.5.creationToken=5\n" +
+			"0000"
+		assert.Equal(t, expected, out.String())
+	})
+}
+
+func TestBundles_WriteBundleUriConfig(t *testing.T) {
+	t.Run("List is written as Git config with absolute URIs", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		err := bundles.WriteBundleUriConfig(out, bundleUriTestList, "https://bundles.example.com")
+		assert.Nil(t, err)
+
+		expected := ConcatLines([]string{
+			`[uploadpack]`,
+			`	advertiseBundleURIs = true`,
+			``,
+			`[bundle]`,
+			`	version = 1`,
+			`	mode = all`,
+			`	heuristic = creationToken`,
+			``,
+			`[bundle "1"]`,
+			`	uri = https://bundles.example.com/test/myrepo/bundle-1.bundle`,
+			`	creationToken = 1`,
+			``,
+			`[bundle "5"]`,
+			`	uri = https://bundles.example.com/test/myrepo/bundle-5.bundle`,
+			`	creationToken = 5`,
+		})
+		assert.Equal(t, expected, out.String())
+	})
+}
+
+var validateFilterTests = []struct {
+	filter   string
+	expectOk bool
+	filterId string
+}{
+	{"blob:none", true, "blob-none"},
+	{"blob:limit=1024", true, "blob-limit-1024"},
+	{"blob:limit=1m", true, "blob-limit-1m"},
+	{"tree:0", true, "tree-0"},
+	{"blob:limit=", false, ""},
+	{"tree:none", false, ""},
+	{"sparse:oid=HEAD:sparse", false, ""},
+	{"combine:blob:none+tree:0", false, ""},
+	{"", false, ""},
+}
+
+func TestBundles_ValidateFilter(t *testing.T) {
+	for _, tt := range validateFilterTests {
+		t.Run(fmt.Sprintf("'%s'", tt.filter), func(t *testing.T) {
+			err := bundles.ValidateFilter(tt.filter)
+			if tt.expectOk {
+				assert.Nil(t, err)
+				assert.Equal(t, tt.filterId, bundles.FilterId(tt.filter))
+			} else {
+				assert.NotNil(t, err)
+			}
+		})
+	}
+}
+
+func TestBundles_NewBundleList(t *testing.T) {
+	list := bundles.NewBundleList()
+	assert.Equal(t, 1, list.Version)
+	assert.Equal(t, bundles.BundleListModeAny, list.Mode)
+	assert.Equal(t, "creationToken", list.Heuristic)
+	assert.Empty(t, list.Bundles)
+	assert.Empty(t, list.Mirrors)
+}
+
+var createIncrementalBundleTests = []struct {
+	title string
+
+	local bool
+
+	// Expected values
+	expectFetch bool
+}{
+	{
+		"Fetches before bundling",
+		false,
+		true,
+	},
+	{
+		"Local bundle doesn't fetch",
+		true,
+		false,
+	},
+}
+
+func TestBundles_CreateIncrementalBundle(t *testing.T) {
+	testLogger := &MockTraceLogger{}
+
+	for _, tt := range createIncrementalBundleTests {
+		t.Run(tt.title, func(t *testing.T) {
+			testGitHelper := &MockGitHelper{}
+			bundleProvider := bundles.NewBundleProvider(testLogger, nil, testGitHelper, bundles.DefaultMaxBundles)
+
+			repo := &core.Repository{
+				Route:   "test/repo",
+				RepoDir: t.TempDir(),
+				WebDir:  t.TempDir(),
+			}
+
+			// The existing bundle's tips are the prerequisites of the new one
+			list := bundles.NewBundleList()
+			base := bundles.NewBundle(repo, 1)
+			err := os.WriteFile(base.Filename, []byte(
+				"# v2 git bundle\n"+
+					"1111111111111111111111111111111111111111 refs/heads/main\n"+
+					"\n"), 0o600)
+			assert.Nil(t, err)
+			list.Bundles[base.CreationToken] = base
+
+			if tt.expectFetch {
+				testGitHelper.On("UpdateBareRepo", mock.Anything, repo.RepoDir, (*git.RemoteCredentials)(nil)).Return(nil).Once()
+			}
+			testGitHelper.On("CreateIncrementalBundle",
+				mock.Anything,
+				repo.RepoDir,
+				mock.AnythingOfType("string"),
+				[]string{"^1111111111111111111111111111111111111111"},
+				"",
+			).Return(true, nil).Once()
+
+			var bundle *bundles.Bundle
+			if tt.local {
+				bundle, err = bundleProvider.CreateLocalIncrementalBundle(context.Background(), repo, list)
+			} else {
+				bundle, err = bundleProvider.CreateIncrementalBundle(context.Background(), repo, list, nil)
+			}
+
+			assert.Nil(t, err)
+			if assert.NotNil(t, bundle) {
+				assert.Greater(t, bundle.CreationToken, base.CreationToken)
+			}
+			testGitHelper.AssertExpectations(t)
+			if !tt.expectFetch {
+				testGitHelper.AssertNotCalled(t, "UpdateBareRepo", mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
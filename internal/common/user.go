@@ -6,6 +6,9 @@ import (
 
 type UserProvider interface {
 	CurrentUser() (*user.User, error)
+
+	// LookupUser returns the user account with the given username.
+	LookupUser(username string) (*user.User, error)
 }
 
 type userProvider struct{}
@@ -17,3 +20,7 @@ func NewUserProvider() UserProvider {
 func (u *userProvider) CurrentUser() (*user.User, error) {
 	return user.Current()
 }
+
+func (u *userProvider) LookupUser(username string) (*user.User, error) {
+	return user.Lookup(username)
+}
@@ -0,0 +1,55 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/common"
+)
+
+const ServerConfigFilename string = "config.json"
+
+// ServerConfig contains the settings shared by all git-bundle-server commands
+// and daemons (e.g. 'root' or 'web-server.port'), stored as a flat JSON object
+// of strings. Settings given on the command line or in the environment take
+// precedence over the config.
+type ServerConfig map[string]string
+
+// ReadServerConfig reads the server config of the given user. If no config has
+// been written, an empty config is returned.
+func ReadServerConfig(user *user.User) (ServerConfig, error) {
+	config := ServerConfig{}
+
+	data, err := os.ReadFile(ServerConfigFile(user))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return config, nil
+		}
+		return nil, fmt.Errorf("failed to read server config: %w", err)
+	}
+
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse server config '%s': %w", ServerConfigFile(user), err)
+	}
+
+	return config, nil
+}
+
+// WriteServerConfig replaces the server config of the given user.
+func WriteServerConfig(fs common.FileSystem, user *user.User, config ServerConfig) error {
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to convert server config to JSON: %w", err)
+	}
+
+	err = fs.WriteFile(ServerConfigFile(user), append(data, '\n'))
+	if err != nil {
+		return fmt.Errorf("failed to write server config: %w", err)
+	}
+
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"regexp"
 	"strings"
 
 	"github.com/git-ecosystem/git-bundle-server/internal/cmd"
@@ -16,12 +17,47 @@ type cronSchedule string
 
 const (
 	CronDaily  cronSchedule = "0 0 * * *"
-	CronWeekly cronSchedule = "0 0 0 * *"
+	CronWeekly cronSchedule = "0 0 * * 0"
+)
+
+// ParseCronSchedule validates a cron expression consisting of the five
+// standard time and date fields (e.g. '*/15 * * * *').
+func ParseCronSchedule(expr string) (cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return "", fmt.Errorf("invalid cron expression '%s': expected 5 fields, got %d", expr, len(fields))
+	}
+
+	validField := regexp.MustCompile(`^[\w*/,-]+$`)
+	for _, field := range fields {
+		if !validField.MatchString(field) {
+			return "", fmt.Errorf("invalid cron expression '%s': invalid field '%s'", expr, field)
+		}
+	}
+
+	return cronSchedule(strings.Join(fields, " ")), nil
+}
+
+// The comments delimiting the region of the crontab owned by the bundle
+// server. Everything between them is replaced whenever the job is updated.
+const (
+	cronRegionBegin string = "# BEGIN git-bundle-server (managed automatically; do not edit)"
+	cronRegionEnd   string = "# END git-bundle-server"
 )
 
 type CronScheduler interface {
-	AddJob(ctx context.Context, schedule cronSchedule,
+	// GetJob returns the schedule of the bundle server's cron job, or false if
+	// no job is configured.
+	GetJob(ctx context.Context) (cronSchedule, bool, error)
+
+	// SetJob replaces the bundle server's region of the crontab with a job
+	// running the given executable on 'schedule'.
+	SetJob(ctx context.Context, schedule cronSchedule,
 		exePath string, args []string) error
+
+	// RemoveJob removes the bundle server's region from the crontab, if it
+	// exists.
+	RemoveJob(ctx context.Context) error
 }
 
 type cronScheduler struct {
@@ -47,9 +83,13 @@ func NewCronScheduler(
 
 func (c *cronScheduler) loadExistingSchedule(ctx context.Context) ([]byte, error) {
 	buffer := bytes.Buffer{}
-	exitCode, err := c.cmdExec.Run(ctx, "crontab", []string{"-l"}, cmd.Stdout(&buffer))
+	stderr := bytes.Buffer{}
+	exitCode, err := c.cmdExec.Run(ctx, "crontab", []string{"-l"}, cmd.Stdout(&buffer), cmd.Stderr(&stderr))
 	if err != nil {
 		return nil, c.logger.Error(ctx, err)
+	} else if exitCode == 1 && strings.Contains(stderr.String(), "no crontab") {
+		// The user doesn't have a crontab yet
+		return []byte{}, nil
 	} else if exitCode != 0 {
 		return nil, c.logger.Errorf(ctx, "'crontab' exited with status %d", exitCode)
 	}
@@ -68,34 +108,51 @@ func (c *cronScheduler) commitCronSchedule(ctx context.Context, filename string)
 	return nil
 }
 
-func (c *cronScheduler) AddJob(ctx context.Context,
-	schedule cronSchedule,
-	exePath string,
-	args []string,
-) error {
-	newSchedule := fmt.Sprintf("%s \"%s\" %s",
-		schedule,
-		exePath,
-		utils.Map(args, func(s string) string { return "\"" + s + "\"" }),
-	)
+// splitCronRegion splits the lines of a crontab into those before the bundle
+// server's region, those inside it (excluding the delimiters), and those after
+// it. If there is no region, all lines are returned in 'before'.
+func splitCronRegion(schedule string) (before []string, region []string, after []string) {
+	lines := strings.Split(strings.TrimSuffix(schedule, "\n"), "\n")
+	if schedule == "" {
+		lines = []string{}
+	}
 
-	scheduleBytes, err := c.loadExistingSchedule(ctx)
-	if err != nil {
-		return c.logger.Errorf(ctx, "failed to get existing cron schedule: %w", err)
+	begin, end := -1, -1
+	for i, line := range lines {
+		if begin < 0 && strings.HasPrefix(line, "# BEGIN git-bundle-server") {
+			begin = i
+		} else if begin >= 0 && line == cronRegionEnd {
+			end = i
+			break
+		}
 	}
 
-	scheduleStr := string(scheduleBytes)
+	if begin < 0 {
+		return lines, nil, nil
+	} else if end < 0 {
+		// Unterminated region; assume it extends to the end of the file
+		end = len(lines)
+	}
 
-	// TODO: Use comments to indicate a "region" where our schedule
-	// is set, so we can remove the entire region even if we update
-	// the schedule in the future.
-	if strings.Contains(scheduleStr, newSchedule) {
-		// We already have this schedule, so skip modifying
-		// the crontab schedule.
-		return nil
+	before = lines[:begin]
+	region = lines[begin+1 : end]
+	if end < len(lines) {
+		after = lines[end+1:]
 	}
+	return before, region, after
+}
 
-	scheduleBytes = append(scheduleBytes, []byte(schedule)...)
+// writeCronSchedule installs the given crontab lines, unless they match the
+// existing crontab.
+func (c *cronScheduler) writeCronSchedule(ctx context.Context, existing string, lines []string) error {
+	newSchedule := ""
+	if len(lines) > 0 {
+		newSchedule = strings.Join(lines, "\n") + "\n"
+	}
+	if newSchedule == existing {
+		// Nothing to change
+		return nil
+	}
 
 	user, err := c.user.CurrentUser()
 	if err != nil {
@@ -103,7 +160,8 @@ func (c *cronScheduler) AddJob(ctx context.Context,
 	}
 	scheduleFile := CrontabFile(user)
 
-	err = c.fileSystem.WriteFile(scheduleFile, scheduleBytes)
+	// 'crontab' replaces the whole schedule at once, so the update is atomic
+	err = c.fileSystem.WriteFile(scheduleFile, []byte(newSchedule))
 	if err != nil {
 		return c.logger.Errorf(ctx, "failed to write new cron schedule to temp file: %w", err)
 	}
@@ -120,3 +178,70 @@ func (c *cronScheduler) AddJob(ctx context.Context,
 
 	return nil
 }
+
+func (c *cronScheduler) GetJob(ctx context.Context) (cronSchedule, bool, error) {
+	scheduleBytes, err := c.loadExistingSchedule(ctx)
+	if err != nil {
+		return "", false, c.logger.Errorf(ctx, "failed to get existing cron schedule: %w", err)
+	}
+
+	_, region, _ := splitCronRegion(string(scheduleBytes))
+	for _, line := range region {
+		fields := strings.Fields(line)
+		if len(fields) < 6 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		schedule, err := ParseCronSchedule(strings.Join(fields[:5], " "))
+		if err != nil {
+			return "", false, err
+		}
+		return schedule, true, nil
+	}
+
+	return "", false, nil
+}
+
+// cronQuote quotes a string for use as a single word in the command of a cron
+// job, which is run by the shell after cron replaces each unescaped '%' with a
+// newline.
+func cronQuote(s string) string {
+	quoted := "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+	return strings.ReplaceAll(quoted, "%", `\%`)
+}
+
+func (c *cronScheduler) SetJob(ctx context.Context,
+	schedule cronSchedule,
+	exePath string,
+	args []string,
+) error {
+	job := fmt.Sprintf("%s %s", schedule, cronQuote(exePath))
+	if len(args) > 0 {
+		job += " " + strings.Join(utils.Map(args, cronQuote), " ")
+	}
+
+	scheduleBytes, err := c.loadExistingSchedule(ctx)
+	if err != nil {
+		return c.logger.Errorf(ctx, "failed to get existing cron schedule: %w", err)
+	}
+
+	before, _, after := splitCronRegion(string(scheduleBytes))
+	lines := append([]string{}, before...)
+	lines = append(lines, cronRegionBegin, job, cronRegionEnd)
+	lines = append(lines, after...)
+
+	return c.writeCronSchedule(ctx, string(scheduleBytes), lines)
+}
+
+func (c *cronScheduler) RemoveJob(ctx context.Context) error {
+	scheduleBytes, err := c.loadExistingSchedule(ctx)
+	if err != nil {
+		return c.logger.Errorf(ctx, "failed to get existing cron schedule: %w", err)
+	}
+
+	before, _, after := splitCronRegion(string(scheduleBytes))
+	lines := append([]string{}, before...)
+	lines = append(lines, after...)
+
+	return c.writeCronSchedule(ctx, string(scheduleBytes), lines)
+}
@@ -0,0 +1,244 @@
+package core_test
+
+import (
+	"context"
+	"io"
+	"os/user"
+	"testing"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/cmd"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	. "github.com/git-ecosystem/git-bundle-server/internal/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const testCrontabFile = "/my/test/dir/git-bundle-server/cron-schedule"
+
+const testCronRegion = `# BEGIN git-bundle-server (managed automatically; do not edit)
+0 0 * * * '/usr/bin/git-bundle-server' 'update-all'
+# END git-bundle-server
+`
+
+// mockCrontabList mocks 'crontab -l', writing the given output to stdout (or,
+// for a nonzero exit code, stderr).
+func mockCrontabList(testCommandExecutor *MockCommandExecutor, output string, exitCode int) {
+	var stdout, stderr io.Writer
+	testCommandExecutor.On("Run",
+		mock.Anything,
+		"crontab",
+		[]string{"-l"},
+		mock.MatchedBy(func(settings []cmd.Setting) bool {
+			for _, setting := range settings {
+				switch setting.Key {
+				case cmd.StdoutKey:
+					stdout = setting.Value.(io.Writer)
+				case cmd.StderrKey:
+					stderr = setting.Value.(io.Writer)
+				}
+			}
+			return stdout != nil && stderr != nil
+		}),
+	).Run(func(mock.Arguments) {
+		if exitCode == 0 {
+			stdout.Write([]byte(output))
+		} else {
+			stderr.Write([]byte(output))
+		}
+	}).Return(exitCode, nil).Once()
+}
+
+var setJobTests = []struct {
+	title string
+
+	existingCrontab string
+	crontabExitCode int
+	schedule        string
+	args            []string
+
+	// Expected values; an empty string means the crontab is not written
+	expectedCrontab string
+}{
+	{
+		"No crontab, region is added",
+		"no crontab for testuser\n",
+		1,
+		"0 0 * * *",
+		[]string{"update-all"},
+		testCronRegion,
+	},
+	{
+		"Other jobs are preserved",
+		"# my job\n*/5 * * * * /usr/bin/true\n",
+		0,
+		"0 0 * * *",
+		[]string{"update-all"},
+		"# my job\n*/5 * * * * /usr/bin/true\n" + testCronRegion,
+	},
+	{
+		"Existing region is replaced",
+		"*/5 * * * * /usr/bin/true\n" + testCronRegion + "@reboot /usr/bin/true\n",
+		0,
+		"*/15 * * * *",
+		[]string{"update-all"},
+		"*/5 * * * * /usr/bin/true\n" +
+			"# BEGIN git-bundle-server (managed automatically; do not edit)\n" +
+			"*/15 * * * * '/usr/bin/git-bundle-server' 'update-all'\n" +
+			"# END git-bundle-server\n" +
+			"@reboot /usr/bin/true\n",
+	},
+	{
+		"Unchanged region is not rewritten",
+		"*/5 * * * * /usr/bin/true\n" + testCronRegion,
+		0,
+		"0 0 * * *",
+		[]string{"update-all"},
+		"",
+	},
+	{
+		"Previous double-quoted region is rewritten",
+		"# BEGIN git-bundle-server (managed automatically; do not edit)\n" +
+			"0 0 * * * \"/usr/bin/git-bundle-server\" \"update-all\"\n" +
+			"# END git-bundle-server\n",
+		0,
+		"0 0 * * *",
+		[]string{"update-all"},
+		testCronRegion,
+	},
+	{
+		"Arguments are shell-quoted and '%' is escaped",
+		"",
+		0,
+		"0 0 * * *",
+		[]string{"--root", "/data/$HOME/it's 100%", "update-all"},
+		"# BEGIN git-bundle-server (managed automatically; do not edit)\n" +
+			`0 0 * * * '/usr/bin/git-bundle-server' '--root' '/data/$HOME/it'\''s 100\%' 'update-all'` + "\n" +
+			"# END git-bundle-server\n",
+	},
+}
+
+func TestCron_SetJob(t *testing.T) {
+	testLogger := &MockTraceLogger{}
+	testUser := &user.User{
+		Uid:      "123",
+		Username: "testuser",
+		HomeDir:  "/my/test/dir",
+	}
+	testUserProvider := &MockUserProvider{}
+	testUserProvider.On("CurrentUser").Return(testUser, nil)
+
+	for _, tt := range setJobTests {
+		t.Run(tt.title, func(t *testing.T) {
+			testCommandExecutor := &MockCommandExecutor{}
+			testFileSystem := &MockFileSystem{}
+			cron := core.NewCronScheduler(testLogger, testUserProvider, testCommandExecutor, testFileSystem)
+
+			mockCrontabList(testCommandExecutor, tt.existingCrontab, tt.crontabExitCode)
+			if tt.expectedCrontab != "" {
+				testFileSystem.On("WriteFile", testCrontabFile, []byte(tt.expectedCrontab)).Return(nil).Once()
+				testCommandExecutor.On("RunQuiet", mock.Anything, "crontab", []string{testCrontabFile}).Return(0, nil).Once()
+				testFileSystem.On("DeleteFile", testCrontabFile).Return(true, nil).Once()
+			}
+
+			schedule, err := core.ParseCronSchedule(tt.schedule)
+			assert.Nil(t, err)
+
+			err = cron.SetJob(context.Background(), schedule, "/usr/bin/git-bundle-server", tt.args)
+			assert.Nil(t, err)
+			mock.AssertExpectationsForObjects(t, testCommandExecutor, testFileSystem)
+		})
+	}
+}
+
+func TestCron_RemoveJob(t *testing.T) {
+	testLogger := &MockTraceLogger{}
+	testUser := &user.User{
+		Uid:      "123",
+		Username: "testuser",
+		HomeDir:  "/my/test/dir",
+	}
+	testUserProvider := &MockUserProvider{}
+	testUserProvider.On("CurrentUser").Return(testUser, nil)
+
+	t.Run("Region is removed, other jobs are preserved", func(t *testing.T) {
+		testCommandExecutor := &MockCommandExecutor{}
+		testFileSystem := &MockFileSystem{}
+		cron := core.NewCronScheduler(testLogger, testUserProvider, testCommandExecutor, testFileSystem)
+
+		mockCrontabList(testCommandExecutor, "# my job\n"+testCronRegion+"@reboot /usr/bin/true\n", 0)
+		testFileSystem.On("WriteFile", testCrontabFile, []byte("# my job\n@reboot /usr/bin/true\n")).Return(nil).Once()
+		testCommandExecutor.On("RunQuiet", mock.Anything, "crontab", []string{testCrontabFile}).Return(0, nil).Once()
+		testFileSystem.On("DeleteFile", testCrontabFile).Return(true, nil).Once()
+
+		err := cron.RemoveJob(context.Background())
+		assert.Nil(t, err)
+		mock.AssertExpectationsForObjects(t, testCommandExecutor, testFileSystem)
+	})
+
+	t.Run("No region, crontab is not rewritten", func(t *testing.T) {
+		testCommandExecutor := &MockCommandExecutor{}
+		testFileSystem := &MockFileSystem{}
+		cron := core.NewCronScheduler(testLogger, testUserProvider, testCommandExecutor, testFileSystem)
+
+		mockCrontabList(testCommandExecutor, "# my job\n", 0)
+
+		err := cron.RemoveJob(context.Background())
+		assert.Nil(t, err)
+		mock.AssertExpectationsForObjects(t, testCommandExecutor, testFileSystem)
+	})
+}
+
+func TestCron_GetJob(t *testing.T) {
+	testLogger := &MockTraceLogger{}
+	testUserProvider := &MockUserProvider{}
+
+	t.Run("Schedule is read from region", func(t *testing.T) {
+		testCommandExecutor := &MockCommandExecutor{}
+		cron := core.NewCronScheduler(testLogger, testUserProvider, testCommandExecutor, &MockFileSystem{})
+
+		mockCrontabList(testCommandExecutor, "*/5 * * * * /usr/bin/true\n"+testCronRegion, 0)
+
+		schedule, exists, err := cron.GetJob(context.Background())
+		assert.Nil(t, err)
+		assert.True(t, exists)
+		assert.Equal(t, core.CronDaily, schedule)
+	})
+
+	t.Run("No region, no job", func(t *testing.T) {
+		testCommandExecutor := &MockCommandExecutor{}
+		cron := core.NewCronScheduler(testLogger, testUserProvider, testCommandExecutor, &MockFileSystem{})
+
+		mockCrontabList(testCommandExecutor, "*/5 * * * * /usr/bin/true\n", 0)
+
+		_, exists, err := cron.GetJob(context.Background())
+		assert.Nil(t, err)
+		assert.False(t, exists)
+	})
+}
+
+var parseCronScheduleTests = []struct {
+	expr string
+
+	expectedSchedule string
+	expectedErr      bool
+}{
+	{"0 0 * * *", "0 0 * * *", false},
+	{" */15  *  * * 1-5 ", "*/15 * * * 1-5", false},
+	{"0 0 * *", "", true},
+	{"0 0 * * * *", "", true},
+	{"0 0 * * *; rm -rf /", "", true},
+}
+
+func TestCron_ParseCronSchedule(t *testing.T) {
+	for _, tt := range parseCronScheduleTests {
+		t.Run(tt.expr, func(t *testing.T) {
+			schedule, err := core.ParseCronSchedule(tt.expr)
+			if tt.expectedErr {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+				assert.Equal(t, tt.expectedSchedule, string(schedule))
+			}
+		})
+	}
+}
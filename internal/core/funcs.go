@@ -29,6 +29,39 @@ func GetRouteFromUrl(url string) (string, bool) {
 	return "", false
 }
 
+// NormalizeRemoteUrl reduces a Git remote URL to a canonical
+// '<domain>/<path>' form so that different URLs of the same repository (e.g.
+// its HTTPS and SSH URLs) can be compared. The scheme, user info, port, '.git'
+// suffix, and trailing slashes are removed and the domain is lowercased.
+func NormalizeRemoteUrl(url string) string {
+	url = strings.TrimSpace(url)
+
+	var host, path string
+	if i := strings.Index(url, "://"); i >= 0 {
+		// URL with a scheme, e.g. https://user@host:port/path
+		rest := url[i+3:]
+		host, path, _ = strings.Cut(rest, "/")
+		if j := strings.LastIndex(host, "@"); j >= 0 {
+			host = host[j+1:]
+		}
+		if j := strings.LastIndex(host, ":"); j >= 0 {
+			host = host[:j]
+		}
+	} else if h, p, found := strings.Cut(url, ":"); found {
+		// SCP-like syntax, e.g. user@host:path
+		host, path = h, p
+		if j := strings.LastIndex(host, "@"); j >= 0 {
+			host = host[j+1:]
+		}
+	} else {
+		return url
+	}
+
+	path = strings.Trim(path, "/")
+	path = strings.TrimSuffix(path, ".git")
+	return strings.ToLower(host) + "/" + path
+}
+
 func ParseRoute(route string, repoOnly bool) (string, string, string, error) {
 	elements := strings.FieldsFunc(route, func(char rune) bool { return char == '/' })
 	validElementPattern := regexp.MustCompile(`^[\w\.-]+$`)
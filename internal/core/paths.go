@@ -1,22 +1,57 @@
 package core
 
 import (
+	"os"
 	"os/user"
 	"path/filepath"
 )
 
+// Environment variables overriding the locations of the server's data. If
+// unset, the repository and web roots are subdirectories of the data root,
+// which in turn defaults to '~/git-bundle-server'.
+const (
+	DataRootEnvVar string = "GIT_BUNDLE_SERVER_ROOT"
+	RepoRootEnvVar string = "GIT_BUNDLE_SERVER_REPO_ROOT"
+	WebRootEnvVar  string = "GIT_BUNDLE_SERVER_WEB_ROOT"
+)
+
 func bundleroot(user *user.User) string {
+	if root := os.Getenv(DataRootEnvVar); root != "" {
+		return root
+	}
 	return filepath.Join(user.HomeDir, "git-bundle-server")
 }
 
 func webroot(user *user.User) string {
+	if root := os.Getenv(WebRootEnvVar); root != "" {
+		return root
+	}
 	return filepath.Join(bundleroot(user), "www")
 }
 
 func reporoot(user *user.User) string {
+	if root := os.Getenv(RepoRootEnvVar); root != "" {
+		return root
+	}
 	return filepath.Join(bundleroot(user), "git")
 }
 
+// ServerConfigFile contains the settings shared by all commands (see
+// 'ServerConfig'). It is outside of the data root, since it may configure it.
+func ServerConfigFile(user *user.User) string {
+	return filepath.Join(user.HomeDir, ".config", "git-bundle-server", ServerConfigFilename)
+}
+
 func CrontabFile(user *user.User) string {
 	return filepath.Join(bundleroot(user), "cron-schedule")
 }
+
+// TimerScheduleFile contains the cron expression of the 'update-all' timer, if
+// updates are scheduled with a systemd or launchd timer rather than cron.
+func TimerScheduleFile(user *user.User) string {
+	return filepath.Join(bundleroot(user), "timer-schedule")
+}
+
+func SchedulerDir(user *user.User) string {
+	return filepath.Join(bundleroot(user), "scheduler")
+}
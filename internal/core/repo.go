@@ -24,6 +24,9 @@ type RepositoryProvider interface {
 	WriteAllRoutes(ctx context.Context, repos map[string]Repository) error
 	ReadRepositoryStorage(ctx context.Context) (map[string]Repository, error)
 	RemoveRoute(ctx context.Context, route string) error
+
+	ReadRouteConfig(ctx context.Context, repo *Repository) (*RouteConfig, error)
+	WriteRouteConfig(ctx context.Context, repo *Repository, config *RouteConfig) error
 }
 
 type repoProvider struct {
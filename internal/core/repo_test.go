@@ -127,6 +127,51 @@ func TestRepos_GetRepositories(t *testing.T) {
 	}
 }
 
+func TestRepos_GetRepositories_DataRoots(t *testing.T) {
+	testLogger := &MockTraceLogger{}
+	testUser := &user.User{
+		Uid:      "123",
+		Username: "testuser",
+		HomeDir:  "/my/test/dir",
+	}
+	testUserProvider := &MockUserProvider{}
+	testUserProvider.On("CurrentUser").Return(testUser, nil)
+
+	t.Run("data root moves all data", func(t *testing.T) {
+		t.Setenv(core.DataRootEnvVar, "/data/bundles")
+
+		testFileSystem := &MockFileSystem{}
+		testFileSystem.On("ReadFileLines",
+			filepath.Clean("/data/bundles/routes"),
+		).Return([]string{"git/git"}, nil).Once()
+		repoProvider := core.NewRepositoryProvider(testLogger, testUserProvider, testFileSystem, nil)
+
+		actual, err := repoProvider.GetRepositories(context.Background())
+		assert.Nil(t, err)
+		mock.AssertExpectationsForObjects(t, testFileSystem)
+		assert.Equal(t, filepath.Clean("/data/bundles/git/git/git"), actual["git/git"].RepoDir)
+		assert.Equal(t, filepath.Clean("/data/bundles/www/git/git"), actual["git/git"].WebDir)
+	})
+
+	t.Run("repo and web roots override data root", func(t *testing.T) {
+		t.Setenv(core.DataRootEnvVar, "/data/bundles")
+		t.Setenv(core.RepoRootEnvVar, "/mirrors")
+		t.Setenv(core.WebRootEnvVar, "/srv/www")
+
+		testFileSystem := &MockFileSystem{}
+		testFileSystem.On("ReadFileLines",
+			filepath.Clean("/data/bundles/routes"),
+		).Return([]string{"git/git"}, nil).Once()
+		repoProvider := core.NewRepositoryProvider(testLogger, testUserProvider, testFileSystem, nil)
+
+		actual, err := repoProvider.GetRepositories(context.Background())
+		assert.Nil(t, err)
+		mock.AssertExpectationsForObjects(t, testFileSystem)
+		assert.Equal(t, filepath.Clean("/mirrors/git/git"), actual["git/git"].RepoDir)
+		assert.Equal(t, filepath.Clean("/srv/www/git/git"), actual["git/git"].WebDir)
+	})
+}
+
 var readRepositoryStorageTests = []struct {
 	title string
 
@@ -0,0 +1,196 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/git"
+)
+
+const RouteConfigFilename string = "route-config.json"
+
+// The interval between scheduled updates of routes that don't configure their
+// own.
+const DefaultUpdateInterval time.Duration = 24 * time.Hour
+
+// RouteConfig contains the settings controlling how bundles are generated for
+// a single route. It is stored alongside the route's repository data.
+type RouteConfig struct {
+	// The object filters (e.g. 'blob:none') for which a set of filtered
+	// bundles is generated in addition to the full bundles.
+	Filters []string `json:",omitempty"`
+
+	// If true, the route's repository is never fetched from its remote.
+	// Instead, content is expected to be pushed into the repository (e.g. by
+	// replication) and bundles are created from whatever it contains at the
+	// time of the update.
+	NoFetch bool `json:",omitempty"`
+
+	// The minimum time between scheduled updates of the route (e.g. '6h'), in
+	// the format accepted by 'time.ParseDuration()'. If empty,
+	// 'DefaultUpdateInterval' is used.
+	UpdateInterval string `json:",omitempty"`
+
+	// The maximum random delay (e.g. '10m') added to the update interval, used
+	// to keep routes with the same interval from all updating at once.
+	UpdateJitter string `json:",omitempty"`
+
+	// Routes that are due at the same time are updated in order of decreasing
+	// priority.
+	Priority int `json:",omitempty"`
+
+	// The credentials with which the route's repository is cloned and fetched
+	// from its remote. Only references to the secrets (e.g. the path of a
+	// token file) are stored. If nil, the credentials available to the user
+	// running the update are used.
+	Credentials *git.RemoteCredentials `json:",omitempty"`
+}
+
+// UpdateSchedule contains the parsed scheduling settings of a route.
+type UpdateSchedule struct {
+	Interval time.Duration
+	Jitter   time.Duration
+	Priority int
+}
+
+func (s *UpdateSchedule) String() string {
+	str := "every " + FormatDuration(s.Interval)
+	if s.Jitter > 0 {
+		str += " (+" + FormatDuration(s.Jitter) + " jitter)"
+	}
+	if s.Priority != 0 {
+		str += fmt.Sprintf(", priority %d", s.Priority)
+	}
+	return str
+}
+
+// GetUpdateSchedule returns the parsed update schedule of the route.
+func (c *RouteConfig) GetUpdateSchedule() (*UpdateSchedule, error) {
+	schedule := &UpdateSchedule{
+		Interval: DefaultUpdateInterval,
+		Priority: c.Priority,
+	}
+
+	var err error
+	if c.UpdateInterval != "" {
+		schedule.Interval, err = ParseUpdateInterval(c.UpdateInterval)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if c.UpdateJitter != "" {
+		schedule.Jitter, err = ParseUpdateJitter(c.UpdateJitter)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return schedule, nil
+}
+
+func ParseUpdateInterval(interval string) (time.Duration, error) {
+	d, err := time.ParseDuration(interval)
+	if err != nil {
+		return 0, fmt.Errorf("invalid update interval '%s': %w", interval, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("invalid update interval '%s': must be positive", interval)
+	}
+	return d, nil
+}
+
+func ParseUpdateJitter(jitter string) (time.Duration, error) {
+	d, err := time.ParseDuration(jitter)
+	if err != nil {
+		return 0, fmt.Errorf("invalid update jitter '%s': %w", jitter, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("invalid update jitter '%s': must not be negative", jitter)
+	}
+	return d, nil
+}
+
+// FormatDuration formats a duration like 'time.Duration.String()', but without
+// trailing zero units (e.g. '24h' rather than '24h0m0s').
+func FormatDuration(d time.Duration) string {
+	str := d.String()
+	if strings.HasSuffix(str, "m0s") {
+		str = strings.TrimSuffix(str, "0s")
+	}
+	if strings.HasSuffix(str, "h0m") {
+		str = strings.TrimSuffix(str, "0m")
+	}
+	return str
+}
+
+// AddFilter adds an object filter to the config, returning false if the filter
+// was already configured.
+func (c *RouteConfig) AddFilter(filter string) bool {
+	for _, existing := range c.Filters {
+		if existing == filter {
+			return false
+		}
+	}
+	c.Filters = append(c.Filters, filter)
+	return true
+}
+
+// RemoveFilter removes an object filter from the config, returning false if
+// the filter was not configured.
+func (c *RouteConfig) RemoveFilter(filter string) bool {
+	for i, existing := range c.Filters {
+		if existing == filter {
+			c.Filters = append(c.Filters[:i], c.Filters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (r *repoProvider) ReadRouteConfig(ctx context.Context, repo *Repository) (*RouteConfig, error) {
+	//lint:ignore SA4006 always override the ctx with the result from 'Region()'
+	ctx, exitRegion := r.logger.Region(ctx, "repo", "read_route_config")
+	defer exitRegion()
+
+	config := &RouteConfig{}
+
+	data, err := os.ReadFile(filepath.Join(repo.RepoDir, RouteConfigFilename))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			// No config has been written for the route - use the defaults
+			return config, nil
+		}
+		return nil, fmt.Errorf("failed to read route config: %w", err)
+	}
+
+	err = json.Unmarshal(data, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse route config: %w", err)
+	}
+
+	return config, nil
+}
+
+func (r *repoProvider) WriteRouteConfig(ctx context.Context, repo *Repository, config *RouteConfig) error {
+	//lint:ignore SA4006 always override the ctx with the result from 'Region()'
+	ctx, exitRegion := r.logger.Region(ctx, "repo", "write_route_config")
+	defer exitRegion()
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to convert route config to JSON: %w", err)
+	}
+
+	err = r.fileSystem.WriteFile(filepath.Join(repo.RepoDir, RouteConfigFilename), data)
+	if err != nil {
+		return fmt.Errorf("failed to write route config: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,195 @@
+package daemon
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/utils"
+)
+
+// CalendarSchedule describes the times at which a timer fires. Each field lists
+// the values it matches; an empty list matches any value.
+type CalendarSchedule struct {
+	Minute  []int
+	Hour    []int
+	Day     []int
+	Month   []int
+	Weekday []int // 0 (Sunday) to 6 (Saturday)
+}
+
+type calendarField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []calendarField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// parseCronField expands a single cron field (e.g. '*/15' or '1-5,7') into the
+// values it matches. A field matching every value returns an empty list.
+func parseCronField(expr string, field calendarField) ([]int, error) {
+	if expr == "*" {
+		return []int{}, nil
+	}
+
+	matches := map[int]bool{}
+	for _, part := range strings.Split(expr, ",") {
+		rangeExpr, stepExpr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepExpr)
+			if err != nil || step < 1 {
+				return nil, fmt.Errorf("invalid step '%s' in %s field", stepExpr, field.name)
+			}
+		}
+
+		low, high := field.min, field.max
+		if rangeExpr != "*" {
+			lowExpr, highExpr, isRange := strings.Cut(rangeExpr, "-")
+			var err error
+			low, err = strconv.Atoi(lowExpr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value '%s' in %s field", lowExpr, field.name)
+			}
+			high = low
+			if isRange {
+				high, err = strconv.Atoi(highExpr)
+				if err != nil {
+					return nil, fmt.Errorf("invalid value '%s' in %s field", highExpr, field.name)
+				}
+			} else if hasStep {
+				// 'a/n' means 'a-<max>/n'
+				high = field.max
+			}
+		}
+
+		if low < field.min || high > field.max || low > high {
+			return nil, fmt.Errorf("value out of range in %s field '%s'", field.name, expr)
+		}
+
+		for i := low; i <= high; i += step {
+			matches[i] = true
+		}
+	}
+
+	values := []int{}
+	for value := range matches {
+		values = append(values, value)
+	}
+	sort.Ints(values)
+	return values, nil
+}
+
+// ParseCalendarSchedule converts a numeric five-field cron expression (e.g.
+// '*/15 * * * 1-5') into a CalendarSchedule.
+func ParseCalendarSchedule(cronExpr string) (*CalendarSchedule, error) {
+	fields := strings.Fields(cronExpr)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("invalid cron expression '%s': expected %d fields, got %d",
+			cronExpr, len(cronFields), len(fields))
+	}
+
+	values := make([][]int, len(fields))
+	for i, field := range fields {
+		var err error
+		values[i], err = parseCronField(field, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression '%s': %w", cronExpr, err)
+		}
+	}
+
+	schedule := &CalendarSchedule{
+		Minute: values[0],
+		Hour:   values[1],
+		Day:    values[2],
+		Month:  values[3],
+	}
+
+	// Both 0 and 7 are Sunday in cron
+	weekdays := map[int]bool{}
+	for _, day := range values[4] {
+		weekdays[day%7] = true
+	}
+	for day := 0; day < 7; day++ {
+		if weekdays[day] {
+			schedule.Weekday = append(schedule.Weekday, day)
+		}
+	}
+	if len(weekdays) == 7 {
+		schedule.Weekday = nil
+	}
+
+	// cron runs a job when *either* the day of month or the day of week
+	// matches if both are restricted, but timers require both to match.
+	if len(schedule.Day) > 0 && len(schedule.Weekday) > 0 {
+		return nil, fmt.Errorf("invalid cron expression '%s': "+
+			"restricting both the day of month and the day of week is not supported by timers", cronExpr)
+	}
+
+	return schedule, nil
+}
+
+var systemdWeekdays = []string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}
+
+// onCalendar formats the schedule as a systemd calendar event expression (see
+// systemd.time(7)), e.g. 'Mon,Fri *-*-* 00,12:30:00'.
+func (s *CalendarSchedule) onCalendar() string {
+	list := func(values []int, format string) string {
+		if len(values) == 0 {
+			return "*"
+		}
+		return strings.Join(utils.Map(values, func(v int) string { return fmt.Sprintf(format, v) }), ",")
+	}
+
+	event := fmt.Sprintf("*-%s-%s %s:%s:00",
+		list(s.Month, "%02d"), list(s.Day, "%02d"), list(s.Hour, "%02d"), list(s.Minute, "%02d"))
+	if len(s.Weekday) > 0 {
+		weekdays := utils.Map(s.Weekday, func(day int) string { return systemdWeekdays[day] })
+		event = strings.Join(weekdays, ",") + " " + event
+	}
+
+	return event
+}
+
+// calendarIntervals expands the schedule into the list of dictionaries used
+// by the 'StartCalendarInterval' key of a launchd plist. Each dictionary
+// matches one combination of the schedule's restricted fields.
+func (s *CalendarSchedule) calendarIntervals() []map[string]int {
+	intervals := []map[string]int{{}}
+	for _, field := range []struct {
+		key    string
+		values []int
+	}{
+		{"Minute", s.Minute},
+		{"Hour", s.Hour},
+		{"Day", s.Day},
+		{"Weekday", s.Weekday},
+		{"Month", s.Month},
+	} {
+		if len(field.values) == 0 {
+			continue
+		}
+
+		expanded := []map[string]int{}
+		for _, interval := range intervals {
+			for _, value := range field.values {
+				next := map[string]int{field.key: value}
+				for k, v := range interval {
+					next[k] = v
+				}
+				expanded = append(expanded, next)
+			}
+		}
+		intervals = expanded
+	}
+
+	return intervals
+}
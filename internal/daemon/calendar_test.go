@@ -0,0 +1,73 @@
+package daemon_test
+
+import (
+	"testing"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/daemon"
+	"github.com/stretchr/testify/assert"
+)
+
+var parseCalendarScheduleTests = []struct {
+	expr string
+
+	// Expected values
+	expectedSchedule *daemon.CalendarSchedule
+	expectErr        bool
+}{
+	{
+		"0 0 * * *",
+		&daemon.CalendarSchedule{Minute: []int{0}, Hour: []int{0}, Day: []int{}, Month: []int{}},
+		false,
+	},
+	{
+		"*/15 9-17 * * 1-5",
+		&daemon.CalendarSchedule{
+			Minute:  []int{0, 15, 30, 45},
+			Hour:    []int{9, 10, 11, 12, 13, 14, 15, 16, 17},
+			Day:     []int{},
+			Month:   []int{},
+			Weekday: []int{1, 2, 3, 4, 5},
+		},
+		false,
+	},
+	{
+		"30 6,18 1 */6 *",
+		&daemon.CalendarSchedule{
+			Minute: []int{30},
+			Hour:   []int{6, 18},
+			Day:    []int{1},
+			Month:  []int{1, 7},
+		},
+		false,
+	},
+	{
+		"0 0 * * 7",
+		&daemon.CalendarSchedule{Minute: []int{0}, Hour: []int{0}, Day: []int{}, Month: []int{}, Weekday: []int{0}},
+		false,
+	},
+	{
+		"5/20 * * * 0-7",
+		&daemon.CalendarSchedule{Minute: []int{5, 25, 45}, Hour: []int{}, Day: []int{}, Month: []int{}},
+		false,
+	},
+	{"0 0 * *", nil, true},
+	{"60 * * * *", nil, true},
+	{"* * 0 * *", nil, true},
+	{"*/0 * * * *", nil, true},
+	{"0 0 * * mon", nil, true},
+	{"0 0 1 * 1", nil, true},
+}
+
+func TestCalendar_ParseCalendarSchedule(t *testing.T) {
+	for _, tt := range parseCalendarScheduleTests {
+		t.Run(tt.expr, func(t *testing.T) {
+			schedule, err := daemon.ParseCalendarSchedule(tt.expr)
+			if tt.expectErr {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+				assert.Equal(t, tt.expectedSchedule, schedule)
+			}
+		})
+	}
+}
@@ -3,7 +3,10 @@ package daemon
 import (
 	"context"
 	"fmt"
+	"os"
 	"runtime"
+	"strconv"
+	"time"
 
 	"github.com/git-ecosystem/git-bundle-server/internal/cmd"
 	"github.com/git-ecosystem/git-bundle-server/internal/common"
@@ -15,6 +18,67 @@ type DaemonConfig struct {
 	Description string
 	Program     string
 	Arguments   []string
+
+	// Environment variables set for the program, as 'KEY=value' pairs.
+	Environment []string
+
+	// The directory in which the program is run. If empty, the daemon
+	// manager's default is used.
+	WorkingDirectory string
+
+	// If non-nil, the program is restarted whenever it exits with a failure.
+	Restart *RestartPolicy
+
+	// The files to which the program's output is appended. If empty, the
+	// output is discarded (launchd) or sent to the journal (systemd).
+	StdOutPath string
+	StdErrPath string
+
+	// The maximum amount of memory (in bytes) the program may use, or 0 for
+	// no limit.
+	MemoryLimit uint64
+
+	// The maximum CPU time the program may use, as a percentage of one CPU
+	// (e.g. 50), or 0 for no limit.
+	CPUQuota int
+
+	// The user and group as which the program is run. Only system daemons
+	// (see 'NewSystemDaemonProvider()') can run as another user; if empty,
+	// the program runs as root.
+	User  string
+	Group string
+}
+
+// RestartPolicy describes how a failed program is restarted.
+type RestartPolicy struct {
+	// The time to wait before the first restart.
+	Delay time.Duration
+
+	// If greater than 'Delay', the wait is increased with each consecutive
+	// restart until it reaches 'MaxDelay'. Not all daemon managers support
+	// this, in which case 'Delay' is always used.
+	MaxDelay time.Duration
+}
+
+// DaemonStatus describes the state of a daemon as reported by the daemon
+// manager.
+type DaemonStatus struct {
+	// Whether the daemon configuration is loaded into the daemon manager.
+	Loaded bool
+
+	Running bool
+	PID     int
+
+	// The exit code of the last run of the program, or nil if it hasn't exited
+	// (or the daemon manager doesn't know).
+	LastExitCode *int
+
+	// The daemon's configuration file, or empty if it doesn't exist.
+	ConfigFile string
+
+	// The program, arguments, and output files of the daemon, as read from the
+	// configuration file (if it exists). Other fields are not filled in.
+	Config *DaemonConfig
 }
 
 type DaemonProvider interface {
@@ -25,6 +89,25 @@ type DaemonProvider interface {
 	Stop(ctx context.Context, label string) error
 
 	Remove(ctx context.Context, label string) error
+
+	Status(ctx context.Context, label string) (*DaemonStatus, error)
+
+	// Logs prints the last 'lines' lines of the daemon's output and, if
+	// 'follow' is true, keeps printing new output until interrupted.
+	Logs(ctx context.Context, label string, lines int, follow bool) error
+
+	// TimersAvailable returns whether the daemon manager can run programs on a
+	// calendar schedule with 'CreateTimer()'.
+	TimersAvailable(ctx context.Context) bool
+
+	// CreateTimer configures the daemon manager to run the program described
+	// by 'config' to completion whenever 'schedule' matches. If the timer
+	// already exists, it is only reconfigured if 'force' is true.
+	CreateTimer(ctx context.Context, config *DaemonConfig, schedule *CalendarSchedule, force bool) error
+
+	// RemoveTimer stops and removes the configuration of a timer created with
+	// 'CreateTimer()'.
+	RemoveTimer(ctx context.Context, label string) error
 }
 
 func NewDaemonProvider(
@@ -44,3 +127,63 @@ func NewDaemonProvider(
 		return nil, fmt.Errorf("cannot configure daemon handler for OS '%s'", thisOs)
 	}
 }
+
+// NewSystemDaemonProvider creates a DaemonProvider for daemons managed by the
+// system (rather than the current user's) daemon manager. These start at boot
+// without requiring a login session, and can only be modified by root.
+func NewSystemDaemonProvider(
+	l log.TraceLogger,
+	u common.UserProvider,
+	c cmd.CommandExecutor,
+	fs common.FileSystem,
+) (DaemonProvider, error) {
+	switch thisOs := runtime.GOOS; thisOs {
+	case "linux":
+		return NewSystemdSystemProvider(l, u, c, fs), nil
+	case "darwin":
+		return NewLaunchdSystemProvider(l, u, c, fs), nil
+	default:
+		return nil, fmt.Errorf("cannot configure daemon handler for OS '%s'", thisOs)
+	}
+}
+
+// checkPrivileges returns an error if 'system' daemons are being modified by a
+// user other than root.
+func checkPrivileges(ctx context.Context, logger log.TraceLogger, u common.UserProvider, system bool) error {
+	if !system {
+		return nil
+	}
+
+	user, err := u.CurrentUser()
+	if err != nil {
+		return logger.Errorf(ctx, "could not get current user: %w", err)
+	}
+	if user.Uid != "0" {
+		return logger.Errorf(ctx, "managing system daemons requires root privileges (try running with 'sudo')")
+	}
+
+	return nil
+}
+
+// logFiles returns the distinct files to which the daemon described by
+// 'config' writes its output.
+func logFiles(config *DaemonConfig) []string {
+	files := []string{}
+	if config == nil {
+		return files
+	}
+	for _, file := range []string{config.StdOutPath, config.StdErrPath} {
+		if file != "" && file != os.DevNull && (len(files) == 0 || files[0] != file) {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+func tailArgs(lines int, follow bool) []string {
+	args := []string{"-n", strconv.Itoa(lines)}
+	if follow {
+		args = append(args, "-F")
+	}
+	return args
+}
@@ -5,7 +5,11 @@ import (
 	"context"
 	"encoding/xml"
 	"fmt"
+	"io"
+	"math"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/git-ecosystem/git-bundle-server/internal/cmd"
 	"github.com/git-ecosystem/git-bundle-server/internal/common"
@@ -35,13 +39,21 @@ func xmlName(name string) xml.Name {
 	return xml.Name{Local: name}
 }
 
-func (p *plist) addKeyValue(key string, value any) {
-	p.Config.Elements = append(p.Config.Elements, xmlItem{XMLName: xmlName("key"), Value: key})
+func newDict() *xmlArray {
+	return &xmlArray{XMLName: xmlName("dict")}
+}
+
+func (d *xmlArray) addKeyValue(key string, value any) {
+	d.Elements = append(d.Elements, xmlItem{XMLName: xmlName("key"), Value: key})
 	switch value := value.(type) {
 	case string:
-		p.Config.Elements = append(p.Config.Elements, xmlItem{XMLName: xmlName("string"), Value: value})
+		d.Elements = append(d.Elements, xmlItem{XMLName: xmlName("string"), Value: value})
+	case int, uint64:
+		d.Elements = append(d.Elements, xmlItem{XMLName: xmlName("integer"), Value: fmt.Sprint(value)})
+	case bool:
+		d.Elements = append(d.Elements, xmlItem{XMLName: xmlName(fmt.Sprint(value))})
 	case []string:
-		p.Config.Elements = append(p.Config.Elements,
+		d.Elements = append(d.Elements,
 			xmlArray{
 				XMLName: xmlName("array"),
 				Elements: utils.Map(value, func(e string) interface{} {
@@ -49,13 +61,46 @@ func (p *plist) addKeyValue(key string, value any) {
 				}),
 			},
 		)
+	case *xmlArray:
+		d.Elements = append(d.Elements, *value)
+	case []map[string]int:
+		d.Elements = append(d.Elements,
+			xmlArray{
+				XMLName: xmlName("array"),
+				Elements: utils.Map(value, func(e map[string]int) interface{} {
+					return intDict(e)
+				}),
+			},
+		)
 	default:
 		panic("Invalid value type in 'addKeyValue'")
 	}
 }
 
+func (p *plist) addKeyValue(key string, value any) {
+	p.Config.addKeyValue(key, value)
+}
+
+// The keys of a 'StartCalendarInterval' dictionary, in the order they are
+// written to the plist.
+var calendarIntervalKeys = []string{"Minute", "Hour", "Day", "Weekday", "Month"}
+
+func intDict(values map[string]int) xmlArray {
+	dict := newDict()
+	for _, key := range calendarIntervalKeys {
+		if value, ok := values[key]; ok {
+			dict.addKeyValue(key, value)
+		}
+	}
+	return *dict
+}
+
 const domainFormat string = "user/%s"
 
+// The domain and plist directory of daemons managed by the system.
+const systemDomain string = "system"
+const systemDaemonDir string = "/Library/LaunchDaemons"
+
 const LaunchdNoSuchProcessErrorCode int = 3
 const LaunchdServiceNotFoundErrorCode int = 113
 
@@ -64,6 +109,13 @@ type launchdConfig struct {
 	LimitLoadToSessionType string
 	StdOut                 string
 	StdErr                 string
+
+	// If set, the program is run whenever the schedule matches rather than
+	// kept running.
+	Schedule *CalendarSchedule
+
+	// Whether the program is started as soon as it is loaded (e.g. at boot).
+	RunAtLoad bool
 }
 
 func (c *launchdConfig) toPlist() *plist {
@@ -73,7 +125,9 @@ func (c *launchdConfig) toPlist() *plist {
 	}
 	p.addKeyValue("Label", c.Label)
 	p.addKeyValue("Program", c.Program)
-	p.addKeyValue("LimitLoadToSessionType", c.LimitLoadToSessionType)
+	if c.LimitLoadToSessionType != "" {
+		p.addKeyValue("LimitLoadToSessionType", c.LimitLoadToSessionType)
+	}
 	p.addKeyValue("StandardOutPath", c.StdOut)
 	p.addKeyValue("StandardErrorPath", c.StdErr)
 
@@ -89,6 +143,54 @@ func (c *launchdConfig) toPlist() *plist {
 	copy(args[1:], c.Arguments[:])
 	p.addKeyValue("ProgramArguments", args)
 
+	if c.User != "" {
+		p.addKeyValue("UserName", c.User)
+	}
+	if c.Group != "" {
+		p.addKeyValue("GroupName", c.Group)
+	}
+	if c.RunAtLoad {
+		p.addKeyValue("RunAtLoad", true)
+	}
+
+	if c.WorkingDirectory != "" {
+		p.addKeyValue("WorkingDirectory", c.WorkingDirectory)
+	}
+
+	if len(c.Environment) > 0 {
+		env := newDict()
+		for _, keyValue := range c.Environment {
+			key, value, _ := strings.Cut(keyValue, "=")
+			env.addKeyValue(key, value)
+		}
+		p.addKeyValue("EnvironmentVariables", env)
+	}
+
+	if c.Restart != nil {
+		// launchd can't increase the delay between restarts, so 'MaxDelay'
+		// is ignored. 'ThrottleInterval' is the minimum time between starts.
+		keepAlive := newDict()
+		keepAlive.addKeyValue("SuccessfulExit", false)
+		p.addKeyValue("KeepAlive", keepAlive)
+		p.addKeyValue("ThrottleInterval", int(math.Max(1, math.Ceil(c.Restart.Delay.Seconds()))))
+	}
+
+	if c.MemoryLimit > 0 {
+		limits := newDict()
+		limits.addKeyValue("ResidentSetSize", c.MemoryLimit)
+		p.addKeyValue("HardResourceLimits", limits)
+	}
+
+	if c.CPUQuota > 0 && c.CPUQuota < 100 {
+		// launchd has no CPU quota; the closest equivalent is to let the
+		// system throttle the program's CPU (and I/O) usage
+		p.addKeyValue("ProcessType", "Background")
+	}
+
+	if c.Schedule != nil {
+		p.addKeyValue("StartCalendarInterval", c.Schedule.calendarIntervals())
+	}
+
 	return p
 }
 
@@ -97,6 +199,9 @@ type launchd struct {
 	user       common.UserProvider
 	cmdExec    cmd.CommandExecutor
 	fileSystem common.FileSystem
+
+	// Whether the daemons are in the system (rather than the user's) domain.
+	system bool
 }
 
 func NewLaunchdProvider(
@@ -113,6 +218,43 @@ func NewLaunchdProvider(
 	}
 }
 
+// NewLaunchdSystemProvider creates a DaemonProvider managing daemons in the
+// system domain, which start at boot and run as the user given in their
+// config. Modifying them requires root privileges.
+func NewLaunchdSystemProvider(
+	l log.TraceLogger,
+	u common.UserProvider,
+	c cmd.CommandExecutor,
+	fs common.FileSystem,
+) DaemonProvider {
+	return &launchd{
+		logger:     l,
+		user:       u,
+		cmdExec:    c,
+		fileSystem: fs,
+		system:     true,
+	}
+}
+
+// targets returns the plist filename, domain target, and service target of the
+// daemon with the given label.
+func (l *launchd) targets(ctx context.Context, label string) (string, string, string, error) {
+	var filename, domainTarget string
+	if l.system {
+		filename = filepath.Join(systemDaemonDir, fmt.Sprintf("%s.plist", label))
+		domainTarget = systemDomain
+	} else {
+		user, err := l.user.CurrentUser()
+		if err != nil {
+			return "", "", "", l.logger.Errorf(ctx, "could not get current user for launchd service: %w", err)
+		}
+		filename = filepath.Join(user.HomeDir, "Library", "LaunchAgents", fmt.Sprintf("%s.plist", label))
+		domainTarget = fmt.Sprintf(domainFormat, user.Uid)
+	}
+
+	return filename, domainTarget, fmt.Sprintf("%s/%s", domainTarget, label), nil
+}
+
 func (l *launchd) isBootstrapped(ctx context.Context, serviceTarget string) (bool, error) {
 	// run 'launchctl print' on given service target to see if it exists
 	exitCode, err := l.cmdExec.RunQuiet(ctx, "launchctl", "print", serviceTarget)
@@ -160,7 +302,7 @@ func (l *launchd) bootout(ctx context.Context, serviceTarget string) (bool, erro
 	}
 }
 
-func (l *launchd) Create(ctx context.Context, config *DaemonConfig, force bool) error {
+func (l *launchd) newLaunchdConfig(config *DaemonConfig) *launchdConfig {
 	// Add launchd-specific config
 	lConfig := &launchdConfig{
 		DaemonConfig:           *config,
@@ -168,6 +310,37 @@ func (l *launchd) Create(ctx context.Context, config *DaemonConfig, force bool)
 		StdOut:                 "/dev/null",
 		StdErr:                 "/dev/null",
 	}
+	if l.system {
+		// System daemons aren't tied to a session; start them at boot
+		lConfig.LimitLoadToSessionType = ""
+		lConfig.RunAtLoad = true
+	} else {
+		// Only root can run a daemon as another user
+		lConfig.User = ""
+		lConfig.Group = ""
+	}
+	if config.StdOutPath != "" {
+		lConfig.StdOut = config.StdOutPath
+	}
+	if config.StdErrPath != "" {
+		lConfig.StdErr = config.StdErrPath
+	}
+
+	return lConfig
+}
+
+func (l *launchd) Create(ctx context.Context, config *DaemonConfig, force bool) error {
+	lConfig := l.newLaunchdConfig(config)
+	return l.create(ctx, lConfig, force)
+}
+
+func (l *launchd) create(ctx context.Context, lConfig *launchdConfig, force bool) error {
+	config := &lConfig.DaemonConfig
+
+	err := checkPrivileges(ctx, l.logger, l.user, l.system)
+	if err != nil {
+		return err
+	}
 
 	// Generate the configuration
 	var newPlist bytes.Buffer
@@ -175,21 +348,17 @@ func (l *launchd) Create(ctx context.Context, config *DaemonConfig, force bool)
 	newPlist.WriteString(plistHeader)
 	encoder := xml.NewEncoder(&newPlist)
 	encoder.Indent("", "  ")
-	err := encoder.Encode(lConfig.toPlist())
+	err = encoder.Encode(lConfig.toPlist())
 	if err != nil {
 		return l.logger.Errorf(ctx, "could not encode plist: %w", err)
 	}
 
 	// Check the existing file - if it's the same as the new content, do not overwrite
-	user, err := l.user.CurrentUser()
+	filename, domainTarget, serviceTarget, err := l.targets(ctx, config.Label)
 	if err != nil {
-		return l.logger.Errorf(ctx, "could not get current user for launchd service: %w", err)
+		return err
 	}
 
-	filename := filepath.Join(user.HomeDir, "Library", "LaunchAgents", fmt.Sprintf("%s.plist", config.Label))
-	domainTarget := fmt.Sprintf(domainFormat, user.Uid)
-	serviceTarget := fmt.Sprintf("%s/%s", domainTarget, config.Label)
-
 	alreadyLoaded, err := l.isBootstrapped(ctx, serviceTarget)
 	if err != nil {
 		return l.logger.Error(ctx, err)
@@ -232,13 +401,15 @@ func (l *launchd) Create(ctx context.Context, config *DaemonConfig, force bool)
 }
 
 func (l *launchd) Start(ctx context.Context, label string) error {
-	user, err := l.user.CurrentUser()
+	err := checkPrivileges(ctx, l.logger, l.user, l.system)
 	if err != nil {
-		return l.logger.Errorf(ctx, "could not get current user for launchd service: %w", err)
+		return err
 	}
 
-	domainTarget := fmt.Sprintf(domainFormat, user.Uid)
-	serviceTarget := fmt.Sprintf("%s/%s", domainTarget, label)
+	_, _, serviceTarget, err := l.targets(ctx, label)
+	if err != nil {
+		return err
+	}
 	exitCode, err := l.cmdExec.RunQuiet(ctx, "launchctl", "kickstart", serviceTarget)
 	if err != nil {
 		return l.logger.Error(ctx, err)
@@ -252,13 +423,15 @@ func (l *launchd) Start(ctx context.Context, label string) error {
 }
 
 func (l *launchd) Stop(ctx context.Context, label string) error {
-	user, err := l.user.CurrentUser()
+	err := checkPrivileges(ctx, l.logger, l.user, l.system)
 	if err != nil {
-		return l.logger.Errorf(ctx, "could not get current user for launchd service: %w", err)
+		return err
 	}
 
-	domainTarget := fmt.Sprintf(domainFormat, user.Uid)
-	serviceTarget := fmt.Sprintf("%s/%s", domainTarget, label)
+	_, _, serviceTarget, err := l.targets(ctx, label)
+	if err != nil {
+		return err
+	}
 	exitCode, err := l.cmdExec.RunQuiet(ctx, "launchctl", "kill", "SIGINT", serviceTarget)
 	if err != nil {
 		return l.logger.Error(ctx, err)
@@ -275,14 +448,15 @@ func (l *launchd) Stop(ctx context.Context, label string) error {
 }
 
 func (l *launchd) Remove(ctx context.Context, label string) error {
-	user, err := l.user.CurrentUser()
+	err := checkPrivileges(ctx, l.logger, l.user, l.system)
 	if err != nil {
-		return l.logger.Errorf(ctx, "could not get current user for launchd service: %w", err)
+		return err
 	}
 
-	filename := filepath.Join(user.HomeDir, "Library", "LaunchAgents", fmt.Sprintf("%s.plist", label))
-	domainTarget := fmt.Sprintf(domainFormat, user.Uid)
-	serviceTarget := fmt.Sprintf("%s/%s", domainTarget, label)
+	filename, _, serviceTarget, err := l.targets(ctx, label)
+	if err != nil {
+		return err
+	}
 
 	_, err = l.bootout(ctx, serviceTarget)
 	if err != nil {
@@ -296,3 +470,169 @@ func (l *launchd) Remove(ctx context.Context, label string) error {
 
 	return nil
 }
+
+func (l *launchd) TimersAvailable(ctx context.Context) bool {
+	return true
+}
+
+func (l *launchd) CreateTimer(ctx context.Context, config *DaemonConfig, schedule *CalendarSchedule, force bool) error {
+	// A launchd job is a timer if it has a calendar schedule
+	lConfig := l.newLaunchdConfig(config)
+	lConfig.Schedule = schedule
+	lConfig.RunAtLoad = false
+
+	return l.create(ctx, lConfig, force)
+}
+
+func (l *launchd) RemoveTimer(ctx context.Context, label string) error {
+	return l.Remove(ctx, label)
+}
+
+// readPlistConfig reads the program, arguments, and output files from a plist
+// written by 'Create()'.
+func readPlistConfig(label string, content string) (*DaemonConfig, error) {
+	config := &DaemonConfig{Label: label}
+	decoder := xml.NewDecoder(strings.NewReader(content))
+
+	// Only the keys of the top-level dict are read, so track the nesting depth
+	// ('plist' is depth 1, its 'dict' is depth 2)
+	depth := 0
+	key := ""
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("invalid plist: %w", err)
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			depth++
+			if depth != 3 {
+				continue
+			}
+
+			if token.Name.Local == "key" {
+				err = decoder.DecodeElement(&key, &token)
+				depth--
+			} else if token.Name.Local == "string" {
+				var value string
+				err = decoder.DecodeElement(&value, &token)
+				depth--
+				switch key {
+				case "Program":
+					config.Program = value
+				case "StandardOutPath":
+					config.StdOutPath = value
+				case "StandardErrorPath":
+					config.StdErrPath = value
+				}
+			} else if token.Name.Local == "array" && key == "ProgramArguments" {
+				var args struct {
+					Strings []string `xml:"string"`
+				}
+				err = decoder.DecodeElement(&args, &token)
+				depth--
+				if len(args.Strings) > 0 {
+					// The first argument is the program itself
+					config.Arguments = args.Strings[1:]
+				}
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid plist: %w", err)
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+
+	return config, nil
+}
+
+func (l *launchd) readPlist(ctx context.Context, label string) (string, *DaemonConfig, error) {
+	filename, _, _, err := l.targets(ctx, label)
+	if err != nil {
+		return "", nil, err
+	}
+
+	lines, err := l.fileSystem.ReadFileLines(filename)
+	if err != nil {
+		return "", nil, l.logger.Errorf(ctx, "could not read launchd plist: %w", err)
+	} else if len(lines) == 0 {
+		return "", nil, nil
+	}
+
+	config, err := readPlistConfig(label, strings.Join(lines, "\n"))
+	if err != nil {
+		return "", nil, l.logger.Error(ctx, err)
+	}
+
+	return filename, config, nil
+}
+
+func (l *launchd) Status(ctx context.Context, label string) (*DaemonStatus, error) {
+	_, _, serviceTarget, err := l.targets(ctx, label)
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout bytes.Buffer
+	exitCode, err := l.cmdExec.Run(ctx, "launchctl", []string{"print", serviceTarget}, cmd.Stdout(&stdout))
+	if err != nil {
+		return nil, l.logger.Error(ctx, err)
+	}
+
+	status := &DaemonStatus{}
+	if exitCode == 0 {
+		status.Loaded = true
+
+		// 'launchctl print' lists the properties of the service as
+		// 'key = value'; nested blocks follow the top-level ones we need, so
+		// only the first occurrence of each key is used.
+		properties := map[string]string{}
+		for _, line := range strings.Split(stdout.String(), "\n") {
+			key, value, found := strings.Cut(strings.TrimSpace(line), " = ")
+			if _, exists := properties[key]; found && !exists {
+				properties[key] = value
+			}
+		}
+
+		status.Running = properties["state"] == "running"
+		status.PID, _ = strconv.Atoi(properties["pid"])
+		if lastExitCode, err := strconv.Atoi(properties["last exit code"]); err == nil {
+			status.LastExitCode = &lastExitCode
+		}
+	} else if exitCode != LaunchdServiceNotFoundErrorCode {
+		return nil, l.logger.Errorf(ctx, "'launchctl print' exited with status %d", exitCode)
+	}
+
+	status.ConfigFile, status.Config, err = l.readPlist(ctx, label)
+	if err != nil {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+func (l *launchd) Logs(ctx context.Context, label string, lines int, follow bool) error {
+	_, config, err := l.readPlist(ctx, label)
+	if err != nil {
+		return err
+	}
+
+	files := logFiles(config)
+	if len(files) == 0 {
+		return l.logger.Errorf(ctx, "the output of '%s' is not logged; "+
+			"reconfigure it with '--stdout-log' and '--stderr-log'", label)
+	}
+
+	exitCode, err := l.cmdExec.RunStdout(ctx, "tail", append(tailArgs(lines, follow), files...)...)
+	if err != nil {
+		return l.logger.Error(ctx, err)
+	} else if exitCode != 0 {
+		return l.logger.Errorf(ctx, "'tail' exited with status %d", exitCode)
+	}
+
+	return nil
+}
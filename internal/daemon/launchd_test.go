@@ -4,12 +4,15 @@ import (
 	"context"
 	"encoding/xml"
 	"fmt"
+	"io"
 	"os/user"
 	"path/filepath"
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/git-ecosystem/git-bundle-server/internal/cmd"
 	"github.com/git-ecosystem/git-bundle-server/internal/daemon"
 	. "github.com/git-ecosystem/git-bundle-server/internal/testhelpers"
 	"github.com/stretchr/testify/assert"
@@ -218,6 +221,76 @@ var launchdCreatePlistTests = []struct {
 			"<string>another-arg</string>",
 			"</array>",
 
+			"</dict>",
+			"</plist>",
+		},
+	},
+	{
+		title: "Created plist includes environment, restart policy, logs, and limits",
+		config: &daemon.DaemonConfig{
+			Label:            "test-options",
+			Program:          "/path/to/the/program",
+			Environment:      []string{"GIT_TRACE2_EVENT=/var/log/trace.json"},
+			WorkingDirectory: "/srv/bundles",
+			Restart:          &daemon.RestartPolicy{Delay: 1500 * time.Millisecond, MaxDelay: time.Minute},
+			StdOutPath:       "/var/log/out.log",
+			StdErrPath:       "/var/log/err.log",
+			MemoryLimit:      512 * 1024 * 1024,
+			CPUQuota:         50,
+		},
+		expectedPlistLines: []string{
+			`<?xml version="1.0" encoding="UTF-8"?>`,
+			`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">`,
+			`<plist version="1.0">`,
+			"<dict>",
+
+			"<key>Label</key>",
+			"<string>test-options</string>",
+
+			"<key>Program</key>",
+			"<string>/path/to/the/program</string>",
+
+			"<key>LimitLoadToSessionType</key>",
+			"<string>Background</string>",
+
+			"<key>StandardOutPath</key>",
+			"<string>/var/log/out.log</string>",
+
+			"<key>StandardErrorPath</key>",
+			"<string>/var/log/err.log</string>",
+
+			"<key>ProgramArguments</key>",
+			"<array>",
+			"<string>/path/to/the/program</string>",
+			"</array>",
+
+			"<key>WorkingDirectory</key>",
+			"<string>/srv/bundles</string>",
+
+			"<key>EnvironmentVariables</key>",
+			"<dict>",
+			"<key>GIT_TRACE2_EVENT</key>",
+			"<string>/var/log/trace.json</string>",
+			"</dict>",
+
+			"<key>KeepAlive</key>",
+			"<dict>",
+			"<key>SuccessfulExit</key>",
+			"<false>",
+			"</false>",
+			"</dict>",
+			"<key>ThrottleInterval</key>",
+			"<integer>2</integer>",
+
+			"<key>HardResourceLimits</key>",
+			"<dict>",
+			"<key>ResidentSetSize</key>",
+			"<integer>536870912</integer>",
+			"</dict>",
+
+			"<key>ProcessType</key>",
+			"<string>Background</string>",
+
 			"</dict>",
 			"</plist>",
 		},
@@ -360,6 +433,82 @@ func TestLaunchd_Create(t *testing.T) {
 	}
 }
 
+func TestLaunchd_CreateSystem(t *testing.T) {
+	// Set up mocks
+	testLogger := &MockTraceLogger{}
+	testUserProvider := &MockUserProvider{}
+	testUserProvider.On("CurrentUser").Return(&user.User{Uid: "0", Username: "root", HomeDir: "/var/root"}, nil)
+
+	testCommandExecutor := &MockCommandExecutor{}
+	testFileSystem := &MockFileSystem{}
+
+	ctx := context.Background()
+
+	launchd := daemon.NewLaunchdSystemProvider(testLogger, testUserProvider, testCommandExecutor, testFileSystem)
+
+	var actualFileBytes []byte
+	testCommandExecutor.On("RunQuiet",
+		ctx,
+		"launchctl",
+		[]string{"print", "system/com.example.testdaemon"},
+	).Return(daemon.LaunchdServiceNotFoundErrorCode, nil).Once()
+	testFileSystem.On("FileExists",
+		"/Library/LaunchDaemons/com.example.testdaemon.plist",
+	).Return(false, nil).Once()
+	testFileSystem.On("WriteFile",
+		"/Library/LaunchDaemons/com.example.testdaemon.plist",
+		mock.MatchedBy(func(fileBytes any) bool {
+			actualFileBytes = fileBytes.([]byte)
+			return true
+		}),
+	).Return(nil).Once()
+	testCommandExecutor.On("RunQuiet",
+		ctx,
+		"launchctl",
+		[]string{"bootstrap", "system", "/Library/LaunchDaemons/com.example.testdaemon.plist"},
+	).Return(0, nil).Once()
+
+	err := launchd.Create(ctx, &daemon.DaemonConfig{
+		Label:   "com.example.testdaemon",
+		Program: "/usr/local/bin/test/git-bundle-web-server",
+		User:    "git-bundle",
+		Group:   "staff",
+	}, false)
+	assert.Nil(t, err)
+	mock.AssertExpectationsForObjects(t, testCommandExecutor, testFileSystem)
+
+	fileContents := strings.TrimSpace(string(actualFileBytes))
+	plistLines := strings.Split(
+		regexp.MustCompile(`>\s*<`).ReplaceAllString(fileContents, ">\n<"), "\n")
+	assert.ElementsMatch(t, []string{
+		`<?xml version="1.0" encoding="UTF-8"?>`,
+		`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">`,
+		`<plist version="1.0">`,
+		"<dict>",
+		"<key>Label</key>",
+		"<string>com.example.testdaemon</string>",
+		"<key>Program</key>",
+		"<string>/usr/local/bin/test/git-bundle-web-server</string>",
+		"<key>StandardOutPath</key>",
+		"<string>/dev/null</string>",
+		"<key>StandardErrorPath</key>",
+		"<string>/dev/null</string>",
+		"<key>ProgramArguments</key>",
+		"<array>",
+		"<string>/usr/local/bin/test/git-bundle-web-server</string>",
+		"</array>",
+		"<key>UserName</key>",
+		"<string>git-bundle</string>",
+		"<key>GroupName</key>",
+		"<string>staff</string>",
+		"<key>RunAtLoad</key>",
+		"<true>",
+		"</true>",
+		"</dict>",
+		"</plist>",
+	}, plistLines)
+}
+
 func TestLaunchd_Start(t *testing.T) {
 	// Set up mocks
 	testLogger := &MockTraceLogger{}
@@ -588,3 +737,177 @@ func TestLaunchd_Remove(t *testing.T) {
 		testFileSystem.Mock = mock.Mock{}
 	}
 }
+
+func TestLaunchd_CreateTimer(t *testing.T) {
+	// Set up mocks
+	testLogger := &MockTraceLogger{}
+	testUser := &user.User{
+		Uid:      "123",
+		Username: "testuser",
+		HomeDir:  "/my/test/dir",
+	}
+	testUserProvider := &MockUserProvider{}
+	testUserProvider.On("CurrentUser").Return(testUser, nil)
+
+	testCommandExecutor := &MockCommandExecutor{}
+	testFileSystem := &MockFileSystem{}
+
+	ctx := context.Background()
+
+	launchd := daemon.NewLaunchdProvider(testLogger, testUserProvider, testCommandExecutor, testFileSystem)
+
+	t.Run("Plist contains calendar intervals", func(t *testing.T) {
+		var actualFileBytes []byte
+
+		// Mock responses for successful fresh write
+		testCommandExecutor.On("RunQuiet",
+			ctx,
+			"launchctl",
+			mock.MatchedBy(func(args []string) bool { return args[0] == "print" }),
+		).Return(daemon.LaunchdServiceNotFoundErrorCode, nil).Once()
+		testCommandExecutor.On("RunQuiet",
+			ctx,
+			"launchctl",
+			mock.MatchedBy(func(args []string) bool { return args[0] == "bootstrap" }),
+		).Return(0, nil).Once()
+		testFileSystem.On("FileExists",
+			mock.AnythingOfType("string"),
+		).Return(false, nil).Once()
+		testFileSystem.On("WriteFile",
+			filepath.Clean(fmt.Sprintf("/my/test/dir/Library/LaunchAgents/%s.plist", basicDaemonConfig.Label)),
+			mock.MatchedBy(func(fileBytes []byte) bool {
+				actualFileBytes = fileBytes
+				return true
+			}),
+		).Return(nil).Once()
+
+		schedule, err := daemon.ParseCalendarSchedule("30 6,18 * * 1")
+		assert.Nil(t, err)
+
+		err = launchd.CreateTimer(ctx, &basicDaemonConfig, schedule, false)
+		assert.Nil(t, err)
+		mock.AssertExpectationsForObjects(t, testCommandExecutor, testFileSystem)
+
+		// Check XML
+		err = xml.Unmarshal(actualFileBytes, new(interface{}))
+		if err != nil {
+			assert.Fail(t, "plist XML is malformed")
+		}
+		fileContents := regexp.MustCompile(`>\s*<`).ReplaceAllString(string(actualFileBytes), "><")
+		assert.Contains(t, fileContents,
+			"<key>StartCalendarInterval</key><array>"+
+				"<dict><key>Minute</key><integer>30</integer><key>Hour</key><integer>6</integer><key>Weekday</key><integer>1</integer></dict>"+
+				"<dict><key>Minute</key><integer>30</integer><key>Hour</key><integer>18</integer><key>Weekday</key><integer>1</integer></dict>"+
+				"</array>")
+	})
+}
+
+func TestLaunchd_Status(t *testing.T) {
+	// Set up mocks
+	testLogger := &MockTraceLogger{}
+	testUser := &user.User{
+		Uid:      "123",
+		Username: "testuser",
+		HomeDir:  "/my/test/dir",
+	}
+	testUserProvider := &MockUserProvider{}
+	testUserProvider.On("CurrentUser").Return(testUser, nil)
+
+	testCommandExecutor := &MockCommandExecutor{}
+	testFileSystem := &MockFileSystem{}
+
+	ctx := context.Background()
+
+	launchd := daemon.NewLaunchdProvider(testLogger, testUserProvider, testCommandExecutor, testFileSystem)
+	plistFile := "/my/test/dir/Library/LaunchAgents/com.test.service.plist"
+
+	t.Run("Running service with config", func(t *testing.T) {
+		var stdout io.Writer
+		testCommandExecutor.On("Run",
+			ctx,
+			"launchctl",
+			[]string{"print", "user/123/com.test.service"},
+			mock.MatchedBy(func(settings []cmd.Setting) bool {
+				for _, setting := range settings {
+					if setting.Key == cmd.StdoutKey {
+						stdout = setting.Value.(io.Writer)
+					}
+				}
+				return stdout != nil
+			}),
+		).Run(func(mock.Arguments) {
+			stdout.Write([]byte("user/123/com.test.service = {\n" +
+				"\tactive count = 1\n" +
+				"\tstate = running\n" +
+				"\tpid = 4321\n" +
+				"\tlast exit code = 2\n" +
+				"\tendpoints = {\n" +
+				"\t\tstate = waiting\n" +
+				"\t}\n" +
+				"}\n"))
+		}).Return(0, nil).Once()
+		testFileSystem.On("ReadFileLines", plistFile).Return([]string{
+			`<?xml version="1.0" encoding="UTF-8"?>`,
+			`<plist version="1.0">`,
+			"  <dict>",
+			"    <key>Label</key>",
+			"    <string>com.test.service</string>",
+			"    <key>Program</key>",
+			"    <string>/usr/bin/git-bundle-web-server</string>",
+			"    <key>StandardOutPath</key>",
+			"    <string>/dev/null</string>",
+			"    <key>StandardErrorPath</key>",
+			"    <string>/var/log/err.log</string>",
+			"    <key>ProgramArguments</key>",
+			"    <array>",
+			"      <string>/usr/bin/git-bundle-web-server</string>",
+			"      <string>--port</string>",
+			"      <string>8080</string>",
+			"    </array>",
+			"    <key>EnvironmentVariables</key>",
+			"    <dict>",
+			"      <key>Program</key>",
+			"      <string>not-the-program</string>",
+			"    </dict>",
+			"  </dict>",
+			"</plist>",
+		}, nil).Once()
+
+		status, err := launchd.Status(ctx, "com.test.service")
+		assert.Nil(t, err)
+		assert.Equal(t, &daemon.DaemonStatus{
+			Loaded:       true,
+			Running:      true,
+			PID:          4321,
+			LastExitCode: PtrTo(2),
+			ConfigFile:   plistFile,
+			Config: &daemon.DaemonConfig{
+				Label:      "com.test.service",
+				Program:    "/usr/bin/git-bundle-web-server",
+				Arguments:  []string{"--port", "8080"},
+				StdOutPath: "/dev/null",
+				StdErrPath: "/var/log/err.log",
+			},
+		}, status)
+		mock.AssertExpectationsForObjects(t, testCommandExecutor, testFileSystem)
+	})
+
+	// Reset mocks
+	testCommandExecutor.Mock = mock.Mock{}
+	testFileSystem.Mock = mock.Mock{}
+
+	t.Run("Service not bootstrapped", func(t *testing.T) {
+		testCommandExecutor.On("Run",
+			ctx,
+			"launchctl",
+			[]string{"print", "user/123/com.test.service"},
+			mock.Anything,
+		).Return(daemon.LaunchdServiceNotFoundErrorCode, nil).Once()
+		testFileSystem.On("ReadFileLines", plistFile).Return([]string{}, nil).Once()
+
+		status, err := launchd.Status(ctx, "com.test.service")
+		assert.Nil(t, err)
+		assert.Equal(t, &daemon.DaemonStatus{}, status)
+		mock.AssertExpectationsForObjects(t, testCommandExecutor, testFileSystem)
+	})
+}
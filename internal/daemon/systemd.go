@@ -4,30 +4,143 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"math"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/git-ecosystem/git-bundle-server/internal/cmd"
 	"github.com/git-ecosystem/git-bundle-server/internal/common"
 	"github.com/git-ecosystem/git-bundle-server/internal/log"
 )
 
+// The [Service] options shared by all service units, following 'Type='
+const serviceOptionsTemplate string = `ExecStart={{sq_escape .Program}}{{range .Arguments}} {{sq_escape .}}{{end}}
+{{- if .WorkingDirectory}}
+WorkingDirectory={{specifier_escape .WorkingDirectory}}
+{{- end}}
+{{- range .Environment}}
+Environment={{dq_escape .}}
+{{- end}}
+{{- with .Restart}}
+Restart=on-failure
+RestartSec={{msec .Delay}}ms
+{{- if gt .MaxDelay .Delay}}
+RestartSteps={{restart_steps .}}
+RestartMaxDelaySec={{msec .MaxDelay}}ms
+{{- end}}
+{{- end}}
+{{- if .StdOutPath}}
+StandardOutput=append:{{specifier_escape .StdOutPath}}
+{{- end}}
+{{- if .StdErrPath}}
+StandardError=append:{{specifier_escape .StdErrPath}}
+{{- end}}
+{{- if .MemoryLimit}}
+MemoryMax={{.MemoryLimit}}
+{{- end}}
+{{- if .CPUQuota}}
+CPUQuota={{.CPUQuota}}%
+{{- end}}
+{{- if .User}}
+User={{specifier_escape .User}}
+{{- end}}
+{{- if .Group}}
+Group={{specifier_escape .Group}}
+{{- end}}
+`
+
+// Services restarted on failure disable the default start rate limit, which
+// would otherwise give up on a service that fails in quick succession.
 const serviceTemplate string = `[Unit]
 Description={{.Description}}
+{{- if .Restart}}
+StartLimitIntervalSec=0
+{{- end}}
 
 [Service]
 Type=simple
-ExecStart={{sq_escape .Program}}{{range .Arguments}} {{sq_escape .}}{{end}}
+` + serviceOptionsTemplate + `{{if .WantedBy}}
+[Install]
+WantedBy={{.WantedBy}}
+{{end}}`
+
+const timerServiceTemplate string = `[Unit]
+Description={{.Description}}
+
+[Service]
+Type=oneshot
+` + serviceOptionsTemplate
+
+const timerTemplate string = `[Unit]
+Description={{.Description}}
+
+[Timer]
+OnCalendar={{.OnCalendar}}
+Persistent=true
+
+[Install]
+WantedBy=timers.target
 `
 
+type systemdServiceConfig struct {
+	DaemonConfig
+
+	// The target that starts the service at boot, if any.
+	WantedBy string
+}
+
+type systemdTimerConfig struct {
+	DaemonConfig
+	OnCalendar string
+}
+
+var unitTemplateFuncs = template.FuncMap{
+	"sq_escape": func(str string) string {
+		return fmt.Sprintf("'%s'", strings.ReplaceAll(str, "'", "\\'"))
+	},
+	"dq_escape": func(str string) string {
+		str = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "%", "%%").Replace(str)
+		return fmt.Sprintf("\"%s\"", str)
+	},
+	"specifier_escape": func(str string) string {
+		return strings.ReplaceAll(str, "%", "%%")
+	},
+	"msec": func(d time.Duration) int64 {
+		return d.Milliseconds()
+	},
+	// The number of steps in which systemd increases the restart delay from
+	// 'RestartSec' to 'RestartMaxDelaySec', chosen so that the delay roughly
+	// doubles with each restart.
+	"restart_steps": func(r *RestartPolicy) int {
+		if r.Delay <= 0 {
+			return 1
+		}
+		return int(math.Ceil(math.Log2(float64(r.MaxDelay) / float64(r.Delay))))
+	},
+}
+
 const SystemdUnitNotInstalledErrorCode int = 5
 
+// The first systemd version supporting 'RestartSteps=' and
+// 'RestartMaxDelaySec='. Older versions ignore them (logging "Unknown key"),
+// so the restart delay can't increase.
+const systemdRestartBackoffVersion int = 254
+
+// The directory containing the units of the system service manager.
+const systemdSystemUnitDir string = "/etc/systemd/system"
+
 type systemd struct {
 	logger     log.TraceLogger
 	user       common.UserProvider
 	cmdExec    cmd.CommandExecutor
 	fileSystem common.FileSystem
+
+	// Whether the units are managed by the system (rather than the user's)
+	// service manager.
+	system bool
 }
 
 func NewSystemdProvider(
@@ -44,38 +157,142 @@ func NewSystemdProvider(
 	}
 }
 
+// NewSystemdSystemProvider creates a DaemonProvider managing units of the
+// system service manager, which start at boot and run as the user given in
+// their config. Modifying them requires root privileges.
+func NewSystemdSystemProvider(
+	l log.TraceLogger,
+	u common.UserProvider,
+	c cmd.CommandExecutor,
+	fs common.FileSystem,
+) DaemonProvider {
+	return &systemd{
+		logger:     l,
+		user:       u,
+		cmdExec:    c,
+		fileSystem: fs,
+		system:     true,
+	}
+}
+
+// scopeArgs prepends the option selecting the user service manager to the
+// arguments of 'systemctl' or 'journalctl', if needed.
+func (s *systemd) scopeArgs(args ...string) []string {
+	if s.system {
+		return args
+	}
+	return append([]string{"--user"}, args...)
+}
+
+func (s *systemd) systemctl(ctx context.Context, args ...string) (int, error) {
+	return s.cmdExec.RunQuiet(ctx, "systemctl", s.scopeArgs(args...)...)
+}
+
 func (s *systemd) reloadDaemon(ctx context.Context) error {
-	exitCode, err := s.cmdExec.RunQuiet(ctx, "systemctl", "--user", "daemon-reload")
+	exitCode, err := s.systemctl(ctx, "daemon-reload")
 	if err != nil {
 		return s.logger.Error(ctx, err)
 	}
 
 	if exitCode != 0 {
-		return s.logger.Errorf(ctx, "'systemctl --user daemon-reload' exited with status %d", exitCode)
+		return s.logger.Errorf(ctx, "'systemctl daemon-reload' exited with status %d", exitCode)
 	}
 
 	return nil
 }
 
-func (s *systemd) Create(ctx context.Context, config *DaemonConfig, force bool) error {
+func (s *systemd) unitFilename(ctx context.Context, unitName string) (string, error) {
+	if s.system {
+		return filepath.Join(systemdSystemUnitDir, unitName), nil
+	}
+
 	user, err := s.user.CurrentUser()
 	if err != nil {
-		return s.logger.Errorf(ctx, "could not get current user for systemd service: %w", err)
+		return "", s.logger.Errorf(ctx, "could not get current user for systemd service: %w", err)
+	}
+
+	return filepath.Join(user.HomeDir, ".config", "systemd", "user", unitName), nil
+}
+
+func generateUnit(name string, unitTemplate string, data any) ([]byte, error) {
+	var unit bytes.Buffer
+	t, err := template.New(name).Funcs(unitTemplateFuncs).Parse(unitTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate systemd configuration: %w", err)
+	}
+	err = t.Execute(&unit, data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate systemd configuration: %w", err)
+	}
+
+	return unit.Bytes(), nil
+}
+
+// version returns the version of the installed systemd, or 0 if it can't be
+// determined.
+func (s *systemd) version(ctx context.Context) int {
+	var stdout bytes.Buffer
+	exitCode, err := s.cmdExec.Run(ctx, "systemctl", []string{"--version"}, cmd.Stdout(&stdout))
+	if err != nil || exitCode != 0 {
+		return 0
+	}
+
+	// The output starts with e.g. 'systemd 252 (252.22-1~deb12u1)'
+	fields := strings.Fields(stdout.String())
+	if len(fields) < 2 || fields[0] != "systemd" {
+		return 0
+	}
+	version, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return 0
+	}
+	return version
+}
+
+// serviceConfig returns 'config' as it applies to this service manager.
+func (s *systemd) serviceConfig(ctx context.Context, config *DaemonConfig) DaemonConfig {
+	serviceConfig := *config
+	if !s.system {
+		// The user service manager can't run services as another user
+		serviceConfig.User = ""
+		serviceConfig.Group = ""
+	}
+
+	if config.Restart != nil && config.Restart.MaxDelay > config.Restart.Delay {
+		if version := s.version(ctx); version < systemdRestartBackoffVersion {
+			// Restart after 'RestartSec' every time, rather than writing keys
+			// that would be ignored
+			fmt.Printf("Warning: increasing restart delays require systemd %d or later; "+
+				"restarting every %s instead\n", systemdRestartBackoffVersion, config.Restart.Delay)
+			restart := *config.Restart
+			restart.MaxDelay = restart.Delay
+			serviceConfig.Restart = &restart
+		}
+	}
+
+	return serviceConfig
+}
+
+func (s *systemd) Create(ctx context.Context, config *DaemonConfig, force bool) error {
+	err := checkPrivileges(ctx, s.logger, s.user, s.system)
+	if err != nil {
+		return err
 	}
 
 	// Generate the configuration
-	var newServiceUnit bytes.Buffer
-	t, err := template.New(config.Label).Funcs(template.FuncMap{
-		"sq_escape": func(str string) string {
-			return fmt.Sprintf("'%s'", strings.ReplaceAll(str, "'", "\\'"))
-		},
-	}).Parse(serviceTemplate)
+	serviceConfig := &systemdServiceConfig{DaemonConfig: s.serviceConfig(ctx, config)}
+	if s.system {
+		serviceConfig.WantedBy = "multi-user.target"
+	}
+	newServiceUnit, err := generateUnit(config.Label, serviceTemplate, serviceConfig)
 	if err != nil {
-		return s.logger.Errorf(ctx, "unable to generate systemd configuration: %w", err)
+		return s.logger.Error(ctx, err)
 	}
-	t.Execute(&newServiceUnit, config)
 
-	filename := filepath.Join(user.HomeDir, ".config", "systemd", "user", fmt.Sprintf("%s.service", config.Label))
+	filename, err := s.unitFilename(ctx, fmt.Sprintf("%s.service", config.Label))
+	if err != nil {
+		return err
+	}
 
 	// Check whether the file exists
 	fileExists, err := s.fileSystem.FileExists(filename)
@@ -89,23 +306,38 @@ func (s *systemd) Create(ctx context.Context, config *DaemonConfig, force bool)
 	}
 
 	// Otherwise, write the new file
-	err = s.fileSystem.WriteFile(filename, newServiceUnit.Bytes())
+	err = s.fileSystem.WriteFile(filename, newServiceUnit)
 	if err != nil {
 		return s.logger.Errorf(ctx, "unable to write service unit: %w", err)
 	}
 
-	// Reload the user-scoped service units after adding
+	// Reload the service units after adding
 	err = s.reloadDaemon(ctx)
 	if err != nil {
 		return s.logger.Error(ctx, err)
 	}
 
+	if s.system {
+		// Start the service at boot
+		exitCode, err := s.systemctl(ctx, "enable", fmt.Sprintf("%s.service", config.Label))
+		if err != nil {
+			return s.logger.Error(ctx, err)
+		} else if exitCode != 0 {
+			return s.logger.Errorf(ctx, "'systemctl enable' exited with status %d", exitCode)
+		}
+	}
+
 	return nil
 }
 
 func (s *systemd) Start(ctx context.Context, label string) error {
+	err := checkPrivileges(ctx, s.logger, s.user, s.system)
+	if err != nil {
+		return err
+	}
+
 	// TODO: warn user if already running
-	exitCode, err := s.cmdExec.RunQuiet(ctx, "systemctl", "--user", "start", label)
+	exitCode, err := s.systemctl(ctx, "start", label)
 	if err != nil {
 		return s.logger.Error(ctx, err)
 	}
@@ -118,8 +350,13 @@ func (s *systemd) Start(ctx context.Context, label string) error {
 }
 
 func (s *systemd) Stop(ctx context.Context, label string) error {
+	err := checkPrivileges(ctx, s.logger, s.user, s.system)
+	if err != nil {
+		return err
+	}
+
 	// TODO: warn user if already stopped
-	exitCode, err := s.cmdExec.RunQuiet(ctx, "systemctl", "--user", "stop", label)
+	exitCode, err := s.systemctl(ctx, "stop", label)
 	if err != nil {
 		return s.logger.Error(ctx, err)
 	}
@@ -132,18 +369,31 @@ func (s *systemd) Stop(ctx context.Context, label string) error {
 }
 
 func (s *systemd) Remove(ctx context.Context, label string) error {
-	user, err := s.user.CurrentUser()
+	err := checkPrivileges(ctx, s.logger, s.user, s.system)
+	if err != nil {
+		return err
+	}
+
+	filename, err := s.unitFilename(ctx, fmt.Sprintf("%s.service", label))
 	if err != nil {
-		return s.logger.Errorf(ctx, "could not get current user for launchd service: %w", err)
+		return err
+	}
+
+	if s.system {
+		// Stop starting the service at boot. The unit may not exist, so the
+		// exit code is ignored.
+		_, err = s.systemctl(ctx, "disable", fmt.Sprintf("%s.service", label))
+		if err != nil {
+			return s.logger.Error(ctx, err)
+		}
 	}
-	filename := filepath.Join(user.HomeDir, ".config", "systemd", "user", fmt.Sprintf("%s.service", label))
 
 	_, err = s.fileSystem.DeleteFile(filename)
 	if err != nil {
 		return s.logger.Errorf(ctx, "could not delete service unit: %w", err)
 	}
 
-	// Reload the user-scoped service units after removing
+	// Reload the service units after removing
 	err = s.reloadDaemon(ctx)
 	if err != nil {
 		return s.logger.Error(ctx, err)
@@ -151,3 +401,252 @@ func (s *systemd) Remove(ctx context.Context, label string) error {
 
 	return nil
 }
+
+func (s *systemd) TimersAvailable(ctx context.Context) bool {
+	// Timers require a running service manager, which isn't always available
+	// (e.g. in containers)
+	exitCode, err := s.systemctl(ctx, "show-environment")
+	return err == nil && exitCode == 0
+}
+
+func (s *systemd) CreateTimer(ctx context.Context, config *DaemonConfig, schedule *CalendarSchedule, force bool) error {
+	err := checkPrivileges(ctx, s.logger, s.user, s.system)
+	if err != nil {
+		return err
+	}
+
+	timerConfig := &systemdTimerConfig{
+		DaemonConfig: s.serviceConfig(ctx, config),
+		OnCalendar:   schedule.onCalendar(),
+	}
+
+	// Generate the configuration
+	newServiceUnit, err := generateUnit(config.Label, timerServiceTemplate, timerConfig)
+	if err != nil {
+		return s.logger.Error(ctx, err)
+	}
+	newTimerUnit, err := generateUnit(config.Label, timerTemplate, timerConfig)
+	if err != nil {
+		return s.logger.Error(ctx, err)
+	}
+
+	serviceFilename, err := s.unitFilename(ctx, fmt.Sprintf("%s.service", config.Label))
+	if err != nil {
+		return err
+	}
+	timerFilename, err := s.unitFilename(ctx, fmt.Sprintf("%s.timer", config.Label))
+	if err != nil {
+		return err
+	}
+
+	// The timer unit is written last, so its existence indicates the timer is
+	// fully configured
+	fileExists, err := s.fileSystem.FileExists(timerFilename)
+	if err != nil {
+		return s.logger.Errorf(ctx, "could not determine whether timer unit '%s' exists: %w", config.Label, err)
+	}
+
+	if !force && fileExists {
+		return nil
+	}
+
+	err = s.fileSystem.WriteFile(serviceFilename, newServiceUnit)
+	if err != nil {
+		return s.logger.Errorf(ctx, "unable to write service unit: %w", err)
+	}
+	err = s.fileSystem.WriteFile(timerFilename, newTimerUnit)
+	if err != nil {
+		return s.logger.Errorf(ctx, "unable to write timer unit: %w", err)
+	}
+
+	err = s.reloadDaemon(ctx)
+	if err != nil {
+		return s.logger.Error(ctx, err)
+	}
+
+	// Start the timer now and whenever the user logs in (or, for the system
+	// service manager, at boot)
+	timerUnit := fmt.Sprintf("%s.timer", config.Label)
+	exitCode, err := s.systemctl(ctx, "enable", "--now", timerUnit)
+	if err != nil {
+		return s.logger.Error(ctx, err)
+	}
+
+	if exitCode != 0 {
+		return s.logger.Errorf(ctx, "'systemctl enable' exited with status %d", exitCode)
+	}
+
+	return nil
+}
+
+func (s *systemd) RemoveTimer(ctx context.Context, label string) error {
+	err := checkPrivileges(ctx, s.logger, s.user, s.system)
+	if err != nil {
+		return err
+	}
+
+	timerUnit := fmt.Sprintf("%s.timer", label)
+	exitCode, err := s.systemctl(ctx, "disable", "--now", timerUnit)
+	if err != nil {
+		return s.logger.Error(ctx, err)
+	}
+
+	// The timer may already have been removed
+	if exitCode != 0 && exitCode != SystemdUnitNotInstalledErrorCode {
+		return s.logger.Errorf(ctx, "'systemctl disable' exited with status %d", exitCode)
+	}
+
+	for _, unitName := range []string{timerUnit, fmt.Sprintf("%s.service", label)} {
+		filename, err := s.unitFilename(ctx, unitName)
+		if err != nil {
+			return err
+		}
+
+		_, err = s.fileSystem.DeleteFile(filename)
+		if err != nil {
+			return s.logger.Errorf(ctx, "could not delete unit '%s': %w", unitName, err)
+		}
+	}
+
+	// Reload the user-scoped units after removing
+	err = s.reloadDaemon(ctx)
+	if err != nil {
+		return s.logger.Error(ctx, err)
+	}
+
+	return nil
+}
+
+// parseExecStart splits the command line written to a unit's 'ExecStart=' by
+// 'serviceOptionsTemplate' into its (single-quoted) arguments.
+func parseExecStart(commandLine string) []string {
+	args := []string{}
+	var current strings.Builder
+	inQuotes := false
+	for i := 0; i < len(commandLine); i++ {
+		c := commandLine[i]
+		switch {
+		case c == '\\' && i+1 < len(commandLine):
+			i++
+			current.WriteByte(commandLine[i])
+		case c == '\'':
+			if inQuotes {
+				args = append(args, current.String())
+				current.Reset()
+			}
+			inQuotes = !inQuotes
+		case inQuotes:
+			current.WriteByte(c)
+		}
+	}
+	return args
+}
+
+func (s *systemd) readServiceUnit(ctx context.Context, label string) (string, *DaemonConfig, error) {
+	filename, err := s.unitFilename(ctx, fmt.Sprintf("%s.service", label))
+	if err != nil {
+		return "", nil, err
+	}
+
+	lines, err := s.fileSystem.ReadFileLines(filename)
+	if err != nil {
+		return "", nil, s.logger.Errorf(ctx, "could not read service unit: %w", err)
+	} else if len(lines) == 0 {
+		return "", nil, nil
+	}
+
+	config := &DaemonConfig{Label: label}
+	for _, line := range lines {
+		key, value, _ := strings.Cut(line, "=")
+		switch key {
+		case "Description":
+			config.Description = value
+		case "ExecStart":
+			args := parseExecStart(value)
+			if len(args) > 0 {
+				config.Program = args[0]
+				config.Arguments = args[1:]
+			}
+		case "StandardOutput":
+			if path, ok := strings.CutPrefix(value, "append:"); ok {
+				config.StdOutPath = strings.ReplaceAll(path, "%%", "%")
+			}
+		case "StandardError":
+			if path, ok := strings.CutPrefix(value, "append:"); ok {
+				config.StdErrPath = strings.ReplaceAll(path, "%%", "%")
+			}
+		}
+	}
+
+	return filename, config, nil
+}
+
+func (s *systemd) Status(ctx context.Context, label string) (*DaemonStatus, error) {
+	var stdout bytes.Buffer
+	exitCode, err := s.cmdExec.Run(ctx, "systemctl",
+		s.scopeArgs("show", fmt.Sprintf("%s.service", label),
+			"--property=LoadState,ActiveState,MainPID,ExecMainStatus,ExecMainExitTimestampMonotonic"),
+		cmd.Stdout(&stdout))
+	if err != nil {
+		return nil, s.logger.Error(ctx, err)
+	} else if exitCode != 0 {
+		return nil, s.logger.Errorf(ctx, "'systemctl show' exited with status %d", exitCode)
+	}
+
+	properties := map[string]string{}
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		if key, value, found := strings.Cut(line, "="); found {
+			properties[key] = value
+		}
+	}
+
+	status := &DaemonStatus{
+		Loaded:  properties["LoadState"] == "loaded",
+		Running: properties["ActiveState"] == "active" || properties["ActiveState"] == "reloading",
+	}
+	status.PID, _ = strconv.Atoi(properties["MainPID"])
+
+	exitTimestamp, _ := strconv.ParseUint(properties["ExecMainExitTimestampMonotonic"], 10, 64)
+	if exitTimestamp > 0 {
+		if lastExitCode, err := strconv.Atoi(properties["ExecMainStatus"]); err == nil {
+			status.LastExitCode = &lastExitCode
+		}
+	}
+
+	status.ConfigFile, status.Config, err = s.readServiceUnit(ctx, label)
+	if err != nil {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+func (s *systemd) Logs(ctx context.Context, label string, lines int, follow bool) error {
+	_, config, err := s.readServiceUnit(ctx, label)
+	if err != nil {
+		return err
+	}
+
+	var command string
+	var args []string
+	if files := logFiles(config); len(files) > 0 {
+		command = "tail"
+		args = append(tailArgs(lines, follow), files...)
+	} else {
+		// Output that isn't written to a file goes to the journal
+		command = "journalctl"
+		args = s.scopeArgs("--unit", fmt.Sprintf("%s.service", label), "--lines", strconv.Itoa(lines))
+		if follow {
+			args = append(args, "--follow")
+		}
+	}
+
+	exitCode, err := s.cmdExec.RunStdout(ctx, command, args...)
+	if err != nil {
+		return s.logger.Error(ctx, err)
+	} else if exitCode != 0 {
+		return s.logger.Errorf(ctx, "'%s' exited with status %d", command, exitCode)
+	}
+
+	return nil
+}
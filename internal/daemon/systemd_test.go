@@ -3,12 +3,15 @@ package daemon_test
 import (
 	"context"
 	"fmt"
+	"io"
 	"os/user"
 	"path/filepath"
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/git-ecosystem/git-bundle-server/internal/cmd"
 	"github.com/git-ecosystem/git-bundle-server/internal/daemon"
 	. "github.com/git-ecosystem/git-bundle-server/internal/testhelpers"
 	"github.com/stretchr/testify/assert"
@@ -74,6 +77,9 @@ var systemdCreateServiceUnitTests = []struct {
 	// Inputs
 	config *daemon.DaemonConfig
 
+	// The output of 'systemctl --version', if it is expected to run
+	systemctlVersion string
+
 	// Expected values
 	expectedServiceUnitLines []string
 }{
@@ -122,6 +128,61 @@ var systemdCreateServiceUnitTests = []struct {
 			"ExecStart='/path/to/the/program with a space' '--my-option' 'an arg with double quotes \", single quotes \\', and spaces!'",
 		},
 	},
+	{
+		title: "Service unit includes environment, restart policy, logs, and limits",
+		config: &daemon.DaemonConfig{
+			Label:            "test-options",
+			Description:      "A configured program",
+			Program:          "/path/to/the/program",
+			Environment:      []string{"GIT_TRACE2_EVENT=/var/log/trace 100%.json", "QUOTED=\"hi\""},
+			WorkingDirectory: "/srv/bundles",
+			Restart:          &daemon.RestartPolicy{Delay: 2 * time.Second, MaxDelay: time.Minute},
+			StdOutPath:       "/var/log/out.log",
+			StdErrPath:       "/var/log/err.log",
+			MemoryLimit:      512 * 1024 * 1024,
+			CPUQuota:         50,
+		},
+		systemctlVersion: "systemd 255 (255.4-1ubuntu8)\n+PAM +AUDIT +SELINUX\n",
+		expectedServiceUnitLines: []string{
+			"[Unit]",
+			"Description=A configured program",
+			"StartLimitIntervalSec=0",
+			"[Service]",
+			"Type=simple",
+			"ExecStart='/path/to/the/program'",
+			"WorkingDirectory=/srv/bundles",
+			"Environment=\"GIT_TRACE2_EVENT=/var/log/trace 100%%.json\"",
+			"Environment=\"QUOTED=\\\"hi\\\"\"",
+			"Restart=on-failure",
+			"RestartSec=2000ms",
+			"RestartSteps=5",
+			"RestartMaxDelaySec=60000ms",
+			"StandardOutput=append:/var/log/out.log",
+			"StandardError=append:/var/log/err.log",
+			"MemoryMax=536870912",
+			"CPUQuota=50%",
+		},
+	},
+	{
+		title: "Service unit restarts with a fixed delay on systemd without backoff",
+		config: &daemon.DaemonConfig{
+			Label:       "test-old-systemd",
+			Description: "A restarted program",
+			Program:     "/path/to/the/program",
+			Restart:     &daemon.RestartPolicy{Delay: 2 * time.Second, MaxDelay: time.Minute},
+		},
+		systemctlVersion: "systemd 252 (252.22-1~deb12u1)\n+PAM +AUDIT +SELINUX\n",
+		expectedServiceUnitLines: []string{
+			"[Unit]",
+			"Description=A restarted program",
+			"StartLimitIntervalSec=0",
+			"[Service]",
+			"Type=simple",
+			"ExecStart='/path/to/the/program'",
+			"Restart=on-failure",
+			"RestartSec=2000ms",
+		},
+	},
 }
 
 func TestSystemd_Create(t *testing.T) {
@@ -192,6 +253,24 @@ func TestSystemd_Create(t *testing.T) {
 			var actualFileBytes []byte
 
 			// Mock responses for successful fresh write
+			if tt.systemctlVersion != "" {
+				var stdout io.Writer
+				testCommandExecutor.On("Run",
+					ctx,
+					"systemctl",
+					[]string{"--version"},
+					mock.MatchedBy(func(settings []cmd.Setting) bool {
+						for _, setting := range settings {
+							if setting.Key == cmd.StdoutKey {
+								stdout = setting.Value.(io.Writer)
+							}
+						}
+						return stdout != nil
+					}),
+				).Run(func(mock.Arguments) {
+					stdout.Write([]byte(tt.systemctlVersion))
+				}).Return(0, nil).Once()
+			}
 			testCommandExecutor.On("RunQuiet",
 				ctx,
 				"systemctl",
@@ -237,6 +316,84 @@ func TestSystemd_Create(t *testing.T) {
 	}
 }
 
+func TestSystemd_CreateSystem(t *testing.T) {
+	// Set up mocks
+	testLogger := &MockTraceLogger{}
+	testUserProvider := &MockUserProvider{}
+	testCommandExecutor := &MockCommandExecutor{}
+	testFileSystem := &MockFileSystem{}
+
+	ctx := context.Background()
+
+	systemd := daemon.NewSystemdSystemProvider(testLogger, testUserProvider, testCommandExecutor, testFileSystem)
+
+	config := &daemon.DaemonConfig{
+		Label:       "com.example.testdaemon",
+		Description: "Test service",
+		Program:     "/usr/local/bin/test/git-bundle-web-server",
+		User:        "git-bundle",
+		Group:       "git-bundle",
+	}
+
+	t.Run("System service unit is installed and enabled", func(t *testing.T) {
+		var actualFileBytes []byte
+
+		testUserProvider.On("CurrentUser").Return(&user.User{Uid: "0", Username: "root", HomeDir: "/root"}, nil).Once()
+		testFileSystem.On("FileExists",
+			"/etc/systemd/system/com.example.testdaemon.service",
+		).Return(false, nil).Once()
+		testFileSystem.On("WriteFile",
+			"/etc/systemd/system/com.example.testdaemon.service",
+			mock.MatchedBy(func(fileBytes any) bool {
+				actualFileBytes = fileBytes.([]byte)
+				return true
+			}),
+		).Return(nil).Once()
+		testCommandExecutor.On("RunQuiet",
+			ctx,
+			"systemctl",
+			[]string{"daemon-reload"},
+		).Return(0, nil).Once()
+		testCommandExecutor.On("RunQuiet",
+			ctx,
+			"systemctl",
+			[]string{"enable", "com.example.testdaemon.service"},
+		).Return(0, nil).Once()
+
+		err := systemd.Create(ctx, config, false)
+		assert.Nil(t, err)
+		mock.AssertExpectationsForObjects(t, testUserProvider, testCommandExecutor, testFileSystem)
+
+		fileContents := strings.TrimSpace(string(actualFileBytes))
+		serviceUnitLines := strings.Split(
+			regexp.MustCompile(`\n+`).ReplaceAllString(fileContents, "\n"), "\n")
+		assert.ElementsMatch(t, []string{
+			"[Unit]",
+			"Description=Test service",
+			"[Service]",
+			"Type=simple",
+			"ExecStart='/usr/local/bin/test/git-bundle-web-server'",
+			"User=git-bundle",
+			"Group=git-bundle",
+			"[Install]",
+			"WantedBy=multi-user.target",
+		}, serviceUnitLines)
+	})
+
+	// Reset the mock structure between tests
+	testUserProvider.Mock = mock.Mock{}
+	testCommandExecutor.Mock = mock.Mock{}
+	testFileSystem.Mock = mock.Mock{}
+
+	t.Run("Non-root user is rejected", func(t *testing.T) {
+		testUserProvider.On("CurrentUser").Return(&user.User{Uid: "123", Username: "testuser", HomeDir: "/my/test/dir"}, nil).Once()
+
+		err := systemd.Create(ctx, config, false)
+		assert.NotNil(t, err)
+		mock.AssertExpectationsForObjects(t, testUserProvider, testCommandExecutor, testFileSystem)
+	})
+}
+
 func TestSystemd_Start(t *testing.T) {
 	// Set up mocks
 	testLogger := &MockTraceLogger{}
@@ -435,3 +592,327 @@ func TestSystemd_Remove(t *testing.T) {
 		testFileSystem.Mock = mock.Mock{}
 	}
 }
+
+var systemdCreateTimerTests = []struct {
+	title string
+
+	// Inputs
+	schedule string
+	force    bool
+
+	// Mocked responses
+	fileExists bool
+
+	// Expected values
+	expectedOnCalendar string
+	expectWrite        bool
+}{
+	{
+		"Daily timer created",
+		"0 0 * * *",
+		false,
+		false,
+		"*-*-* 00:00:00",
+		true,
+	},
+	{
+		"Lists, ranges, and weekdays are converted",
+		"*/20 9,17 * * 1-3",
+		false,
+		false,
+		"Mon,Tue,Wed *-*-* 09,17:00,20,40:00",
+		true,
+	},
+	{
+		"Existing timer not rewritten",
+		"0 0 * * *",
+		false,
+		true,
+		"",
+		false,
+	},
+	{
+		"'force' option rewrites existing timer",
+		"0 3 1 * *",
+		true,
+		true,
+		"*-*-01 03:00:00",
+		true,
+	},
+}
+
+func TestSystemd_CreateTimer(t *testing.T) {
+	// Set up mocks
+	testLogger := &MockTraceLogger{}
+	testUser := &user.User{
+		Uid:      "123",
+		Username: "testuser",
+		HomeDir:  "/my/test/dir",
+	}
+	testUserProvider := &MockUserProvider{}
+	testUserProvider.On("CurrentUser").Return(testUser, nil)
+
+	testCommandExecutor := &MockCommandExecutor{}
+	testFileSystem := &MockFileSystem{}
+
+	ctx := context.Background()
+
+	systemd := daemon.NewSystemdProvider(testLogger, testUserProvider, testCommandExecutor, testFileSystem)
+
+	for _, tt := range systemdCreateTimerTests {
+		t.Run(tt.title, func(t *testing.T) {
+			serviceFilename := filepath.Clean(fmt.Sprintf("/my/test/dir/.config/systemd/user/%s.service", basicDaemonConfig.Label))
+			timerFilename := filepath.Clean(fmt.Sprintf("/my/test/dir/.config/systemd/user/%s.timer", basicDaemonConfig.Label))
+			var serviceBytes, timerBytes []byte
+
+			// Mock responses
+			testFileSystem.On("FileExists", timerFilename).Return(tt.fileExists, nil).Once()
+			if tt.expectWrite {
+				testFileSystem.On("WriteFile",
+					serviceFilename,
+					mock.MatchedBy(func(fileBytes []byte) bool {
+						serviceBytes = fileBytes
+						return true
+					}),
+				).Return(nil).Once()
+				testFileSystem.On("WriteFile",
+					timerFilename,
+					mock.MatchedBy(func(fileBytes []byte) bool {
+						timerBytes = fileBytes
+						return true
+					}),
+				).Return(nil).Once()
+				testCommandExecutor.On("RunQuiet",
+					ctx,
+					"systemctl",
+					[]string{"--user", "daemon-reload"},
+				).Return(0, nil).Once()
+				testCommandExecutor.On("RunQuiet",
+					ctx,
+					"systemctl",
+					[]string{"--user", "enable", "--now", basicDaemonConfig.Label + ".timer"},
+				).Return(0, nil).Once()
+			}
+
+			schedule, err := daemon.ParseCalendarSchedule(tt.schedule)
+			assert.Nil(t, err)
+
+			// Run "CreateTimer"
+			err = systemd.CreateTimer(ctx, &basicDaemonConfig, schedule, tt.force)
+			assert.Nil(t, err)
+			mock.AssertExpectationsForObjects(t, testCommandExecutor, testFileSystem)
+
+			if tt.expectWrite {
+				assert.Contains(t, string(serviceBytes), "Type=oneshot\n")
+				assert.Contains(t, string(serviceBytes), fmt.Sprintf("ExecStart='%s'\n", basicDaemonConfig.Program))
+				assert.Contains(t, string(timerBytes), fmt.Sprintf("OnCalendar=%s\n", tt.expectedOnCalendar))
+				assert.Contains(t, string(timerBytes), "WantedBy=timers.target\n")
+			}
+
+			// Reset mocks
+			testCommandExecutor.Mock = mock.Mock{}
+			testFileSystem.Mock = mock.Mock{}
+		})
+	}
+}
+
+func TestSystemd_RemoveTimer(t *testing.T) {
+	// Set up mocks
+	testLogger := &MockTraceLogger{}
+	testUser := &user.User{
+		Uid:      "123",
+		Username: "testuser",
+		HomeDir:  "/my/test/dir",
+	}
+	testUserProvider := &MockUserProvider{}
+	testUserProvider.On("CurrentUser").Return(testUser, nil)
+
+	testCommandExecutor := &MockCommandExecutor{}
+	testFileSystem := &MockFileSystem{}
+
+	ctx := context.Background()
+
+	systemd := daemon.NewSystemdProvider(testLogger, testUserProvider, testCommandExecutor, testFileSystem)
+
+	t.Run("Disables timer and deletes units", func(t *testing.T) {
+		testCommandExecutor.On("RunQuiet",
+			ctx,
+			"systemctl",
+			[]string{"--user", "disable", "--now", "com.test.service.timer"},
+		).Return(daemon.SystemdUnitNotInstalledErrorCode, nil).Once()
+		testFileSystem.On("DeleteFile", "/my/test/dir/.config/systemd/user/com.test.service.timer").Return(true, nil).Once()
+		testFileSystem.On("DeleteFile", "/my/test/dir/.config/systemd/user/com.test.service.service").Return(true, nil).Once()
+		testCommandExecutor.On("RunQuiet",
+			ctx,
+			"systemctl",
+			[]string{"--user", "daemon-reload"},
+		).Return(0, nil).Once()
+
+		err := systemd.RemoveTimer(ctx, "com.test.service")
+		assert.Nil(t, err)
+		mock.AssertExpectationsForObjects(t, testCommandExecutor, testFileSystem)
+	})
+}
+
+var systemdStatusTests = []struct {
+	title string
+
+	// Mocked responses
+	systemctlShow string
+	unitLines     []string
+
+	// Expected values
+	expectedStatus *daemon.DaemonStatus
+}{
+	{
+		"Running service",
+		"LoadState=loaded\nActiveState=active\nMainPID=1234\nExecMainStatus=0\nExecMainExitTimestampMonotonic=0\n",
+		[]string{
+			"[Service]",
+			"Type=simple",
+			"ExecStart='/usr/bin/git-bundle-web-server' '--port' '8080' '--cert' '/path/with \\'quote\\''",
+			"StandardError=append:/var/log/100%%.log",
+		},
+		&daemon.DaemonStatus{
+			Loaded:     true,
+			Running:    true,
+			PID:        1234,
+			ConfigFile: "/my/test/dir/.config/systemd/user/com.test.service.service",
+			Config: &daemon.DaemonConfig{
+				Label:      "com.test.service",
+				Program:    "/usr/bin/git-bundle-web-server",
+				Arguments:  []string{"--port", "8080", "--cert", "/path/with 'quote'"},
+				StdErrPath: "/var/log/100%.log",
+			},
+		},
+	},
+	{
+		"Failed service",
+		"LoadState=loaded\nActiveState=failed\nMainPID=0\nExecMainStatus=1\nExecMainExitTimestampMonotonic=123456\n",
+		[]string{
+			"ExecStart='/usr/bin/git-bundle-web-server'",
+		},
+		&daemon.DaemonStatus{
+			Loaded:       true,
+			LastExitCode: PtrTo(1),
+			ConfigFile:   "/my/test/dir/.config/systemd/user/com.test.service.service",
+			Config: &daemon.DaemonConfig{
+				Label:     "com.test.service",
+				Program:   "/usr/bin/git-bundle-web-server",
+				Arguments: []string{},
+			},
+		},
+	},
+	{
+		"Service not installed",
+		"LoadState=not-found\nActiveState=inactive\nMainPID=0\nExecMainStatus=0\nExecMainExitTimestampMonotonic=0\n",
+		[]string{},
+		&daemon.DaemonStatus{},
+	},
+}
+
+func TestSystemd_Status(t *testing.T) {
+	// Set up mocks
+	testLogger := &MockTraceLogger{}
+	testUser := &user.User{
+		Uid:      "123",
+		Username: "testuser",
+		HomeDir:  "/my/test/dir",
+	}
+	testUserProvider := &MockUserProvider{}
+	testUserProvider.On("CurrentUser").Return(testUser, nil)
+
+	testCommandExecutor := &MockCommandExecutor{}
+	testFileSystem := &MockFileSystem{}
+
+	ctx := context.Background()
+
+	systemd := daemon.NewSystemdProvider(testLogger, testUserProvider, testCommandExecutor, testFileSystem)
+
+	for _, tt := range systemdStatusTests {
+		t.Run(tt.title, func(t *testing.T) {
+			var stdout io.Writer
+			testCommandExecutor.On("Run",
+				ctx,
+				"systemctl",
+				mock.MatchedBy(func(args []string) bool { return args[1] == "show" }),
+				mock.MatchedBy(func(settings []cmd.Setting) bool {
+					for _, setting := range settings {
+						if setting.Key == cmd.StdoutKey {
+							stdout = setting.Value.(io.Writer)
+						}
+					}
+					return stdout != nil
+				}),
+			).Run(func(mock.Arguments) {
+				stdout.Write([]byte(tt.systemctlShow))
+			}).Return(0, nil).Once()
+			testFileSystem.On("ReadFileLines",
+				"/my/test/dir/.config/systemd/user/com.test.service.service",
+			).Return(tt.unitLines, nil).Once()
+
+			status, err := systemd.Status(ctx, "com.test.service")
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expectedStatus, status)
+			mock.AssertExpectationsForObjects(t, testCommandExecutor, testFileSystem)
+
+			// Reset mocks
+			testCommandExecutor.Mock = mock.Mock{}
+			testFileSystem.Mock = mock.Mock{}
+		})
+	}
+}
+
+func TestSystemd_Logs(t *testing.T) {
+	// Set up mocks
+	testLogger := &MockTraceLogger{}
+	testUser := &user.User{
+		Uid:      "123",
+		Username: "testuser",
+		HomeDir:  "/my/test/dir",
+	}
+	testUserProvider := &MockUserProvider{}
+	testUserProvider.On("CurrentUser").Return(testUser, nil)
+
+	testCommandExecutor := &MockCommandExecutor{}
+	testFileSystem := &MockFileSystem{}
+
+	ctx := context.Background()
+
+	systemd := daemon.NewSystemdProvider(testLogger, testUserProvider, testCommandExecutor, testFileSystem)
+	unitFile := "/my/test/dir/.config/systemd/user/com.test.service.service"
+
+	t.Run("Reads journal if output isn't logged to a file", func(t *testing.T) {
+		testFileSystem.On("ReadFileLines", unitFile).Return([]string{"ExecStart='/usr/bin/test'"}, nil).Once()
+		testCommandExecutor.On("RunStdout",
+			ctx,
+			"journalctl",
+			[]string{"--user", "--unit", "com.test.service.service", "--lines", "20", "--follow"},
+		).Return(0, nil).Once()
+
+		err := systemd.Logs(ctx, "com.test.service", 20, true)
+		assert.Nil(t, err)
+		mock.AssertExpectationsForObjects(t, testCommandExecutor, testFileSystem)
+	})
+
+	// Reset mocks
+	testCommandExecutor.Mock = mock.Mock{}
+	testFileSystem.Mock = mock.Mock{}
+
+	t.Run("Tails log files", func(t *testing.T) {
+		testFileSystem.On("ReadFileLines", unitFile).Return([]string{
+			"ExecStart='/usr/bin/test'",
+			"StandardOutput=append:/var/log/test.log",
+			"StandardError=append:/var/log/test.log",
+		}, nil).Once()
+		testCommandExecutor.On("RunStdout",
+			ctx,
+			"tail",
+			[]string{"-n", "20", "/var/log/test.log"},
+		).Return(0, nil).Once()
+
+		err := systemd.Logs(ctx, "com.test.service", 20, false)
+		assert.Nil(t, err)
+		mock.AssertExpectationsForObjects(t, testCommandExecutor, testFileSystem)
+	})
+}
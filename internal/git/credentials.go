@@ -0,0 +1,188 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// The username sent with a token if none is configured. Most Git hosts accept
+// any username with a token.
+const DefaultTokenUsername string = "x-access-token"
+
+// The environment variables through which a token is passed to the credential
+// helper configured by 'RemoteCredentials'.
+const (
+	tokenUsernameEnv string = "GIT_BUNDLE_SERVER_USERNAME"
+	tokenPasswordEnv string = "GIT_BUNDLE_SERVER_TOKEN"
+)
+
+// A credential helper answering Git's requests for credentials with the
+// username and token in the environment. The secrets are expanded by the shell
+// running the helper, so they are not part of the helper's config value.
+var tokenCredentialHelper = fmt.Sprintf(
+	`!f() { test "$1" = get && printf 'username=%%s\npassword=%%s\n' "$%s" "$%s"; }; f`,
+	tokenUsernameEnv, tokenPasswordEnv)
+
+var envNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// RemoteCredentials configures how Git authenticates to the remote of a
+// repository when cloning or fetching it, rather than relying on the
+// credentials available to the user running the command (e.g. an SSH agent or
+// a credential helper in the user's Git config), which are often unavailable
+// to scheduled updates.
+//
+// The credentials are passed to Git through its environment when it runs:
+// they are never written to the repository's Git config, nor to trace2 logs
+// (which include the arguments of Git, but not its environment). Secrets are
+// read from their files or environment variables each time, so they can be
+// rotated without updating the route.
+type RemoteCredentials struct {
+	// The path to the private key used to authenticate to SSH remotes.
+	SSHKeyFile string `json:",omitempty"`
+
+	// The path to a file containing a token, sent as the password to HTTP(S)
+	// remotes.
+	TokenFile string `json:",omitempty"`
+
+	// The name of an environment variable containing a token, sent as the
+	// password to HTTP(S) remotes.
+	TokenEnv string `json:",omitempty"`
+
+	// The username sent with the token. If empty, 'DefaultTokenUsername' is
+	// used.
+	TokenUsername string `json:",omitempty"`
+
+	// A Git credential helper (in the format of the 'credential.helper' Git
+	// config) providing the credentials of HTTP(S) remotes. The helpers of the
+	// user's Git config are not used.
+	CredentialHelper string `json:",omitempty"`
+}
+
+// Validate returns an error if the credentials are inconsistent.
+func (c *RemoteCredentials) Validate() error {
+	httpSources := 0
+	for _, source := range []string{c.TokenFile, c.TokenEnv, c.CredentialHelper} {
+		if source != "" {
+			httpSources++
+		}
+	}
+	if httpSources > 1 {
+		return fmt.Errorf("at most one of a token file, a token environment variable, and a credential helper may be configured")
+	}
+	if c.TokenEnv != "" && !envNameRegex.MatchString(c.TokenEnv) {
+		return fmt.Errorf("invalid environment variable name '%s'", c.TokenEnv)
+	}
+	if c.TokenUsername != "" && c.TokenFile == "" && c.TokenEnv == "" {
+		return fmt.Errorf("a token username requires a token file or environment variable")
+	}
+	if strings.ContainsAny(c.TokenUsername, "\n\x00") {
+		return fmt.Errorf("invalid token username '%s'", c.TokenUsername)
+	}
+	return nil
+}
+
+// IsEmpty returns whether no credentials are configured.
+func (c *RemoteCredentials) IsEmpty() bool {
+	return c == nil || *c == RemoteCredentials{}
+}
+
+// String describes the configured credentials, without revealing secrets.
+func (c *RemoteCredentials) String() string {
+	if c.IsEmpty() {
+		return "none"
+	}
+
+	descriptions := []string{}
+	if c.SSHKeyFile != "" {
+		descriptions = append(descriptions, "SSH key "+c.SSHKeyFile)
+	}
+	if c.TokenFile != "" {
+		descriptions = append(descriptions, "token file "+c.TokenFile)
+	}
+	if c.TokenEnv != "" {
+		descriptions = append(descriptions, "token from $"+c.TokenEnv)
+	}
+	if c.CredentialHelper != "" {
+		descriptions = append(descriptions, "credential helper '"+c.CredentialHelper+"'")
+	}
+	return strings.Join(descriptions, ", ")
+}
+
+func (c *RemoteCredentials) token() (string, error) {
+	var token string
+	if c.TokenFile != "" {
+		tokenBytes, err := os.ReadFile(c.TokenFile)
+		if err != nil {
+			return "", fmt.Errorf("could not read token file: %w", err)
+		}
+		token = strings.TrimSpace(string(tokenBytes))
+		if token == "" {
+			return "", fmt.Errorf("token file '%s' is empty", c.TokenFile)
+		}
+	} else {
+		token = os.Getenv(c.TokenEnv)
+		if token == "" {
+			return "", fmt.Errorf("environment variable '%s' is not set", c.TokenEnv)
+		}
+	}
+
+	// Git's credential protocol is line-based
+	if strings.ContainsAny(token, "\n\x00") {
+		return "", fmt.Errorf("token contains a newline or NUL character")
+	}
+	return token, nil
+}
+
+// shellQuote quotes a string for use as a single word in a shell command.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// gitConfigEnv returns the environment variables setting the given Git config
+// values for a single command (see 'GIT_CONFIG_COUNT' in git-config(1)).
+func gitConfigEnv(keyValues ...string) []string {
+	env := []string{fmt.Sprintf("GIT_CONFIG_COUNT=%d", len(keyValues)/2)}
+	for i := 0; i < len(keyValues); i += 2 {
+		env = append(env,
+			fmt.Sprintf("GIT_CONFIG_KEY_%d=%s", i/2, keyValues[i]),
+			fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", i/2, keyValues[i+1]),
+		)
+	}
+	return env
+}
+
+// gitEnv returns the environment variables making Git use the credentials.
+func (c *RemoteCredentials) gitEnv() ([]string, error) {
+	if c.IsEmpty() {
+		return []string{}, nil
+	}
+
+	// Fail rather than wait for input that can't come
+	env := []string{"GIT_TERMINAL_PROMPT=0"}
+
+	if c.SSHKeyFile != "" {
+		env = append(env, "GIT_SSH_COMMAND=ssh -i "+shellQuote(c.SSHKeyFile)+
+			" -o IdentitiesOnly=yes -o BatchMode=yes")
+	}
+
+	// An empty 'credential.helper' discards the previously configured helpers
+	switch {
+	case c.TokenFile != "" || c.TokenEnv != "":
+		token, err := c.token()
+		if err != nil {
+			return nil, err
+		}
+		username := c.TokenUsername
+		if username == "" {
+			username = DefaultTokenUsername
+		}
+		env = append(env, gitConfigEnv("credential.helper", "", "credential.helper", tokenCredentialHelper)...)
+		env = append(env, tokenUsernameEnv+"="+username, tokenPasswordEnv+"="+token)
+	case c.CredentialHelper != "":
+		env = append(env, gitConfigEnv("credential.helper", "", "credential.helper", c.CredentialHelper)...)
+	}
+
+	return env, nil
+}
@@ -3,6 +3,7 @@ package git
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -11,32 +12,80 @@ import (
 	"github.com/git-ecosystem/git-bundle-server/internal/log"
 )
 
+// ErrBundleFilterUnsupported indicates that the installed version of Git cannot
+// create bundles with an object filter.
+var ErrBundleFilterUnsupported = errors.New("the installed version of Git does not support filtered bundles")
+
+// The functions contacting the remote of a repository take the credentials with
+// which to authenticate to it, if any (see 'RemoteCredentials').
+//
+// The bundle creation functions below take an object 'filter' (e.g.
+// 'blob:none'), which is applied to the created bundle if non-empty.
 type GitHelper interface {
-	CreateBundle(ctx context.Context, repoDir string, filename string) (bool, error)
-	CreateBundleFromRefs(ctx context.Context, repoDir string, filename string, refs map[string]string) error
-	CreateIncrementalBundle(ctx context.Context, repoDir string, filename string, prereqs []string) (bool, error)
-	CloneBareRepo(ctx context.Context, url string, destination string) error
-	UpdateBareRepo(ctx context.Context, repoDir string) error
+	CreateBundle(ctx context.Context, repoDir string, filename string, filter string) (bool, error)
+	CreateBundleFromRefs(ctx context.Context, repoDir string, filename string, refs map[string]string, filter string) error
+	CreateIncrementalBundle(ctx context.Context, repoDir string, filename string, prereqs []string, filter string) (bool, error)
+	CloneBareRepo(ctx context.Context, url string, destination string, credentials *RemoteCredentials) error
+	UpdateBareRepo(ctx context.Context, repoDir string, credentials *RemoteCredentials) error
 	GetRemoteUrl(ctx context.Context, repoDir string) (string, error)
 }
 
+// RefSelection is the set of refs included in bundles, as the 'git bundle
+// create' (rev-list) options selecting them.
+type RefSelection []string
+
+// DefaultRefSelection includes only the repository's branches in bundles.
+var DefaultRefSelection = RefSelection{"--branches"}
+
+// ParseRefSelection parses a comma-separated list of the kinds of refs to
+// include in bundles ('branches' and/or 'tags'), e.g. 'branches,tags'.
+func ParseRefSelection(value string) (RefSelection, error) {
+	refs := RefSelection{}
+	seen := map[string]bool{}
+	for _, kind := range strings.Split(value, ",") {
+		kind = strings.TrimSpace(kind)
+		if seen[kind] {
+			continue
+		}
+		seen[kind] = true
+
+		switch kind {
+		case "branches", "tags":
+			refs = append(refs, "--"+kind)
+		default:
+			return nil, fmt.Errorf("invalid ref selection '%s': expected 'branches' and/or 'tags'", value)
+		}
+	}
+	return refs, nil
+}
+
 type gitHelper struct {
 	logger  log.TraceLogger
 	cmdExec cmd.CommandExecutor
+	refs    RefSelection
 }
 
-func NewGitHelper(l log.TraceLogger, c cmd.CommandExecutor) GitHelper {
+// NewGitHelper creates a GitHelper whose bundles contain the refs selected by
+// 'refs' (see 'DefaultRefSelection').
+func NewGitHelper(l log.TraceLogger, c cmd.CommandExecutor, refs RefSelection) GitHelper {
 	return &gitHelper{
 		logger:  l,
 		cmdExec: c,
+		refs:    refs,
 	}
 }
 
 func (g *gitHelper) gitCommand(ctx context.Context, args ...string) error {
+	return g.gitCommandWithEnv(ctx, []string{}, args...)
+}
+
+// gitCommandWithEnv is like gitCommand, adding the variables of 'env' to the
+// environment of 'git'.
+func (g *gitHelper) gitCommandWithEnv(ctx context.Context, env []string, args ...string) error {
 	exitCode, err := g.cmdExec.Run(ctx, "git", args,
 		cmd.Stdout(os.Stdout),
 		cmd.Stderr(os.Stderr),
-		cmd.Env([]string{"LC_CTYPE=C"}),
+		cmd.Env(append([]string{"LC_CTYPE=C"}, env...)),
 	)
 
 	if err != nil {
@@ -90,21 +139,50 @@ func (g *gitHelper) gitCommandWithStdin(ctx context.Context, stdinLines []string
 	return nil
 }
 
-func (g *gitHelper) CreateBundle(ctx context.Context, repoDir string, filename string) (bool, error) {
-	err := g.gitCommand(ctx,
-		"-C", repoDir, "bundle", "create",
-		filename, "--branches")
+// filterArgs returns the 'git bundle create' arguments needed to apply the given
+// object filter. The filter is a rev-list option, so it must come after the
+// bundle filename.
+func filterArgs(filter string) []string {
+	if filter == "" {
+		return []string{}
+	}
+	return []string{"--filter=" + filter}
+}
+
+// checkFilterSupport translates a 'git bundle create' error caused by an
+// unrecognized '--filter' option into ErrBundleFilterUnsupported.
+func checkFilterSupport(filter string, err error) error {
+	if filter != "" &&
+		(strings.Contains(err.Error(), "unrecognized argument: --filter") ||
+			strings.Contains(err.Error(), "unknown option `filter")) {
+		return fmt.Errorf("cannot create bundle with filter '%s': %w", filter, ErrBundleFilterUnsupported)
+	}
+	return err
+}
+
+func (g *gitHelper) CreateBundle(ctx context.Context, repoDir string, filename string, filter string) (bool, error) {
+	args := []string{"-C", repoDir, "bundle", "create", filename}
+	args = append(args, filterArgs(filter)...)
+	args = append(args, g.refs...)
+
+	var err error
+	if filter == "" {
+		err = g.gitCommand(ctx, args...)
+	} else {
+		// Capture stderr so we can detect a lack of support for filters
+		err = g.gitCommandWithStdin(ctx, []string{}, args...)
+	}
 	if err != nil {
 		if strings.Contains(err.Error(), "Refusing to create empty bundle") {
 			return false, nil
 		}
-		return false, err
+		return false, checkFilterSupport(filter, err)
 	}
 
 	return true, nil
 }
 
-func (g *gitHelper) CreateBundleFromRefs(ctx context.Context, repoDir string, filename string, refs map[string]string) error {
+func (g *gitHelper) CreateBundleFromRefs(ctx context.Context, repoDir string, filename string, refs map[string]string, filter string) error {
 	refNames := []string{}
 
 	for ref, oid := range refs {
@@ -116,33 +194,42 @@ func (g *gitHelper) CreateBundleFromRefs(ctx context.Context, repoDir string, fi
 		refNames = append(refNames, ref)
 	}
 
-	err := g.gitCommandWithStdin(ctx,
-		refNames,
-		"-C", repoDir, "bundle", "create",
-		filename, "--stdin")
+	args := []string{"-C", repoDir, "bundle", "create", filename}
+	args = append(args, filterArgs(filter)...)
+	args = append(args, "--stdin")
+
+	err := g.gitCommandWithStdin(ctx, refNames, args...)
 	if err != nil {
-		return err
+		return checkFilterSupport(filter, err)
 	}
 
 	return nil
 }
 
-func (g *gitHelper) CreateIncrementalBundle(ctx context.Context, repoDir string, filename string, prereqs []string) (bool, error) {
-	err := g.gitCommandWithStdin(ctx,
-		prereqs, "-C", repoDir, "bundle", "create",
-		filename, "--stdin", "--branches")
+func (g *gitHelper) CreateIncrementalBundle(ctx context.Context, repoDir string, filename string, prereqs []string, filter string) (bool, error) {
+	args := []string{"-C", repoDir, "bundle", "create", filename}
+	args = append(args, filterArgs(filter)...)
+	args = append(args, "--stdin")
+	args = append(args, g.refs...)
+
+	err := g.gitCommandWithStdin(ctx, prereqs, args...)
 	if err != nil {
 		if strings.Contains(err.Error(), "Refusing to create empty bundle") {
 			return false, nil
 		}
-		return false, err
+		return false, checkFilterSupport(filter, err)
 	}
 
 	return true, nil
 }
 
-func (g *gitHelper) CloneBareRepo(ctx context.Context, url string, destination string) error {
-	gitErr := g.gitCommand(ctx, "clone", "--bare", url, destination)
+func (g *gitHelper) CloneBareRepo(ctx context.Context, url string, destination string, credentials *RemoteCredentials) error {
+	credentialEnv, err := credentials.gitEnv()
+	if err != nil {
+		return g.logger.Errorf(ctx, "failed to load remote credentials: %w", err)
+	}
+
+	gitErr := g.gitCommandWithEnv(ctx, credentialEnv, "clone", "--bare", url, destination)
 
 	if gitErr != nil {
 		return g.logger.Errorf(ctx, "failed to clone repository: %w", gitErr)
@@ -153,7 +240,7 @@ func (g *gitHelper) CloneBareRepo(ctx context.Context, url string, destination s
 		return g.logger.Errorf(ctx, "failed to configure refspec: %w", gitErr)
 	}
 
-	gitErr = g.gitCommand(ctx, "-C", destination, "fetch", "origin")
+	gitErr = g.gitCommandWithEnv(ctx, credentialEnv, "-C", destination, "fetch", "origin")
 	if gitErr != nil {
 		return g.logger.Errorf(ctx, "failed to fetch latest refs: %w", gitErr)
 	}
@@ -161,8 +248,13 @@ func (g *gitHelper) CloneBareRepo(ctx context.Context, url string, destination s
 	return nil
 }
 
-func (g *gitHelper) UpdateBareRepo(ctx context.Context, repoDir string) error {
-	gitErr := g.gitCommand(ctx, "-C", repoDir, "fetch", "origin")
+func (g *gitHelper) UpdateBareRepo(ctx context.Context, repoDir string, credentials *RemoteCredentials) error {
+	credentialEnv, err := credentials.gitEnv()
+	if err != nil {
+		return g.logger.Errorf(ctx, "failed to load remote credentials: %w", err)
+	}
+
+	gitErr := g.gitCommandWithEnv(ctx, credentialEnv, "-C", repoDir, "fetch", "origin")
 	if gitErr != nil {
 		return g.logger.Errorf(ctx, "failed to fetch latest refs: %w", gitErr)
 	}
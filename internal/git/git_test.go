@@ -19,6 +19,7 @@ var createIncrementalBundleTests = []struct {
 	repoDir  string
 	filename string
 	prereqs  []string
+	filter   string
 
 	// Mocked responses
 	bundleCreate       Pair[int, error]
@@ -34,6 +35,7 @@ var createIncrementalBundleTests = []struct {
 		"/test/home/git-bundle-server/git/test/myrepo/",
 		"/test/home/git-bundle-server/www/test/myrepo/bundle-1234.bundle",
 		[]string{"^018d4b8a"},
+		"",
 
 		NewPair[int, error](0, nil),
 		"",
@@ -47,6 +49,7 @@ var createIncrementalBundleTests = []struct {
 		"/test/home/git-bundle-server/git/test/myrepo/",
 		"/test/home/git-bundle-server/www/test/myrepo/bundle-5678.bundle",
 		[]string{"^0793b0ce", "^3649daa0"},
+		"",
 
 		NewPair[int, error](128, nil),
 		"fatal: Refusing to create empty bundle",
@@ -54,6 +57,34 @@ var createIncrementalBundleTests = []struct {
 		false,
 		false,
 	},
+	{
+		"Successful filtered bundle creation",
+
+		"/test/home/git-bundle-server/git/test/myrepo/",
+		"/test/home/git-bundle-server/www/test/myrepo/bundle-blob-none-1234.bundle",
+		[]string{"^018d4b8a"},
+		"blob:none",
+
+		NewPair[int, error](0, nil),
+		"",
+
+		true,
+		false,
+	},
+	{
+		"Filter unsupported by Git",
+
+		"/test/home/git-bundle-server/git/test/myrepo/",
+		"/test/home/git-bundle-server/www/test/myrepo/bundle-blob-none-1234.bundle",
+		[]string{"^018d4b8a"},
+		"blob:none",
+
+		NewPair[int, error](128, nil),
+		"fatal: unrecognized argument: --filter=blob:none",
+
+		false,
+		true,
+	},
 }
 
 func TestGit_CreateIncrementalBundle(t *testing.T) {
@@ -61,18 +92,24 @@ func TestGit_CreateIncrementalBundle(t *testing.T) {
 	testLogger := &MockTraceLogger{}
 	testCommandExecutor := &MockCommandExecutor{}
 
-	gitHelper := git.NewGitHelper(testLogger, testCommandExecutor)
+	gitHelper := git.NewGitHelper(testLogger, testCommandExecutor, git.DefaultRefSelection)
 
 	for _, tt := range createIncrementalBundleTests {
 		t.Run(tt.title, func(t *testing.T) {
 			var stdin io.Reader
 			var stdout io.Writer
 
+			expectedArgs := []string{"-C", tt.repoDir, "bundle", "create", tt.filename}
+			if tt.filter != "" {
+				expectedArgs = append(expectedArgs, "--filter="+tt.filter)
+			}
+			expectedArgs = append(expectedArgs, "--stdin", "--branches")
+
 			// Mock responses
 			testCommandExecutor.On("Run",
 				mock.Anything,
 				"git",
-				[]string{"-C", tt.repoDir, "bundle", "create", tt.filename, "--stdin", "--branches"},
+				expectedArgs,
 				mock.MatchedBy(func(settings []cmd.Setting) bool {
 					var ok bool
 					stdin = nil
@@ -98,7 +135,7 @@ func TestGit_CreateIncrementalBundle(t *testing.T) {
 			}).Return(tt.bundleCreate.First, tt.bundleCreate.Second)
 
 			// Run 'CreateIncrementalBundle()'
-			actualBundleCreated, err := gitHelper.CreateIncrementalBundle(context.Background(), tt.repoDir, tt.filename, tt.prereqs)
+			actualBundleCreated, err := gitHelper.CreateIncrementalBundle(context.Background(), tt.repoDir, tt.filename, tt.prereqs, tt.filter)
 
 			// Assert on expected values
 			assert.Equal(t, tt.expectedBundleCreated, actualBundleCreated)
@@ -123,3 +160,171 @@ func TestGit_CreateIncrementalBundle(t *testing.T) {
 		})
 	}
 }
+
+var parseRefSelectionTests = []struct {
+	title    string
+	value    string
+	expected git.RefSelection
+	isError  bool
+}{
+	{"Branches", "branches", git.RefSelection{"--branches"}, false},
+	{"Tags", "tags", git.RefSelection{"--tags"}, false},
+	{"Branches and tags", "branches, tags", git.RefSelection{"--branches", "--tags"}, false},
+	{"Duplicates are ignored", "tags,tags", git.RefSelection{"--tags"}, false},
+	{"Unknown ref kind", "remotes", nil, true},
+	{"Empty value", "", nil, true},
+}
+
+func TestGit_ParseRefSelection(t *testing.T) {
+	for _, tt := range parseRefSelectionTests {
+		t.Run(tt.title, func(t *testing.T) {
+			refs, err := git.ParseRefSelection(tt.value)
+			if tt.isError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expected, refs)
+			}
+		})
+	}
+}
+
+var updateBareRepoTests = []struct {
+	title string
+
+	// Inputs
+	credentials *git.RemoteCredentials
+	tokenEnv    map[string]string
+
+	// Expected values
+	expectedEnv []string
+	expectErr   bool
+}{
+	{
+		"No credentials",
+		nil,
+		nil,
+		[]string{"LC_CTYPE=C"},
+		false,
+	},
+	{
+		"SSH key",
+		&git.RemoteCredentials{SSHKeyFile: "/home/me/.ssh/bundle's key"},
+		nil,
+		[]string{
+			"LC_CTYPE=C",
+			"GIT_TERMINAL_PROMPT=0",
+			`GIT_SSH_COMMAND=ssh -i '/home/me/.ssh/bundle'\''s key' -o IdentitiesOnly=yes -o BatchMode=yes`,
+		},
+		false,
+	},
+	{
+		"Token from environment",
+		&git.RemoteCredentials{TokenEnv: "TEST_REMOTE_TOKEN", TokenUsername: "bot"},
+		map[string]string{"TEST_REMOTE_TOKEN": "s3cret"},
+		[]string{
+			"LC_CTYPE=C",
+			"GIT_TERMINAL_PROMPT=0",
+			"GIT_CONFIG_COUNT=2",
+			"GIT_CONFIG_KEY_0=credential.helper",
+			"GIT_CONFIG_VALUE_0=",
+			"GIT_CONFIG_KEY_1=credential.helper",
+			`GIT_CONFIG_VALUE_1=!f() { test "$1" = get && printf 'username=%s\npassword=%s\n' "$GIT_BUNDLE_SERVER_USERNAME" "$GIT_BUNDLE_SERVER_TOKEN"; }; f`,
+			"GIT_BUNDLE_SERVER_USERNAME=bot",
+			"GIT_BUNDLE_SERVER_TOKEN=s3cret",
+		},
+		false,
+	},
+	{
+		"Credential helper",
+		&git.RemoteCredentials{CredentialHelper: "store --file /etc/bundle-server/credentials"},
+		nil,
+		[]string{
+			"LC_CTYPE=C",
+			"GIT_TERMINAL_PROMPT=0",
+			"GIT_CONFIG_COUNT=2",
+			"GIT_CONFIG_KEY_0=credential.helper",
+			"GIT_CONFIG_VALUE_0=",
+			"GIT_CONFIG_KEY_1=credential.helper",
+			"GIT_CONFIG_VALUE_1=store --file /etc/bundle-server/credentials",
+		},
+		false,
+	},
+	{
+		"Missing token",
+		&git.RemoteCredentials{TokenEnv: "TEST_REMOTE_TOKEN"},
+		map[string]string{"TEST_REMOTE_TOKEN": ""},
+		nil,
+		true,
+	},
+}
+
+func TestGit_UpdateBareRepo(t *testing.T) {
+	// Set up mocks
+	testLogger := &MockTraceLogger{}
+	testCommandExecutor := &MockCommandExecutor{}
+
+	gitHelper := git.NewGitHelper(testLogger, testCommandExecutor, git.DefaultRefSelection)
+
+	repoDir := "/test/home/git-bundle-server/git/test/myrepo/"
+	for _, tt := range updateBareRepoTests {
+		t.Run(tt.title, func(t *testing.T) {
+			for key, value := range tt.tokenEnv {
+				t.Setenv(key, value)
+			}
+
+			var actualEnv []string
+			testCommandExecutor.On("Run",
+				mock.Anything,
+				"git",
+				// Credentials must not be passed as arguments, which are
+				// traced
+				[]string{"-C", repoDir, "fetch", "origin"},
+				mock.Anything,
+			).Run(func(args mock.Arguments) {
+				for _, setting := range args.Get(3).([]cmd.Setting) {
+					if setting.Key == cmd.EnvKey {
+						actualEnv = setting.Value.([]string)
+					}
+				}
+			}).Return(0, nil)
+
+			err := gitHelper.UpdateBareRepo(context.Background(), repoDir, tt.credentials)
+
+			if tt.expectErr {
+				assert.Error(t, err)
+				testCommandExecutor.AssertNotCalled(t, "Run")
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedEnv, actualEnv)
+			}
+
+			// Reset mocks
+			testCommandExecutor.Mock = mock.Mock{}
+		})
+	}
+}
+
+var remoteCredentialsValidateTests = []struct {
+	title       string
+	credentials git.RemoteCredentials
+	isError     bool
+}{
+	{"SSH key and token", git.RemoteCredentials{SSHKeyFile: "/key", TokenFile: "/token"}, false},
+	{"Token and credential helper", git.RemoteCredentials{TokenEnv: "TOKEN", CredentialHelper: "store"}, true},
+	{"Invalid environment variable", git.RemoteCredentials{TokenEnv: "MY-TOKEN"}, true},
+	{"Username without token", git.RemoteCredentials{TokenUsername: "bot"}, true},
+}
+
+func TestGit_RemoteCredentials_Validate(t *testing.T) {
+	for _, tt := range remoteCredentialsValidateTests {
+		t.Run(tt.title, func(t *testing.T) {
+			err := tt.credentials.Validate()
+			if tt.isError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
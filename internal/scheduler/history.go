@@ -0,0 +1,188 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/common"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+)
+
+const HistoryFilename string = "history"
+
+// The number of records kept in the history file. Older records are dropped
+// when new ones are added, except for the newest record of each route.
+const maxHistoryRecords int = 1000
+
+// RunRecord describes a single scheduled update of a route.
+type RunRecord struct {
+	Route    string
+	Start    time.Time
+	Duration time.Duration
+
+	// The exit code of 'git-bundle-server update', or -1 if it could not be
+	// run at all.
+	ExitCode int
+	Error    string `json:",omitempty"`
+}
+
+func (r *RunRecord) Succeeded() bool {
+	return r.ExitCode == 0 && r.Error == ""
+}
+
+type RunHistory interface {
+	// Read returns the recorded runs, oldest first.
+	Read(ctx context.Context) ([]RunRecord, error)
+	Record(ctx context.Context, record RunRecord) error
+}
+
+type runHistory struct {
+	logger     log.TraceLogger
+	user       common.UserProvider
+	fileSystem common.FileSystem
+}
+
+func NewRunHistory(l log.TraceLogger, u common.UserProvider, fs common.FileSystem) RunHistory {
+	return &runHistory{
+		logger:     l,
+		user:       u,
+		fileSystem: fs,
+	}
+}
+
+func (h *runHistory) historyFile() (string, error) {
+	user, err := h.user.CurrentUser()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(core.SchedulerDir(user), HistoryFilename), nil
+}
+
+func (h *runHistory) readLines() ([]string, error) {
+	filename, err := h.historyFile()
+	if err != nil {
+		return nil, err
+	}
+
+	lines, err := h.fileSystem.ReadFileLines(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read run history: %w", err)
+	}
+	return lines, nil
+}
+
+func (h *runHistory) Read(ctx context.Context) ([]RunRecord, error) {
+	//lint:ignore SA4006 always override the ctx with the result from 'Region()'
+	ctx, exitRegion := h.logger.Region(ctx, "scheduler", "read_history")
+	defer exitRegion()
+
+	lines, err := h.readLines()
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]RunRecord, 0, len(lines))
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+
+		var record RunRecord
+		err = json.Unmarshal([]byte(line), &record)
+		if err != nil {
+			// Skip (rather than fail on) records corrupted by e.g. a full disk
+			continue
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+func (h *runHistory) Record(ctx context.Context, record RunRecord) error {
+	//lint:ignore SA4006 always override the ctx with the result from 'Region()'
+	ctx, exitRegion := h.logger.Region(ctx, "scheduler", "record_history")
+	defer exitRegion()
+
+	filename, err := h.historyFile()
+	if err != nil {
+		return err
+	}
+
+	lines, err := h.readLines()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to convert run record to JSON: %w", err)
+	}
+	lines = trimHistory(append(lines, string(data)))
+
+	lockFile, err := h.fileSystem.WriteLockFileFunc(filename, func(f io.Writer) error {
+		for _, line := range lines {
+			_, err := fmt.Fprintln(f, line)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write run history: %w", err)
+	}
+
+	return lockFile.Commit()
+}
+
+// trimHistory drops the oldest of the given history lines until at most
+// 'maxHistoryRecords' remain. The newest record of each route is never dropped,
+// so that a route updated rarely doesn't lose its last run to busier routes
+// (and get scheduled as if it had never run).
+func trimHistory(lines []string) []string {
+	excess := len(lines) - maxHistoryRecords
+	if excess <= 0 {
+		return lines
+	}
+
+	routes := make([]string, len(lines))
+	newest := make(map[string]int)
+	for i, line := range lines {
+		var record RunRecord
+		if json.Unmarshal([]byte(line), &record) != nil {
+			// Corrupted lines aren't the newest of any route, so can be dropped
+			continue
+		}
+		routes[i] = record.Route
+		newest[record.Route] = i
+	}
+
+	trimmed := make([]string, 0, maxHistoryRecords)
+	for i, line := range lines {
+		if excess > 0 {
+			if index, ok := newest[routes[i]]; !ok || index != i {
+				excess--
+				continue
+			}
+		}
+		trimmed = append(trimmed, line)
+	}
+	return trimmed
+}
+
+// LastRuns returns the most recent record of each route in 'records'.
+func LastRuns(records []RunRecord) map[string]RunRecord {
+	last := make(map[string]RunRecord)
+	for _, record := range records {
+		if existing, ok := last[record.Route]; !ok || record.Start.After(existing.Start) {
+			last[record.Route] = record
+		}
+	}
+	return last
+}
@@ -0,0 +1,246 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/cmd"
+	"github.com/git-ecosystem/git-bundle-server/internal/common"
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/log"
+	"github.com/git-ecosystem/git-bundle-server/internal/utils"
+)
+
+// The label of the scheduler daemon.
+const DaemonLabel string = "com.git-ecosystem.gitbundleserver.scheduler"
+
+// The name of the file (in the scheduler directory) whose existence indicates
+// that the scheduler daemon, rather than cron, is responsible for updates.
+const EnabledFilename string = "enabled"
+
+// Routes are considered due slightly before their next run time so that
+// updates triggered at a fixed period (e.g. by cron) aren't skipped because the
+// previous one started a few seconds late.
+const dueTolerance time.Duration = time.Minute
+
+// After a failed update (e.g. because the remote was briefly unreachable), the
+// route is retried after this delay rather than after its full interval, so
+// that a transient failure doesn't leave it stale until the next interval.
+const failedRunRetryDelay time.Duration = 15 * time.Minute
+
+// NextRun returns the time at which 'route' is next due for an update, given
+// its schedule and its most recent run (if any). If the route has never been
+// updated, the zero time is returned. A failed run is retried after
+// 'failedRunRetryDelay' (or the interval, if shorter).
+func NextRun(route string, schedule *core.UpdateSchedule, lastRun *RunRecord) time.Time {
+	if lastRun == nil {
+		return time.Time{}
+	}
+
+	if !lastRun.Succeeded() {
+		retryDelay := failedRunRetryDelay
+		if schedule.Interval < retryDelay {
+			retryDelay = schedule.Interval
+		}
+		return lastRun.Start.Add(retryDelay)
+	}
+
+	next := lastRun.Start.Add(schedule.Interval)
+	if schedule.Jitter > 0 {
+		// Derive the jitter from the route and its last run, so that it is
+		// stable between checks but differs between routes and runs.
+		h := fnv.New64a()
+		fmt.Fprintf(h, "%s@%d", route, lastRun.Start.UnixNano())
+		next = next.Add(time.Duration(h.Sum64() % uint64(schedule.Jitter)))
+	}
+
+	return next
+}
+
+// IsDue returns whether 'route' needs to be updated at time 'now'.
+func IsDue(route string, schedule *core.UpdateSchedule, lastRun *RunRecord, now time.Time) bool {
+	return !now.Add(dueTolerance).Before(NextRun(route, schedule, lastRun))
+}
+
+type Scheduler interface {
+	// Run updates each active route whenever it becomes due, checking every
+	// 'tick' until 'ctx' is canceled.
+	Run(ctx context.Context, tick time.Duration) error
+
+	// SelectRoutes returns the active routes in the order they should be
+	// updated (highest priority first). If 'dueOnly' is true, only the routes
+	// that are due at time 'now' are returned.
+	SelectRoutes(ctx context.Context, now time.Time, dueOnly bool) ([]string, error)
+
+	// UpdateRoute runs 'git-bundle-server update' with the given options for
+	// a route and records the run in the history as scheduled at 'scheduled'.
+	UpdateRoute(ctx context.Context, route string, scheduled time.Time, args []string) (*RunRecord, error)
+}
+
+type scheduler struct {
+	logger       log.TraceLogger
+	repoProvider core.RepositoryProvider
+	history      RunHistory
+	cmdExec      cmd.CommandExecutor
+	fileSystem   common.FileSystem
+}
+
+func NewScheduler(
+	l log.TraceLogger,
+	r core.RepositoryProvider,
+	h RunHistory,
+	c cmd.CommandExecutor,
+	fs common.FileSystem,
+) Scheduler {
+	return &scheduler{
+		logger:       l,
+		repoProvider: r,
+		history:      h,
+		cmdExec:      c,
+		fileSystem:   fs,
+	}
+}
+
+func (s *scheduler) Run(ctx context.Context, tick time.Duration) error {
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		err := s.runDueUpdates(ctx, time.Now())
+		if err != nil {
+			// Keep going; the problem may be resolved by the next tick
+			fmt.Printf("Failed to run scheduled updates: %s\n", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *scheduler) runDueUpdates(ctx context.Context, now time.Time) error {
+	routes, err := s.SelectRoutes(ctx, now, true)
+	if err != nil {
+		return err
+	}
+
+	for _, route := range routes {
+		if ctx.Err() != nil {
+			// Shutting down
+			return nil
+		}
+
+		_, err = s.UpdateRoute(ctx, route, now, []string{})
+		if err != nil {
+			// Without a record, the route would be updated again on the next
+			// tick, so stop here.
+			return err
+		}
+	}
+
+	return nil
+}
+
+type scheduledRoute struct {
+	route    string
+	priority int
+}
+
+func (s *scheduler) SelectRoutes(ctx context.Context, now time.Time, dueOnly bool) ([]string, error) {
+	ctx, exitRegion := s.logger.Region(ctx, "scheduler", "select_routes")
+	defer exitRegion()
+
+	repos, err := s.repoProvider.GetRepositories(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load routes: %w", err)
+	}
+
+	records, err := s.history.Read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	lastRuns := LastRuns(records)
+
+	selected := []scheduledRoute{}
+	for route, repo := range repos {
+		config, err := s.repoProvider.ReadRouteConfig(ctx, &repo)
+		if err != nil {
+			fmt.Printf("Skipping %s: %s\n", route, err)
+			continue
+		}
+		schedule, err := config.GetUpdateSchedule()
+		if err != nil {
+			fmt.Printf("Skipping %s: %s\n", route, err)
+			continue
+		}
+
+		if dueOnly {
+			var lastRun *RunRecord
+			if record, ok := lastRuns[route]; ok {
+				lastRun = &record
+			}
+			if !IsDue(route, schedule, lastRun, now) {
+				continue
+			}
+		}
+
+		selected = append(selected, scheduledRoute{route: route, priority: schedule.Priority})
+	}
+
+	sort.Slice(selected, func(i, j int) bool {
+		if selected[i].priority != selected[j].priority {
+			return selected[i].priority > selected[j].priority
+		}
+		return selected[i].route < selected[j].route
+	})
+
+	return utils.Map(selected, func(r scheduledRoute) string { return r.route }), nil
+}
+
+func (s *scheduler) UpdateRoute(ctx context.Context, route string, scheduled time.Time, args []string) (*RunRecord, error) {
+	ctx, exitRegion := s.logger.Region(ctx, "scheduler", "update_route")
+	defer exitRegion()
+
+	exe, err := s.fileSystem.GetLocalExecutable("git-bundle-server")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get path to executable: %w", err)
+	}
+
+	// Options must precede the positional route argument
+	subargs := []string{"update"}
+	subargs = append(subargs, args...)
+	subargs = append(subargs, route)
+
+	record := RunRecord{
+		Route: route,
+		Start: scheduled.UTC(),
+	}
+
+	fmt.Printf("*** Updating %s ***\n", route)
+	start := time.Now()
+	exitCode, err := s.cmdExec.RunStdout(ctx, exe, subargs...)
+	record.Duration = time.Since(start)
+	record.ExitCode = exitCode
+	if err != nil {
+		record.ExitCode = -1
+		record.Error = err.Error()
+	} else if exitCode != 0 {
+		record.Error = fmt.Sprintf("'git-bundle-server update' exited with status %d", exitCode)
+	}
+
+	if record.Error != "" {
+		fmt.Printf("Failed to update %s: %s\n", route, record.Error)
+	}
+
+	err = s.history.Record(ctx, record)
+	if err != nil {
+		return &record, fmt.Errorf("failed to record update of %s: %w", route, err)
+	}
+
+	return &record, nil
+}
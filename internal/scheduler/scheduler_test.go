@@ -0,0 +1,243 @@
+package scheduler_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/user"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/git-ecosystem/git-bundle-server/internal/core"
+	"github.com/git-ecosystem/git-bundle-server/internal/scheduler"
+	. "github.com/git-ecosystem/git-bundle-server/internal/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var testNow = time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC)
+
+var isDueTests = []struct {
+	title string
+
+	schedule core.UpdateSchedule
+	lastRun  *scheduler.RunRecord
+
+	expectedDue bool
+}{
+	{
+		"Never run, due",
+		core.UpdateSchedule{Interval: time.Hour},
+		nil,
+		true,
+	},
+	{
+		"Run within interval, not due",
+		core.UpdateSchedule{Interval: time.Hour},
+		&scheduler.RunRecord{Start: testNow.Add(-30 * time.Minute)},
+		false,
+	},
+	{
+		"Run exactly one interval ago, due",
+		core.UpdateSchedule{Interval: time.Hour},
+		&scheduler.RunRecord{Start: testNow.Add(-time.Hour)},
+		true,
+	},
+	{
+		"Run a few seconds less than one interval ago, due",
+		core.UpdateSchedule{Interval: 24 * time.Hour},
+		&scheduler.RunRecord{Start: testNow.Add(-24*time.Hour + 5*time.Second)},
+		true,
+	},
+	{
+		"Failed run within retry delay, not due",
+		core.UpdateSchedule{Interval: 24 * time.Hour},
+		&scheduler.RunRecord{Start: testNow.Add(-5 * time.Minute), ExitCode: 1},
+		false,
+	},
+	{
+		"Failed run after retry delay but within interval, due",
+		core.UpdateSchedule{Interval: 24 * time.Hour},
+		&scheduler.RunRecord{Start: testNow.Add(-time.Hour), ExitCode: 1},
+		true,
+	},
+	{
+		"Run failing to start after retry delay, due",
+		core.UpdateSchedule{Interval: 168 * time.Hour, Jitter: time.Hour},
+		&scheduler.RunRecord{Start: testNow.Add(-20 * time.Minute), ExitCode: -1, Error: "exec failed"},
+		true,
+	},
+	{
+		"Failed run within interval shorter than retry delay, not due",
+		core.UpdateSchedule{Interval: 5 * time.Minute},
+		&scheduler.RunRecord{Start: testNow.Add(-2 * time.Minute), ExitCode: 1},
+		false,
+	},
+	{
+		"Run more than interval + jitter ago, due",
+		core.UpdateSchedule{Interval: time.Hour, Jitter: 10 * time.Minute},
+		&scheduler.RunRecord{Start: testNow.Add(-70 * time.Minute)},
+		true,
+	},
+}
+
+func TestScheduler_IsDue(t *testing.T) {
+	for _, tt := range isDueTests {
+		t.Run(tt.title, func(t *testing.T) {
+			assert.Equal(t, tt.expectedDue, scheduler.IsDue("test/repo", &tt.schedule, tt.lastRun, testNow))
+		})
+	}
+}
+
+func TestScheduler_NextRun(t *testing.T) {
+	schedule := &core.UpdateSchedule{Interval: time.Hour, Jitter: 10 * time.Minute}
+
+	t.Run("Jitter is within range and stable", func(t *testing.T) {
+		for i := 0; i < 20; i++ {
+			lastRun := &scheduler.RunRecord{Start: testNow.Add(time.Duration(i) * time.Second)}
+			route := fmt.Sprintf("test/repo-%d", i)
+
+			next := scheduler.NextRun(route, schedule, lastRun)
+			assert.False(t, next.Before(lastRun.Start.Add(schedule.Interval)))
+			assert.True(t, next.Before(lastRun.Start.Add(schedule.Interval+schedule.Jitter)))
+			assert.Equal(t, next, scheduler.NextRun(route, schedule, lastRun))
+		}
+	})
+
+	t.Run("Failed run, retried before interval without jitter", func(t *testing.T) {
+		lastRun := &scheduler.RunRecord{Start: testNow, ExitCode: 1}
+		assert.Equal(t, testNow.Add(15*time.Minute), scheduler.NextRun("test/repo", schedule, lastRun))
+	})
+
+	t.Run("Never run, zero time", func(t *testing.T) {
+		assert.True(t, scheduler.NextRun("test/repo", schedule, nil).IsZero())
+	})
+}
+
+func TestScheduler_LastRuns(t *testing.T) {
+	records := []scheduler.RunRecord{
+		{Route: "test/one", Start: testNow.Add(-3 * time.Hour)},
+		{Route: "test/two", Start: testNow.Add(-2 * time.Hour)},
+		{Route: "test/one", Start: testNow.Add(-1 * time.Hour)},
+	}
+
+	last := scheduler.LastRuns(records)
+	assert.Len(t, last, 2)
+	assert.Equal(t, testNow.Add(-1*time.Hour), last["test/one"].Start)
+	assert.Equal(t, testNow.Add(-2*time.Hour), last["test/two"].Start)
+}
+
+// historyLines returns 'count' history lines of routes 'test/repo-0' to
+// 'test/repo-<routes - 1>' in turn.
+func historyLines(count int, routes int) []string {
+	lines := []string{}
+	for i := 0; i < count; i++ {
+		data, _ := json.Marshal(scheduler.RunRecord{
+			Route: fmt.Sprintf("test/repo-%d", i%routes),
+			Start: testNow.Add(time.Duration(i) * time.Minute),
+		})
+		lines = append(lines, string(data))
+	}
+	return lines
+}
+
+var recordHistoryTests = []struct {
+	title string
+
+	existingLines []string
+
+	expectedLineCount int
+	expectedFirst     string
+}{
+	{
+		"First record creates history",
+		[]string{},
+		1,
+		"test/new",
+	},
+	{
+		"Record is appended to history",
+		historyLines(3, 3),
+		4,
+		"test/repo-0",
+	},
+	{
+		"Oldest records are dropped when history is full",
+		historyLines(1000, 10),
+		1000,
+		"test/repo-1",
+	},
+	{
+		"Only record of a quiet route is kept when history is full",
+		append([]string{`{"Route":"test/quiet"}`}, historyLines(999, 1)...),
+		1000,
+		"test/quiet",
+	},
+	{
+		"Corrupted records are dropped when history is full",
+		append(historyLines(1, 1), append([]string{`{"Route":`}, historyLines(999, 1)...)...),
+		1000,
+		"test/repo-0",
+	},
+	{
+		"Newest record of each route is kept even if history exceeds limit",
+		historyLines(1000, 1000),
+		1001,
+		"test/repo-0",
+	},
+}
+
+func TestScheduler_RecordHistory(t *testing.T) {
+	testLogger := &MockTraceLogger{}
+	testUser := &user.User{
+		Uid:      "123",
+		Username: "testuser",
+		HomeDir:  "/my/test/dir",
+	}
+	testUserProvider := &MockUserProvider{}
+	testUserProvider.On("CurrentUser").Return(testUser, nil)
+
+	for _, tt := range recordHistoryTests {
+		t.Run(tt.title, func(t *testing.T) {
+			testFileSystem := &MockFileSystem{}
+			history := scheduler.NewRunHistory(testLogger, testUserProvider, testFileSystem)
+
+			historyFile := "/my/test/dir/git-bundle-server/scheduler/history"
+			testFileSystem.On("ReadFileLines", historyFile).Return(tt.existingLines, nil).Once()
+
+			var mockWriteFunc func(io.Writer) error
+			var writeErr error
+			buf := &bytes.Buffer{}
+			lockFile := &MockLockFile{}
+			lockFile.On("Commit").Return(nil).Once()
+			testFileSystem.On("WriteLockFileFunc",
+				historyFile,
+				mock.MatchedBy(func(writeFunc func(io.Writer) error) bool {
+					mockWriteFunc = writeFunc
+					return true
+				}),
+			).Run(
+				func(mock.Arguments) { writeErr = mockWriteFunc(buf) },
+			).Return(lockFile, writeErr).Once()
+
+			err := history.Record(context.Background(), scheduler.RunRecord{
+				Route: "test/new",
+				Start: testNow,
+			})
+			assert.Nil(t, err)
+			mock.AssertExpectationsForObjects(t, testFileSystem, lockFile)
+
+			lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+			assert.Len(t, lines, tt.expectedLineCount)
+
+			var first, last scheduler.RunRecord
+			assert.Nil(t, json.Unmarshal([]byte(lines[0]), &first))
+			assert.Nil(t, json.Unmarshal([]byte(lines[len(lines)-1]), &last))
+			assert.Equal(t, tt.expectedFirst, first.Route)
+			assert.Equal(t, "test/new", last.Route)
+		})
+	}
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/git-ecosystem/git-bundle-server/internal/cmd"
 	"github.com/git-ecosystem/git-bundle-server/internal/common"
+	"github.com/git-ecosystem/git-bundle-server/internal/git"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -158,6 +159,11 @@ func (m *MockUserProvider) CurrentUser() (*user.User, error) {
 	return fnArgs.Get(0).(*user.User), fnArgs.Error(1)
 }
 
+func (m *MockUserProvider) LookupUser(username string) (*user.User, error) {
+	fnArgs := m.Called(username)
+	return fnArgs.Get(0).(*user.User), fnArgs.Error(1)
+}
+
 type MockCommandExecutor struct {
 	mock.Mock
 }
@@ -234,28 +240,28 @@ type MockGitHelper struct {
 	mock.Mock
 }
 
-func (m *MockGitHelper) CreateBundle(ctx context.Context, repoDir string, filename string) (bool, error) {
-	fnArgs := m.Called(ctx, repoDir, filename)
+func (m *MockGitHelper) CreateBundle(ctx context.Context, repoDir string, filename string, filter string) (bool, error) {
+	fnArgs := m.Called(ctx, repoDir, filename, filter)
 	return fnArgs.Bool(0), fnArgs.Error(1)
 }
 
-func (m *MockGitHelper) CreateBundleFromRefs(ctx context.Context, repoDir string, filename string, refs map[string]string) error {
-	fnArgs := m.Called(ctx, repoDir, filename, refs)
+func (m *MockGitHelper) CreateBundleFromRefs(ctx context.Context, repoDir string, filename string, refs map[string]string, filter string) error {
+	fnArgs := m.Called(ctx, repoDir, filename, refs, filter)
 	return fnArgs.Error(0)
 }
 
-func (m *MockGitHelper) CreateIncrementalBundle(ctx context.Context, repoDir string, filename string, prereqs []string) (bool, error) {
-	fnArgs := m.Called(ctx, repoDir, filename, prereqs)
+func (m *MockGitHelper) CreateIncrementalBundle(ctx context.Context, repoDir string, filename string, prereqs []string, filter string) (bool, error) {
+	fnArgs := m.Called(ctx, repoDir, filename, prereqs, filter)
 	return fnArgs.Bool(0), fnArgs.Error(1)
 }
 
-func (m *MockGitHelper) CloneBareRepo(ctx context.Context, url string, destination string) error {
-	fnArgs := m.Called(ctx, url, destination)
+func (m *MockGitHelper) CloneBareRepo(ctx context.Context, url string, destination string, credentials *git.RemoteCredentials) error {
+	fnArgs := m.Called(ctx, url, destination, credentials)
 	return fnArgs.Error(0)
 }
 
-func (m *MockGitHelper) UpdateBareRepo(ctx context.Context, repoDir string) error {
-	fnArgs := m.Called(ctx, repoDir)
+func (m *MockGitHelper) UpdateBareRepo(ctx context.Context, repoDir string, credentials *git.RemoteCredentials) error {
+	fnArgs := m.Called(ctx, repoDir, credentials)
 	return fnArgs.Error(0)
 }
 
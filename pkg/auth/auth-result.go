@@ -15,6 +15,13 @@ type Header struct {
 // AuthMiddleware's Authorize function.
 type AuthResult struct {
 	applyResultFunc func(http.ResponseWriter) bool
+
+	// The status code given to Deny(), or 0 if the result allows the request.
+	status int
+
+	// The identity of the caller, if the result allows the request and the
+	// AuthMiddleware provided one (see AllowAs()).
+	identity *Identity
 }
 
 // ApplyResult applies the AuthResult's configuration to the provided
@@ -33,6 +40,21 @@ func (a *AuthResult) ApplyResult(w http.ResponseWriter) bool {
 	}
 }
 
+// Status returns the status of the response the web server sends instead of
+// the requested content: the code given to Deny(), or 500 for an invalid
+// AuthResult. For an AuthResult created with Allow(), it returns 200; the
+// status of the response then depends on the requested content.
+func (a *AuthResult) Status() int {
+	switch {
+	case a.applyResultFunc == nil:
+		return http.StatusInternalServerError
+	case a.status == 0:
+		return http.StatusOK
+	default:
+		return a.status
+	}
+}
+
 func writeCustomHeaders(w http.ResponseWriter, headers []Header) {
 	for _, h := range headers {
 		w.Header().Add(h.Key, h.Value)
@@ -58,6 +80,7 @@ func Deny(code int, headers ...Header) AuthResult {
 			w.WriteHeader(code)
 			return true
 		},
+		status: code,
 	}
 }
 
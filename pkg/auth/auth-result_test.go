@@ -72,6 +72,7 @@ func Test_Deny(t *testing.T) {
 
 			// Check code and content
 			assert.Equal(t, tt.code, w.Code)
+			assert.Equal(t, tt.code, result.Status())
 			assert.Equal(t, tt.expectedHeaders, w.Header())
 			assert.Empty(t, w.Body)
 		})
@@ -121,6 +122,7 @@ func Test_Allow(t *testing.T) {
 
 			// Make sure no code or body was written, but headers are
 			assert.Equal(t, 200, w.Code) // default code
+			assert.Equal(t, 200, result.Status())
 			assert.Equal(t, tt.expectedHeaders, w.Header())
 			assert.Empty(t, w.Body)
 		})
@@ -140,6 +142,7 @@ func Test_AuthResult(t *testing.T) {
 
 		// Check code and content
 		assert.Equal(t, 500, w.Code)
+		assert.Equal(t, 500, result.Status())
 		assert.Empty(t, w.Header())
 		assert.Empty(t, w.Body)
 	})
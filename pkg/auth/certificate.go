@@ -0,0 +1,27 @@
+package auth
+
+import (
+	"crypto/x509"
+	"net/http"
+)
+
+// VerifiedClientCertificate returns the TLS client certificate of a request if
+// the client presented one and the web server verified it against its client
+// certificate authority (see the '--client-ca' option), or nil otherwise.
+func VerifiedClientCertificate(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return r.TLS.VerifiedChains[0][0]
+}
+
+// SPIFFEID returns the SPIFFE ID of a certificate (the 'spiffe://' URI in its
+// subject alternative names), or an empty string if it has none.
+func SPIFFEID(cert *x509.Certificate) string {
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "spiffe" {
+			return uri.String()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+)
+
+// The Identity type describes the caller of an allowed request, as determined
+// by an AuthMiddleware.
+type Identity struct {
+	// Name identifies the caller, e.g. a username, the subject of a token, or
+	// the SPIFFE ID of a client certificate.
+	Name string
+
+	// Method is the way the caller authenticated, e.g. "basic" or "jwt".
+	// Optional.
+	Method string
+
+	// Attributes holds any other information about the caller, e.g. the groups
+	// they belong to. Optional.
+	Attributes map[string]string
+}
+
+type identityContextKey struct{}
+
+// ContextWithIdentity returns a copy of ctx carrying the identity.
+func ContextWithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityContextKey{}, identity)
+}
+
+// IdentityFromContext returns the identity attached to the context of an
+// allowed request, or nil if the AuthMiddleware didn't provide one (e.g. it
+// allowed the request with Allow() rather than AllowAs()).
+func IdentityFromContext(ctx context.Context) *Identity {
+	identity, _ := ctx.Value(identityContextKey{}).(*Identity)
+	return identity
+}
+
+// IdentityFromRequest returns the identity attached to the context of an
+// allowed request (see IdentityFromContext()).
+func IdentityFromRequest(r *http.Request) *Identity {
+	return IdentityFromContext(r.Context())
+}
+
+// AllowAs creates an AuthResult instance like Allow(), additionally indicating
+// the identity of the caller. The bundle web server attaches the identity to
+// the context of the request it serves (see IdentityFromContext()), e.g. to
+// attribute the request in its logs.
+func AllowAs(identity Identity, headers ...Header) AuthResult {
+	result := Allow(headers...)
+	result.identity = &identity
+	return result
+}
+
+// Identity returns the identity of the caller indicated by an AuthResult
+// created with AllowAs(), or nil otherwise.
+func (a *AuthResult) Identity() *Identity {
+	return a.identity
+}
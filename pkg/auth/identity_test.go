@@ -0,0 +1,56 @@
+package auth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/git-ecosystem/git-bundle-server/pkg/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_AllowAs(t *testing.T) {
+	t.Run("AllowAs allows with identity and headers", func(t *testing.T) {
+		w := httptest.NewRecorder()
+
+		identity := auth.Identity{
+			Name:       "alice",
+			Method:     "basic",
+			Attributes: map[string]string{"groups": "admins"},
+		}
+		result := auth.AllowAs(identity, auth.Header{Key: "Cache-Control", Value: "no-store"})
+		wroteResponse := result.ApplyResult(w)
+
+		// Make sure we aren't exiting
+		assert.False(t, wroteResponse)
+		assert.Equal(t, 200, w.Code) // default code
+		assert.Equal(t, http.Header{"Cache-Control": {"no-store"}}, w.Header())
+
+		assert.Equal(t, &identity, result.Identity())
+	})
+
+	t.Run("Allow and Deny have no identity", func(t *testing.T) {
+		allowResult := auth.Allow()
+		assert.Nil(t, allowResult.Identity())
+
+		denyResult := auth.Deny(404)
+		assert.Nil(t, denyResult.Identity())
+	})
+}
+
+func Test_IdentityFromContext(t *testing.T) {
+	t.Run("Context without identity", func(t *testing.T) {
+		assert.Nil(t, auth.IdentityFromContext(context.Background()))
+	})
+
+	t.Run("Context with identity", func(t *testing.T) {
+		identity := &auth.Identity{Name: "alice", Method: "jwt"}
+		ctx := auth.ContextWithIdentity(context.Background(), identity)
+		assert.Equal(t, identity, auth.IdentityFromContext(ctx))
+
+		req, err := http.NewRequestWithContext(ctx, "GET", "test/repo", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, identity, auth.IdentityFromRequest(req))
+	})
+}